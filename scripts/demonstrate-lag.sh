@@ -3,8 +3,8 @@
 # Script para demonstrar lag intencional e investigação via observabilidade
 # Demonstra: lag intencional → observabilidade → diagnóstico → escalonamento
 # 
-# IMPORTANTE: O lag agora é controlado via variáveis de ambiente no docker-compose.yml
-# Para ativar o lag, edite o docker-compose.yml e reinicie o serviço
+# IMPORTANTE: O lag é controlado em runtime via GET/PUT /admin/lag
+# (ou pelas variáveis INTENTIONAL_LAG_* do docker-compose.yml na inicialização)
 
 set -e
 
@@ -16,19 +16,21 @@ BLUE='\033[0;34m'
 NC='\033[0m' # No Color
 
 PAYMENT_URL="http://localhost:8080/payments"
-COMPOSE_FILE="docker-compose.yml"
+ADMIN_LAG_URL="http://localhost:8080/admin/lag"
+# Token das rotas /admin/* (mesmo valor de ADMIN_TOKEN no docker-compose.yml)
+ADMIN_TOKEN="${ADMIN_TOKEN:-dev-admin-token}"
 
 echo -e "${BLUE}=== Demonstração: Lag Intencional e Observabilidade ===${NC}"
 echo ""
 echo "Este script demonstra o ciclo completo:"
 echo "1. Baseline sem lag"
-echo "2. Ativar lag intencional (via variáveis de ambiente)"
+echo "2. Ativar lag intencional (via /admin/lag)"
 echo "3. Observar sinais de latência (métricas, logs, traces)"
 echo "4. Diagnosticar a causa do problema"
 echo "5. Documentar processo de escalonamento"
 echo ""
 echo -e "${YELLOW}NOTA:${NC} O lag é um problema que aparece naturalmente nas requisições."
-echo "Ele é controlado via variáveis de ambiente no docker-compose.yml"
+echo "Ele é controlado em runtime via $ADMIN_LAG_URL"
 echo ""
 
 # Verificar se o serviço está rodando
@@ -42,15 +44,18 @@ echo -e "${GREEN}✓ Serviço está rodando${NC}"
 echo ""
 
 # Verificar se lag está ativo
-LAG_ENABLED=$(docker compose exec -T payment-service printenv INTENTIONAL_LAG_ENABLED 2>/dev/null || echo "")
-if [ "$LAG_ENABLED" = "true" ]; then
+lag_enabled() {
+    curl -s -H "Authorization: Bearer $ADMIN_TOKEN" "$ADMIN_LAG_URL" 2>/dev/null | grep -q '"enabled":true'
+}
+
+if lag_enabled; then
     echo -e "${YELLOW}⚠ Lag intencional já está ativo!${NC}"
-    echo "Para desativar, edite docker-compose.yml e reinicie: docker compose up -d payment-service"
+    echo "Para desativar: ./scripts/disable-lag.sh"
     echo ""
     read -p "Deseja continuar mesmo com lag ativo? (s/N): " -n 1 -r
     echo
     if [[ ! $REPLY =~ ^[Ss]$ ]]; then
-        echo "Edite docker-compose.yml para desativar o lag e execute: docker compose up -d payment-service"
+        echo "Desative o lag com ./scripts/disable-lag.sh e execute novamente"
         exit 0
     fi
 fi
@@ -95,28 +100,19 @@ echo -e "${RED}=== FASE 2: Ativando Lag Intencional ===${NC}"
 echo ""
 echo "Para ativar o lag intencional (simular problema de latência):"
 echo ""
-echo "1. Edite o arquivo: $COMPOSE_FILE"
-echo "2. Descomente as variáveis de ambiente no serviço payment-service:"
-echo ""
-echo -e "${BLUE}   environment:${NC}"
-echo -e "${BLUE}     - INTENTIONAL_LAG_ENABLED=true${NC}"
-echo -e "${BLUE}     - INTENTIONAL_LAG_DATABASE_MS=2000${NC}"
-echo -e "${BLUE}     - INTENTIONAL_LAG_CACHE_MS=500${NC}"
-echo -e "${BLUE}     - INTENTIONAL_LAG_EXTERNAL_MS=1000${NC}"
+echo "   ./scripts/enable-lag.sh"
 echo ""
-echo "3. Reinicie o serviço:"
-echo "   docker compose up -d payment-service"
+echo "OU diretamente pela API de administração:"
 echo ""
-echo "OU use o script helper:"
-echo "   ./scripts/enable-lag.sh"
+echo -e "${BLUE}   curl -X PUT $ADMIN_LAG_URL -H \"Authorization: Bearer \$ADMIN_TOKEN\" \\\\${NC}"
+echo -e "${BLUE}     -d '{\"enabled\": true, \"databaseDelayMs\": 2000, \"cacheDelayMs\": 500, \"externalDelayMs\": 1000}'${NC}"
 echo ""
-read -p "Pressione Enter após ativar o lag e reiniciar o serviço..."
+read -p "Pressione Enter após ativar o lag..."
 
 # Verificar se lag foi ativado
-LAG_ENABLED=$(docker compose exec -T payment-service printenv INTENTIONAL_LAG_ENABLED 2>/dev/null || echo "")
-if [ "$LAG_ENABLED" != "true" ]; then
+if ! lag_enabled; then
     echo -e "${RED}⚠ Lag não está ativo!${NC}"
-    echo "Por favor, ative o lag conforme instruções acima e reinicie o serviço."
+    echo "Por favor, ative o lag conforme instruções acima."
     read -p "Pressione Enter para continuar mesmo assim..."
 fi
 
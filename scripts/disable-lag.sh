@@ -1,10 +1,12 @@
 #!/bin/bash
 
-# Script helper para desativar lag intencional via docker-compose
+# Script helper para desativar lag intencional em runtime via PUT /admin/lag
 
 set -e
 
-COMPOSE_FILE="docker-compose.yml"
+ADMIN_URL="${PAYMENT_ADMIN_URL:-http://localhost:8080/admin/lag}"
+# Token das rotas /admin/* (mesmo valor de ADMIN_TOKEN no docker-compose.yml)
+ADMIN_TOKEN="${ADMIN_TOKEN:-dev-admin-token}"
 
 # Cores
 GREEN='\033[0;32m'
@@ -15,30 +17,21 @@ NC='\033[0m'
 echo -e "${YELLOW}=== Desativando Lag Intencional ===${NC}"
 echo ""
 
-# Verificar se docker-compose.yml existe
-if [ ! -f "$COMPOSE_FILE" ]; then
-    echo -e "${RED}Erro: $COMPOSE_FILE não encontrado${NC}"
-    exit 1
-fi
+response=$(curl -s -w "\n%{http_code}" -X PUT "$ADMIN_URL" \
+    -H "Content-Type: application/json" \
+    -H "Authorization: Bearer $ADMIN_TOKEN" \
+    -H "X-Client-ID: disable-lag.sh" \
+    -d '{"enabled": false}' 2>/dev/null) || true
 
-# Desativar lag no docker-compose.yml
-# Comentar as variáveis de ambiente
-sed -i.bak \
-    -e 's/- INTENTIONAL_LAG_ENABLED=true/# - INTENTIONAL_LAG_ENABLED=true/' \
-    -e 's/- INTENTIONAL_LAG_DATABASE_MS=2000/# - INTENTIONAL_LAG_DATABASE_MS=2000/' \
-    -e 's/- INTENTIONAL_LAG_CACHE_MS=500/# - INTENTIONAL_LAG_CACHE_MS=500/' \
-    -e 's/- INTENTIONAL_LAG_EXTERNAL_MS=1000/# - INTENTIONAL_LAG_EXTERNAL_MS=1000/' \
-    "$COMPOSE_FILE"
+http_code=$(echo "$response" | tail -n 1)
+body=$(echo "$response" | sed '$d')
 
-# Remover arquivo .bak criado pelo sed
-rm -f "${COMPOSE_FILE}.bak"
-
-echo -e "${GREEN}✓ Variáveis de ambiente de lag desativadas no docker-compose.yml${NC}"
-echo ""
-echo "Reiniciando payment-service..."
-docker compose up -d payment-service
+if [ "$http_code" != "200" ]; then
+    echo -e "${RED}Erro: não foi possível desativar o lag (HTTP ${http_code:-sem resposta})${NC}"
+    echo "$body"
+    exit 1
+fi
 
-echo ""
 echo -e "${GREEN}✓ Lag intencional desativado!${NC}"
 echo ""
 echo "O serviço voltou ao comportamento normal."
@@ -1,12 +1,17 @@
 #!/bin/bash
 
-# Script helper para ativar lag intencional via docker-compose
-# O lag aparecerá naturalmente nas requisições normais
+# Script helper para ativar lag intencional em runtime via PUT /admin/lag
+# O lag aparecerá naturalmente nas requisições normais (sem reiniciar o serviço)
 
 set -e
 
-COMPOSE_FILE="docker-compose.yml"
-BACKUP_FILE="docker-compose.yml.backup"
+ADMIN_URL="${PAYMENT_ADMIN_URL:-http://localhost:8080/admin/lag}"
+# Token das rotas /admin/* (mesmo valor de ADMIN_TOKEN no docker-compose.yml)
+ADMIN_TOKEN="${ADMIN_TOKEN:-dev-admin-token}"
+DATABASE_MS="${DATABASE_MS:-2000}"
+CACHE_MS="${CACHE_MS:-500}"
+EXTERNAL_MS="${EXTERNAL_MS:-1000}"
+LAG_PERCENTAGE="${LAG_PERCENTAGE:-1.0}"
 
 # Cores
 GREEN='\033[0;32m'
@@ -17,41 +22,35 @@ NC='\033[0m'
 echo -e "${YELLOW}=== Ativando Lag Intencional ===${NC}"
 echo ""
 
-# Verificar se docker-compose.yml existe
-if [ ! -f "$COMPOSE_FILE" ]; then
-    echo -e "${RED}Erro: $COMPOSE_FILE não encontrado${NC}"
+response=$(curl -s -w "\n%{http_code}" -X PUT "$ADMIN_URL" \
+    -H "Content-Type: application/json" \
+    -H "Authorization: Bearer $ADMIN_TOKEN" \
+    -H "X-Client-ID: enable-lag.sh" \
+    -d "{
+        \"enabled\": true,
+        \"databaseDelayMs\": $DATABASE_MS,
+        \"cacheDelayMs\": $CACHE_MS,
+        \"externalDelayMs\": $EXTERNAL_MS,
+        \"lagPercentage\": $LAG_PERCENTAGE
+    }" 2>/dev/null) || true
+
+http_code=$(echo "$response" | tail -n 1)
+body=$(echo "$response" | sed '$d')
+
+if [ "$http_code" != "200" ]; then
+    echo -e "${RED}Erro: não foi possível ativar o lag (HTTP ${http_code:-sem resposta})${NC}"
+    echo "$body"
+    echo "Verifique se o payment-service está rodando: docker compose up -d"
     exit 1
 fi
 
-# Criar backup
-cp "$COMPOSE_FILE" "$BACKUP_FILE"
-echo -e "${GREEN}✓ Backup criado: $BACKUP_FILE${NC}"
-
-# Ativar lag no docker-compose.yml
-# Descomentar as variáveis de ambiente
-sed -i.bak \
-    -e 's/# - INTENTIONAL_LAG_ENABLED=true/- INTENTIONAL_LAG_ENABLED=true/' \
-    -e 's/# - INTENTIONAL_LAG_DATABASE_MS=2000/- INTENTIONAL_LAG_DATABASE_MS=2000/' \
-    -e 's/# - INTENTIONAL_LAG_CACHE_MS=500/- INTENTIONAL_LAG_CACHE_MS=500/' \
-    -e 's/# - INTENTIONAL_LAG_EXTERNAL_MS=1000/- INTENTIONAL_LAG_EXTERNAL_MS=1000/' \
-    "$COMPOSE_FILE"
-
-# Remover arquivo .bak criado pelo sed
-rm -f "${COMPOSE_FILE}.bak"
-
-echo -e "${GREEN}✓ Variáveis de ambiente de lag ativadas no docker-compose.yml${NC}"
-echo ""
-echo "Reiniciando payment-service..."
-docker compose up -d payment-service
-
-echo ""
 echo -e "${GREEN}✓ Lag intencional ativado!${NC}"
 echo ""
 echo "O lag aparecerá naturalmente nas requisições para /payments"
-echo "Configuração:"
-echo "  - Database delay: 2000ms"
-echo "  - Cache delay: 500ms"
-echo "  - External delay: 1000ms"
+echo "Configuração aplicada:"
+echo "  $body"
 echo ""
+echo "Valores podem ser ajustados por variável: DATABASE_MS, CACHE_MS, EXTERNAL_MS, LAG_PERCENTAGE"
+echo "Para consultar: curl -H \"Authorization: Bearer \$ADMIN_TOKEN\" $ADMIN_URL"
 echo "Para desativar: ./scripts/disable-lag.sh"
 echo ""
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shared/chaos"
+)
+
+// ============================================================================
+// LAG E FALHAS INTENCIONAIS (biblioteca compartilhada shared/chaos)
+// ============================================================================
+
+const (
+	chaosStageConsume    = "consume"    // evento recebido da exchange "payments"
+	chaosStageProcessing = "processing" // análise antifraude de um pagamento
+)
+
+var (
+	lagController  *chaos.LagController
+	faultInjector  *chaos.FaultInjector
+	scenarioRunner *chaos.ScenarioRunner
+)
+
+// Campos de log de lag e falhas: correlation_id e trace_id da mensagem
+func chaosOptions() chaos.Options {
+	return chaos.Options{
+		Logger: logger,
+		ContextFields: func(ctx context.Context) []zap.Field {
+			correlationID, _ := ctx.Value("correlation_id").(string)
+			traceID, _ := ctx.Value("trace_id").(string)
+			return []zap.Field{
+				zap.String("correlation_id", correlationID),
+				zap.String("trace_id", traceID),
+			}
+		},
+	}
+}
+
+// initChaosFromEnv cria o lag (desabilitado por padrão) e o injetor (sem
+// falhas por padrão) a partir de INTENTIONAL_LAG_* e FAULT_*, carrega o
+// cenário de SCENARIO_FILE e registra /admin/lag, /admin/faults e
+// /admin/scenario no servidor de métricas (:8080)
+func initChaosFromEnv() {
+	opts := chaosOptions()
+	lagController = chaos.NewLagController(opts,
+		chaos.Stage{Name: chaosStageProcessing, Description: "antifraud processing", DefaultDelay: 2 * time.Second,
+			Buckets: []float64{0.1, 0.5, 1.0, 2.0, 5.0, 10.0, 30.0}},
+	)
+	lagController.LoadEnv()
+
+	faultInjector = chaos.NewFaultInjector(opts,
+		chaos.FaultStage{Name: chaosStageConsume, Faults: []string{chaos.FaultMalformed, chaos.FaultDrop, chaos.FaultDuplicate}},
+		chaos.FaultStage{Name: chaosStageProcessing, Faults: []string{chaos.FaultError, chaos.FaultTimeout, chaos.FaultPanic}},
+	)
+	faultInjector.LoadEnv()
+
+	scenarioRunner = chaos.NewScenarioRunner(opts, lagController, faultInjector)
+	scenarioRunner.LoadEnv()
+
+	admin := &chaos.Admin{Options: opts, Lag: lagController, Faults: faultInjector, Scenario: scenarioRunner}
+	admin.Register(http.DefaultServeMux)
+}
+
+// lagTargetFromEvent monta o alvo das regras de lag: endpoints casam com o
+// tipo do evento (ex: "PaymentCreated")
+func lagTargetFromEvent(ctx context.Context, event PaymentEvent) chaos.LagTarget {
+	correlationID, _ := ctx.Value("correlation_id").(string)
+	return chaos.LagTarget{
+		Endpoint:      event.Event,
+		AccountID:     event.AccountID,
+		Currency:      event.Amount.Currency(),
+		CorrelationID: correlationID,
+	}
+}
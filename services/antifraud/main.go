@@ -3,10 +3,12 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/rand"
 	"net/http"
 	"os"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -22,11 +24,20 @@ import (
 	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
 	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+
+	"shared/adminauth"
+	"shared/chaos"
+	"shared/messaging"
+	"shared/money"
+	"shared/shutdown"
+	"shared/usemetrics"
 )
 
 var (
 	logger *zap.Logger
 	tracer trace.Tracer
+	// nil com o tracing desabilitado; Shutdown envia os spans pendentes do batcher
+	tracerProvider *tracesdk.TracerProvider
 
 	// Métricas RED
 	messagesProcessed = promauto.NewCounterVec(
@@ -55,6 +66,44 @@ var (
 		[]string{"status"},
 	)
 
+	// Confirmação das mensagens: ack, retry, dead_letter ou requeue
+	messageAcks = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "antifraud_message_acks_total",
+			Help: "Consumed messages by acknowledgement outcome (ack, retry, dead_letter, requeue)",
+		},
+		[]string{"outcome"},
+	)
+
+	// Pool de workers (USE): tamanho, ocupados, fila por worker e utilização
+	antifraudWorkers = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "antifraud_workers",
+			Help: "Size of the antifraud worker pool",
+		},
+	)
+
+	antifraudWorkersBusy = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "antifraud_workers_busy",
+			Help: "Antifraud workers currently processing a message",
+		},
+	)
+
+	antifraudWorkerQueued = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "antifraud_worker_queued_messages",
+			Help: "Delivered messages waiting for their account's worker",
+		},
+	)
+
+	antifraudWorkerUtilization = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "antifraud_worker_utilization_ratio",
+			Help: "Fraction of worker time spent processing over the last sampling window (0-1)",
+		},
+	)
+
 	// Métricas de negócio
 	fraudDetected = promauto.NewCounter(
 		prometheus.CounterOpts{
@@ -72,6 +121,16 @@ var (
 	)
 )
 
+// PaymentEvent contém os campos do evento da exchange "payments" usados aqui;
+// o valor chega como money.Money (unidades menores + moeda), sem float64
+type PaymentEvent struct {
+	Event     string      `json:"event"`
+	PaymentID string      `json:"paymentId"`
+	AccountID string      `json:"accountId"`
+	Amount    money.Money `json:"amount"`
+	TS        int64       `json:"ts"`
+}
+
 func initTracing() {
 	jaegerEndpoint := os.Getenv("JAEGER_ENDPOINT")
 
@@ -111,6 +170,7 @@ func initTracing() {
 		propagation.Baggage{},
 	))
 
+	tracerProvider = tp
 	tracer = otel.Tracer("antifraud-service")
 }
 
@@ -122,64 +182,111 @@ func initLogger() {
 	}
 }
 
-func extractTraceContext(headers amqp.Table) (context.Context, trace.SpanContext) {
-	ctx := context.Background()
-	propagator := otel.GetTextMapPropagator()
+// processPayment analisa um evento da exchange "payments". O erro retornado
+// decide a confirmação da mensagem (veja settle)
+func processPayment(ctx context.Context, msg amqp.Delivery) (err error) {
+	// Span consumer filho do producer do payment (traceparent nos headers)
+	ctx, span := tracer.Start(ctx, "antifraud.process",
+		messaging.ConsumeSpanOptions(retryTopology.Config().Queue, msg)...)
+	defer span.End()
 
-	// Converter amqp.Table para map[string]string para propagação
-	carrier := make(map[string]string)
-	if headers != nil {
-		if traceID, ok := headers["X-Trace-ID"].(string); ok {
-			carrier["traceparent"] = traceID
-		}
-		if correlationID, ok := headers["X-Correlation-ID"].(string); ok {
-			carrier["baggage-correlation-id"] = correlationID
+	correlationID := messaging.CorrelationID(ctx, msg.Headers)
+	traceID := span.SpanContext().TraceID().String()
+	ctx = context.WithValue(ctx, "correlation_id", correlationID)
+	ctx = context.WithValue(ctx, "trace_id", traceID)
+	msgBody := msg.Body
+
+	// Pânico (injetado) em uma mensagem não derruba o consumidor
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("panic: %v", rec)
+			messagesProcessed.WithLabelValues("error").Inc()
+			logger.Error("panic_recovered",
+				zap.Any("panic", rec),
+				zap.String("correlation_id", correlationID),
+				zap.String("trace_id", traceID),
+			)
 		}
+	}()
+
+	// Falhas injetadas no consumo: evento perdido, corrompido ou duplicado
+	fault, _ := faultInjector.Inject(ctx, chaosStageConsume)
+	switch fault {
+	case chaos.FaultDrop:
+		return nil
+	case chaos.FaultMalformed:
+		msgBody = msgBody[:len(msgBody)/2]
 	}
 
-	ctx = propagator.Extract(ctx, propagation.MapCarrier(carrier))
-	return ctx, trace.SpanContext{}
-}
+	var event PaymentEvent
+	if err := json.Unmarshal(msgBody, &event); err != nil {
+		logger.Error("failed_to_unmarshal",
+			zap.Error(err),
+			zap.String("correlation_id", correlationID),
+			zap.String("trace_id", traceID),
+		)
+		messagesProcessed.WithLabelValues("error").Inc()
+		return messaging.Permanent(reasonMalformedEvent, fmt.Errorf("unmarshal event: %w", err))
+	}
 
-func processPayment(ctx context.Context, msgBody []byte, headers amqp.Table) {
-	start := time.Now()
+	// Atraso ponta a ponta: do registro do evento no payment até o consumo
+	usemetrics.ObserveEventAge(event.Event, event.TS)
 
-	// Extrair correlation ID e trace ID
-	correlationID := ""
-	traceID := ""
-	if headers != nil {
-		if cid, ok := headers["X-Correlation-ID"].(string); ok {
-			correlationID = cid
-		}
-		if tid, ok := headers["X-Trace-ID"].(string); ok {
-			traceID = tid
+	// A exchange "payments" recebe um evento por transição de estado;
+	// Apenas pagamentos novos passam pela análise antifraude
+	if event.Event != "PaymentCreated" {
+		return nil
+	}
+
+	// Lag direcionado: regras avaliadas uma vez por evento
+	ctx = lagController.Target(ctx, lagTargetFromEvent(ctx, event))
+
+	deliveries := 1
+	if fault == chaos.FaultDuplicate {
+		deliveries = 2
+	}
+	for i := 0; i < deliveries; i++ {
+		if err := analyzePayment(ctx, event, correlationID, traceID); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	ctx, span := tracer.Start(ctx, "antifraud.process")
-	defer span.End()
+// analyzePayment calcula o risk score de um pagamento novo
+func analyzePayment(ctx context.Context, event PaymentEvent, correlationID, traceID string) error {
+	start := time.Now()
+	span := trace.SpanFromContext(ctx)
+	paymentID := event.PaymentID
+	amount := event.Amount
 
-	var event map[string]interface{}
-	if err := json.Unmarshal(msgBody, &event); err != nil {
-		logger.Error("failed_to_unmarshal",
+	// Falhas injetadas na análise (erro ou timeout da dependência de score)
+	if _, err := faultInjector.Inject(ctx, chaosStageProcessing); err != nil {
+		duration := time.Since(start)
+		messagesProcessed.WithLabelValues("error").Inc()
+		processingDuration.WithLabelValues("error").Observe(duration.Seconds())
+		processingDurationPercentiles.WithLabelValues("error").(prometheus.Summary).Observe(duration.Seconds())
+		logger.Error("payment_processing_failed",
+			zap.String("service", "antifraud-service"),
+			zap.String("payment_id", paymentID),
 			zap.Error(err),
+			zap.Duration("duration_ms", duration),
 			zap.String("correlation_id", correlationID),
 			zap.String("trace_id", traceID),
 		)
-		messagesProcessed.WithLabelValues("error").Inc()
-		return
+		return err
 	}
 
-	paymentID, _ := event["paymentId"].(string)
-	amount, _ := event["amount"].(float64)
-
-	// Simular processamento antifraud (com latência variável)
-	processingTime := 50*time.Millisecond + time.Duration(rand.Intn(100))*time.Millisecond
-	// 1% tem latência muito alta (cauda)
-	if rand.Float64() < 0.01 {
-		processingTime += 500 * time.Millisecond
+	// Lag intencional tem prioridade sobre a latência simulada
+	if _, ok := lagController.Inject(ctx, chaosStageProcessing); !ok {
+		// Simular processamento antifraud (com latência variável)
+		processingTime := 50*time.Millisecond + time.Duration(rand.Intn(100))*time.Millisecond
+		// 1% tem latência muito alta (cauda)
+		if rand.Float64() < 0.01 {
+			processingTime += 500 * time.Millisecond
+		}
+		time.Sleep(processingTime)
 	}
-	time.Sleep(processingTime)
 
 	// Calcular risk score
 	riskScoreValue := rand.Float64() * 100
@@ -208,7 +315,8 @@ func processPayment(ctx context.Context, msgBody []byte, headers amqp.Table) {
 	logger.Info("payment_processed",
 		zap.String("service", "antifraud-service"),
 		zap.String("payment_id", paymentID),
-		zap.Float64("amount", amount),
+		zap.String("amount", amount.Decimal()),
+		zap.String("currency", amount.Currency()),
 		zap.Float64("risk_score", riskScoreValue),
 		zap.Bool("fraud_detected", isFraud),
 		zap.Duration("duration_ms", duration),
@@ -217,13 +325,24 @@ func processPayment(ctx context.Context, msgBody []byte, headers amqp.Table) {
 		zap.String("level", "info"),
 		zap.String("status", status),
 	)
+	return nil
 }
 
+// Tag do consumidor no canal, usada para cancelar o consumo no encerramento
+const consumerTag = "antifraud-service"
+
 func main() {
 	initLogger()
 	defer logger.Sync()
 
 	initTracing()
+	initChaosFromEnv()
+
+	// Métricas USE reais: CPU e RSS do processo (/proc) e runtime do Go
+	usemetrics.Start(context.Background(), logger, 5*time.Second)
+
+	// Encerramento coordenado: captura SIGTERM/SIGINT desde o início
+	shutdownManager := shutdown.NewFromEnv(logger)
 
 	rabbitURL := os.Getenv("RABBIT_URL")
 	if rabbitURL == "" {
@@ -234,41 +353,146 @@ func main() {
 	if err != nil {
 		logger.Fatal("failed_to_connect_rabbitmq", zap.Error(err))
 	}
-	defer conn.Close()
 
 	ch, err := conn.Channel()
 	if err != nil {
 		logger.Fatal("failed_to_open_channel", zap.Error(err))
 	}
-	defer ch.Close()
 
-	ch.ExchangeDeclare("payments", "fanout", true, false, false, false, nil)
-
-	q, err := ch.QueueDeclare("", false, true, true, false, nil)
+	// Fila durável compartilhada pelas réplicas, com prefetch limitado
+	queueCfg := messaging.QueueConfigFromEnv(defaultQueueName)
+	workers := workersFromEnv()
+	// O prefetch limita as mensagens em andamento e dimensiona as filas dos
+	// workers; sem ele uma conta lenta bloquearia o dispatcher de todas
+	if queueCfg.Prefetch == 0 {
+		logger.Fatal("antifraud_requires_prefetch",
+			zap.String("hint", "RABBIT_PREFETCH=0 (unlimited) is not supported by the worker pool; use a value >= ANTIFRAUD_WORKERS"),
+		)
+	}
+	q, err := messaging.DeclareQueue(ch, queueCfg)
 	if err != nil {
 		logger.Fatal("failed_to_declare_queue", zap.Error(err))
 	}
 
-	ch.QueueBind(q.Name, "", "payments", false, nil)
+	// Filas de espera com backoff exponencial e DLQ (<fila>.dlx / <fila>.dlq)
+	retryTopology, err = messaging.NewTopology(conn, logger, messaging.RetryConfigFromEnv(q.Name))
+	if err != nil {
+		logger.Fatal("failed_to_declare_retry_topology", zap.Error(err))
+	}
 
-	msgs, err := ch.Consume(q.Name, "", true, false, false, false, nil)
+	// Ack manual: a mensagem só sai da fila depois de processada (settle), e
+	// as recebidas durante o encerramento voltam para a fila
+	msgs, err := ch.Consume(q.Name, consumerTag, false, false, false, false, nil)
 	if err != nil {
 		logger.Fatal("failed_to_register_consumer", zap.Error(err))
 	}
 
-	// Expor métricas
+	// Backlog da fila e da DLQ: mensagens prontas e consumidores a cada 5s
+	monitorCtx, stopMonitor := context.WithCancel(context.Background())
+	usemetrics.MonitorQueues(monitorCtx, logger, 5*time.Second, messaging.QueueInspector(conn),
+		q.Name, retryTopology.Config().DeadLetterQueue())
+
+	// Expor métricas, /ready, /admin/lag, /admin/faults e /admin/dlq
+	http.Handle("/metrics", promhttp.Handler())
+	retryTopology.RegisterAdmin(http.DefaultServeMux)
+	http.HandleFunc("/ready", shutdownManager.HandleReady)
+	// Rotas /admin/* exigem ADMIN_TOKEN (Authorization: Bearer)
+	adminGuard := adminauth.FromEnv(logger)
+	server := &http.Server{Addr: ":8080", Handler: usemetrics.InFlight(adminGuard.Protect(http.DefaultServeMux))}
 	go func() {
-		http.Handle("/metrics", promhttp.Handler())
-		http.ListenAndServe(":8080", nil)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("metrics_server_failed", zap.Error(err))
+		}
 	}()
 
 	logger.Info("antifraud-service ready",
 		zap.String("service", "antifraud-service"),
 		zap.String("version", "1.0.0"),
+		zap.String("queue", q.Name),
+		zap.Int("prefetch", queueCfg.Prefetch),
+		zap.Int("workers", workers),
+		zap.Int("max_attempts", retryTopology.Config().MaxAttempts),
 	)
-
-	for msg := range msgs {
-		ctx, _ := extractTraceContext(msg.Headers)
-		processPayment(ctx, msg.Body, msg.Headers)
+	if queueCfg.Prefetch < workers {
+		logger.Warn("prefetch_below_worker_count",
+			zap.Int("prefetch", queueCfg.Prefetch),
+			zap.Int("workers", workers),
+		)
 	}
+
+	// consuming vira false logo antes do basic.cancel: o que ainda estiver no
+	// buffer do canal ou nas filas dos workers volta para a fila sem ser
+	// processado
+	var consuming atomic.Bool
+	consuming.Store(true)
+	pool := newWorkerPool(workers, queueCfg.Prefetch, func(msg amqp.Delivery) {
+		if !consuming.Load() {
+			msg.Nack(false, true)
+			return
+		}
+		ctx := messaging.ExtractTraceContext(context.Background(), msg.Headers)
+		settle(msg, processPayment(ctx, msg))
+	})
+	pool.MonitorUtilization(monitorCtx, 5*time.Second)
+
+	consumerDone := make(chan struct{})
+	go func() {
+		defer close(consumerDone)
+		// Canal fechado pelo broker (fora do encerramento): sem consumidor,
+		// o processo encerra para ser reiniciado
+		defer func() {
+			if !shutdownManager.Draining() {
+				logger.Error("rabbitmq_consumer_closed")
+				shutdownManager.Trigger("consumer closed")
+			}
+		}()
+		// Espera os workers terminarem as mensagens em andamento
+		defer pool.Close()
+		for msg := range msgs {
+			if !consuming.Load() {
+				msg.Nack(false, true)
+				continue
+			}
+			pool.Dispatch(msg)
+		}
+	}()
+
+	// SIGTERM/SIGINT: /ready passa a responder 503, o consumidor para de
+	// receber, as mensagens em andamento nos workers terminam (as já
+	// entregues e não iniciadas voltam para a fila) e só então o AMQP é fechado. Mensagens
+	// sem ack quando o prazo acaba são devolvidas pelo broker ao fechar o canal
+	reason := shutdownManager.Wait()
+	shutdownManager.Shutdown(reason,
+		shutdown.Step{Name: "amqp-consumer", Fn: func(ctx context.Context) error {
+			select {
+			case <-consumerDone:
+				return nil // canal já fechado pelo broker
+			default:
+			}
+			consuming.Store(false)
+			if err := ch.Cancel(consumerTag, false); err != nil {
+				return err
+			}
+			select {
+			case <-consumerDone:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}},
+		shutdown.Step{Name: "http", Fn: server.Shutdown},
+		shutdown.Step{Name: "scenario", Fn: shutdown.Func(func() { scenarioRunner.Stop() })},
+		shutdown.Step{Name: "amqp-connection", Fn: func(ctx context.Context) error {
+			stopMonitor()
+			retryTopology.Close()
+			ch.Close()
+			return conn.Close()
+		}},
+		shutdown.Step{Name: "tracer", Fn: func(ctx context.Context) error {
+			if tracerProvider == nil {
+				return nil
+			}
+			return tracerProvider.Shutdown(ctx)
+		}},
+	)
 }
@@ -0,0 +1,28 @@
+package main
+
+import (
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"shared/messaging"
+)
+
+// ============================================================================
+// CONFIRMAÇÃO DAS MENSAGENS (fila declarada por messaging.DeclareQueue)
+// ============================================================================
+
+// Padrão de RABBIT_QUEUE
+const defaultQueueName = "antifraud.payments"
+
+// Motivo da DLQ para eventos com corpo inválido: nenhuma nova tentativa
+// resolve, então vão direto para a DLQ
+const reasonMalformedEvent = "malformed_event"
+
+// Novas tentativas com backoff e DLQ da fila do serviço
+var retryTopology *messaging.Topology
+
+// settle confirma a mensagem conforme o resultado do processamento: ack no
+// sucesso, nova tentativa com backoff nas falhas e DLQ para eventos inválidos
+// ou tentativas esgotadas (veja messaging.Topology.Settle)
+func settle(msg amqp.Delivery, err error) {
+	messageAcks.WithLabelValues(retryTopology.Settle(msg, err)).Inc()
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ============================================================================
+// POOL DE WORKERS (ordem por conta via hash do accountId)
+// ============================================================================
+
+// Padrão de ANTIFRAUD_WORKERS
+const defaultWorkers = 8
+
+// workersFromEnv lê ANTIFRAUD_WORKERS (padrão 8)
+func workersFromEnv() int {
+	if v, err := strconv.Atoi(os.Getenv("ANTIFRAUD_WORKERS")); err == nil && v > 0 {
+		return v
+	}
+	return defaultWorkers
+}
+
+// workerPool processa as mensagens em um número fixo de workers. Todas as
+// mensagens de uma conta vão para o mesmo worker (hash do accountId), então
+// os eventos de uma conta são analisados na ordem de entrega. O total em
+// andamento é limitado pelo prefetch: com todos os workers ocupados as
+// mensagens sem ack chegam ao limite e o broker para de entregar.
+//
+// A ordem vale apenas para a primeira entrega: uma mensagem enviada para
+// nova tentativa (<fila>.retry.*) volta depois do backoff, atrás das
+// mensagens seguintes da mesma conta, que não esperam por ela
+type workerPool struct {
+	queues []chan amqp.Delivery
+	handle func(amqp.Delivery)
+	wg     sync.WaitGroup
+	busyNs atomic.Int64 // tempo ocupado acumulado de todos os workers
+}
+
+// newWorkerPool inicia size workers, cada um com fila de buffer mensagens
+// (o prefetch do canal, para que o dispatcher não bloqueie mesmo com todas
+// as mensagens entregues na mesma conta). buffer deve ser positivo: com
+// filas sem buffer uma conta lenta bloquearia o dispatcher de todas
+func newWorkerPool(size, buffer int, handle func(amqp.Delivery)) *workerPool {
+	if buffer < 1 {
+		buffer = 1
+	}
+	p := &workerPool{
+		queues: make([]chan amqp.Delivery, size),
+		handle: handle,
+	}
+	antifraudWorkers.Set(float64(size))
+	for i := range p.queues {
+		p.queues[i] = make(chan amqp.Delivery, buffer)
+		p.wg.Add(1)
+		go p.run(p.queues[i])
+	}
+	return p
+}
+
+func (p *workerPool) run(queue chan amqp.Delivery) {
+	defer p.wg.Done()
+	for msg := range queue {
+		antifraudWorkerQueued.Dec()
+		antifraudWorkersBusy.Inc()
+		start := time.Now()
+		p.handle(msg)
+		p.busyNs.Add(int64(time.Since(start)))
+		antifraudWorkersBusy.Dec()
+	}
+}
+
+// Dispatch envia a mensagem ao worker da conta; como o buffer de cada fila
+// é o prefetch, só bloqueia se o broker entregar além dele
+func (p *workerPool) Dispatch(msg amqp.Delivery) {
+	queue := p.queues[partition(msg.Body, len(p.queues))]
+	antifraudWorkerQueued.Inc()
+	queue <- msg
+}
+
+// Close para de aceitar mensagens e espera os workers esvaziarem as filas
+func (p *workerPool) Close() {
+	for _, queue := range p.queues {
+		close(queue)
+	}
+	p.wg.Wait()
+}
+
+// MonitorUtilization publica a fração do tempo em que os workers estiveram
+// ocupados na última janela (antifraud_worker_utilization_ratio)
+func (p *workerPool) MonitorUtilization(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		lastBusy, lastAt := p.busyNs.Load(), time.Now()
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+			busy, now := p.busyNs.Load(), time.Now()
+			capacity := float64(now.Sub(lastAt)) * float64(len(p.queues))
+			ratio := float64(busy-lastBusy) / capacity
+			if ratio > 1 {
+				// Mensagens longas somam o tempo todo na janela em que terminam
+				ratio = 1
+			}
+			antifraudWorkerUtilization.Set(ratio)
+			lastBusy, lastAt = busy, now
+		}
+	}()
+}
+
+// partition escolhe o worker pelo hash do accountId do evento. Corpos sem
+// accountId (ex: JSON inválido, que vai para a DLQ) ficam no worker 0
+func partition(body []byte, workers int) int {
+	var key struct {
+		AccountID string `json:"accountId"`
+	}
+	if json.Unmarshal(body, &key) != nil || key.AccountID == "" {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key.AccountID))
+	return int(h.Sum32() % uint32(workers))
+}
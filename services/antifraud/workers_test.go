@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestPartition(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want int // -1 = qualquer worker válido
+	}{
+		{"invalid JSON", `{"accountId":`, 0},
+		{"missing accountId", `{"paymentId":"pay-1"}`, 0},
+		{"empty accountId", `{"accountId":""}`, 0},
+		{"valid accountId", `{"accountId":"acc-1","paymentId":"pay-1"}`, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := partition([]byte(tt.body), 8)
+			if got < 0 || got >= 8 || (tt.want >= 0 && got != tt.want) {
+				t.Fatalf("partition = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	// Mesma conta, mesmo worker, independente dos demais campos
+	a := partition([]byte(`{"accountId":"acc-42","paymentId":"pay-1"}`), 8)
+	b := partition([]byte(`{"paymentId":"pay-2","status":"APPROVED","accountId":"acc-42"}`), 8)
+	if a != b {
+		t.Fatalf("same account on workers %d and %d", a, b)
+	}
+
+	// As contas se espalham pelos workers
+	used := make(map[int]bool)
+	for i := 0; i < 100; i++ {
+		used[partition([]byte(fmt.Sprintf(`{"accountId":"acc-%d"}`, i)), 8)] = true
+	}
+	if len(used) < 4 {
+		t.Fatalf("100 accounts used only %d of 8 workers", len(used))
+	}
+}
+
+func TestWorkerPoolKeepsAccountOrder(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		seen = make(map[string][]int)
+	)
+	pool := newWorkerPool(4, 16, func(msg amqp.Delivery) {
+		var event struct {
+			AccountID string `json:"accountId"`
+			Seq       int    `json:"seq"`
+		}
+		if err := json.Unmarshal(msg.Body, &event); err != nil {
+			t.Error(err)
+			return
+		}
+		// Uma conta lenta não pode ser ultrapassada pelas próprias mensagens
+		if event.AccountID == "acc-slow" {
+			time.Sleep(time.Millisecond)
+		}
+		mu.Lock()
+		seen[event.AccountID] = append(seen[event.AccountID], event.Seq)
+		mu.Unlock()
+	})
+
+	accounts := []string{"acc-slow", "acc-1", "acc-2", "acc-3", "acc-4", "acc-5"}
+	const perAccount = 10
+	for seq := 0; seq < perAccount; seq++ {
+		for _, account := range accounts {
+			pool.Dispatch(amqp.Delivery{Body: []byte(fmt.Sprintf(`{"accountId":%q,"seq":%d}`, account, seq))})
+		}
+	}
+	pool.Close()
+
+	for _, account := range accounts {
+		got := seen[account]
+		if len(got) != perAccount {
+			t.Fatalf("%s: processed %d messages, want %d", account, len(got), perAccount)
+		}
+		for i, seq := range got {
+			if seq != i {
+				t.Fatalf("%s: processed out of order: %v", account, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shared/chaos"
+)
+
+// ============================================================================
+// LAG E FALHAS INTENCIONAIS (biblioteca compartilhada shared/chaos)
+// ============================================================================
+
+const (
+	chaosStageConsume = "consume" // evento recebido da exchange "payments"
+	chaosStageSend    = "send"    // envio por um canal (email, sms, push, webhook)
+)
+
+var (
+	lagController  *chaos.LagController
+	faultInjector  *chaos.FaultInjector
+	scenarioRunner *chaos.ScenarioRunner
+)
+
+// Campos de log de lag e falhas: correlation_id e trace_id da mensagem
+func chaosOptions() chaos.Options {
+	return chaos.Options{
+		Logger: logger,
+		ContextFields: func(ctx context.Context) []zap.Field {
+			correlationID, _ := ctx.Value("correlation_id").(string)
+			traceID, _ := ctx.Value("trace_id").(string)
+			return []zap.Field{
+				zap.String("correlation_id", correlationID),
+				zap.String("trace_id", traceID),
+			}
+		},
+	}
+}
+
+// initChaosFromEnv cria o lag (desabilitado por padrão) e o injetor (padrão:
+// 5% de erro no envio, comportamento original) a partir de INTENTIONAL_LAG_*
+// e FAULT_*, carrega o cenário de SCENARIO_FILE e registra /admin/lag,
+// /admin/faults e /admin/scenario no servidor de métricas (:8080). Lag em
+// consume atrasa o consumo da fila; em send, cada canal
+func initChaosFromEnv() {
+	opts := chaosOptions()
+	lagController = chaos.NewLagController(opts,
+		chaos.Stage{Name: chaosStageConsume, Description: "notification consume", DefaultDelay: 2 * time.Second,
+			Buckets: []float64{0.1, 0.5, 1.0, 2.0, 5.0, 10.0, 30.0}},
+		chaos.Stage{Name: chaosStageSend, Description: "notification send", DefaultDelay: 1 * time.Second,
+			Buckets: []float64{0.1, 0.5, 1.0, 2.0, 5.0, 10.0}},
+	)
+	lagController.LoadEnv()
+
+	faultInjector = chaos.NewFaultInjector(opts,
+		chaos.FaultStage{Name: chaosStageConsume, Faults: []string{chaos.FaultMalformed, chaos.FaultDrop, chaos.FaultDuplicate}},
+		chaos.FaultStage{Name: chaosStageSend, Faults: []string{chaos.FaultError, chaos.FaultTimeout, chaos.FaultPanic, chaos.FaultMalformed}},
+	)
+	faultInjector.Apply(chaos.FaultConfig{
+		Enabled: true,
+		Stages:  map[string]chaos.StageFaults{chaosStageSend: {Error: 0.05}},
+	})
+	faultInjector.LoadEnv()
+
+	scenarioRunner = chaos.NewScenarioRunner(opts, lagController, faultInjector)
+	scenarioRunner.LoadEnv()
+
+	admin := &chaos.Admin{Options: opts, Lag: lagController, Faults: faultInjector, Scenario: scenarioRunner}
+	admin.Register(http.DefaultServeMux)
+}
+
+// lagTargetFromEvent monta o alvo das regras de lag: endpoints casam com o
+// tipo do evento (ex: "PaymentRefunded")
+func lagTargetFromEvent(ctx context.Context, event PaymentEvent) chaos.LagTarget {
+	correlationID, _ := ctx.Value("correlation_id").(string)
+	return chaos.LagTarget{
+		Endpoint:      event.Event,
+		AccountID:     event.AccountID,
+		Currency:      event.Amount.Currency(),
+		CorrelationID: correlationID,
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.uber.org/zap"
+)
+
+// ============================================================================
+// DISPATCHER DE NOTIFICAÇÕES (concorrência limitada por canal)
+// ============================================================================
+
+// Canais de envio de cada notificação
+var notificationChannels = []string{"email", "sms", "push", "webhook"}
+
+// Padrão de NOTIFICATION_CHANNEL_CONCURRENCY
+const defaultChannelConcurrency = 8
+
+// Resultado agregado de uma mensagem (label outcome de notification_messages_total)
+const (
+	outcomeDelivered = "delivered" // todos os canais enviados
+	outcomePartial   = "partial"   // parte dos canais falhou
+	outcomeFailed    = "failed"    // todos os canais falharam
+	outcomeSkipped   = "skipped"   // evento que não gera notificação
+	outcomeDropped   = "dropped"   // descartado por falha injetada
+	outcomeMalformed = "malformed"
+)
+
+// channelJob é um envio aguardando um sender livre do canal
+type channelJob struct {
+	ctx    context.Context
+	send   func(ctx context.Context) error
+	queued time.Time
+	result chan<- channelResult
+}
+
+type channelResult struct {
+	Channel string
+	Err     error
+}
+
+// dispatcher mantém um número fixo de senders por canal: um canal lento (ex:
+// sms com lag) só ocupa os próprios senders, e o total de goroutines não
+// depende do volume de mensagens. Com os senders ocupados, Submit bloqueia e
+// a pressão volta para o consumidor, limitado pelo prefetch
+type dispatcher struct {
+	queues map[string]chan channelJob
+	wg     sync.WaitGroup
+}
+
+// newDispatcherFromEnv lê NOTIFICATION_CHANNEL_CONCURRENCY (padrão 8) e
+// NOTIFICATION_<CANAL>_CONCURRENCY (ex: NOTIFICATION_SMS_CONCURRENCY=2)
+func newDispatcherFromEnv(channels []string) *dispatcher {
+	limit := defaultChannelConcurrency
+	if v, err := strconv.Atoi(os.Getenv("NOTIFICATION_CHANNEL_CONCURRENCY")); err == nil && v > 0 {
+		limit = v
+	}
+	d := &dispatcher{
+		queues: make(map[string]chan channelJob, len(channels)),
+	}
+	for _, channel := range channels {
+		n := limit
+		key := "NOTIFICATION_" + strings.ToUpper(channel) + "_CONCURRENCY"
+		if v, err := strconv.Atoi(os.Getenv(key)); err == nil && v > 0 {
+			n = v
+		}
+		d.queues[channel] = make(chan channelJob, n)
+		notificationChannelConcurrency.WithLabelValues(channel).Set(float64(n))
+		for i := 0; i < n; i++ {
+			d.wg.Add(1)
+			go d.run(channel, d.queues[channel])
+		}
+	}
+	return d
+}
+
+// Submit enfileira o envio no canal; o resultado chega em result. Bloqueia
+// enquanto a fila do canal estiver cheia
+func (d *dispatcher) Submit(ctx context.Context, channel string, send func(ctx context.Context) error, result chan<- channelResult) {
+	d.queues[channel] <- channelJob{ctx: ctx, send: send, queued: time.Now(), result: result}
+}
+
+func (d *dispatcher) run(channel string, queue chan channelJob) {
+	defer d.wg.Done()
+	for job := range queue {
+		notificationChannelWait.WithLabelValues(channel).Observe(time.Since(job.queued).Seconds())
+		notificationChannelBusy.WithLabelValues(channel).Inc()
+		err := d.execute(channel, job)
+		notificationChannelBusy.WithLabelValues(channel).Dec()
+		job.result <- channelResult{Channel: channel, Err: err}
+	}
+}
+
+// execute roda o envio; um pânico (injetado) vira erro do canal e não
+// derruba o sender
+func (d *dispatcher) execute(channel string, job channelJob) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("panic: %v", rec)
+			notificationErrors.WithLabelValues(channel, "panic").Inc()
+			notificationsSent.WithLabelValues(channel, "error").Inc()
+			correlationID, _ := job.ctx.Value("correlation_id").(string)
+			traceID, _ := job.ctx.Value("trace_id").(string)
+			logger.Error("panic_recovered",
+				zap.Any("panic", rec),
+				zap.String("channel", channel),
+				zap.String("correlation_id", correlationID),
+				zap.String("trace_id", traceID),
+			)
+		}
+	}()
+	return job.send(job.ctx)
+}
+
+// Close para os senders depois que as filas esvaziam; chamado quando nenhuma
+// mensagem está mais em andamento
+func (d *dispatcher) Close() {
+	for _, queue := range d.queues {
+		close(queue)
+	}
+	d.wg.Wait()
+}
+
+// Header das novas tentativas com os canais já enviados ("email,push")
+const headerDeliveredChannels = "x-delivered-channels"
+
+func deliveredChannels(headers amqp.Table) map[string]bool {
+	delivered := make(map[string]bool, len(notificationChannels))
+	v, _ := headers[headerDeliveredChannels].(string)
+	for _, channel := range strings.Split(v, ",") {
+		if channel != "" {
+			delivered[channel] = true
+		}
+	}
+	return delivered
+}
+
+// joinChannels serializa os canais na ordem de notificationChannels
+func joinChannels(delivered map[string]bool) string {
+	channels := make([]string, 0, len(delivered))
+	for _, channel := range notificationChannels {
+		if delivered[channel] {
+			channels = append(channels, channel)
+		}
+	}
+	return strings.Join(channels, ",")
+}
+
+// messageOutcome agrega os resultados dos canais de uma mensagem. Sem
+// resultados (todos os canais já enviados antes) a mensagem está entregue
+func messageOutcome(results []channelResult) (string, error) {
+	var failed []error
+	for _, r := range results {
+		if r.Err != nil {
+			failed = append(failed, fmt.Errorf("%s: %w", r.Channel, r.Err))
+		}
+	}
+	switch {
+	case len(failed) == 0:
+		return outcomeDelivered, nil
+	case len(failed) == len(results):
+		return outcomeFailed, errors.Join(failed...)
+	default:
+		return outcomePartial, errors.Join(failed...)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var errChannel = errors.New("channel unavailable")
+
+func TestMessageOutcome(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []channelResult
+		want    string
+		errs    []string // canais citados no erro
+	}{
+		{"no channels left", nil, outcomeDelivered, nil},
+		{"all delivered", []channelResult{{Channel: "email"}, {Channel: "sms"}}, outcomeDelivered, nil},
+		{"partial", []channelResult{{Channel: "email"}, {Channel: "sms", Err: errChannel}}, outcomePartial, []string{"sms"}},
+		{"all failed", []channelResult{{Channel: "push", Err: errChannel}, {Channel: "webhook", Err: errChannel}},
+			outcomeFailed, []string{"push", "webhook"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := messageOutcome(tt.results)
+			if got != tt.want {
+				t.Fatalf("outcome = %s, want %s", got, tt.want)
+			}
+			if (err != nil) != (len(tt.errs) > 0) {
+				t.Fatalf("error = %v", err)
+			}
+			if err != nil && !errors.Is(err, errChannel) {
+				t.Fatalf("error %v does not wrap the channel error", err)
+			}
+			for _, channel := range tt.errs {
+				if !strings.Contains(err.Error(), channel+": ") {
+					t.Fatalf("error %q does not name channel %s", err, channel)
+				}
+			}
+		})
+	}
+}
+
+func TestDeliveredChannels(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers amqp.Table
+		want    map[string]bool
+		joined  string
+	}{
+		{"first attempt", nil, map[string]bool{}, ""},
+		{"some delivered", amqp.Table{headerDeliveredChannels: "sms,email"},
+			map[string]bool{"email": true, "sms": true}, "email,sms"},
+		{"empty entries ignored", amqp.Table{headerDeliveredChannels: ",push,,"},
+			map[string]bool{"push": true}, "push"},
+		{"wrong header type", amqp.Table{headerDeliveredChannels: int32(1)}, map[string]bool{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := deliveredChannels(tt.headers)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("deliveredChannels = %v, want %v", got, tt.want)
+			}
+			// joinChannels segue a ordem de notificationChannels, então o
+			// header não depende da ordem de conclusão dos envios
+			if joined := joinChannels(got); joined != tt.joined {
+				t.Fatalf("joinChannels = %q, want %q", joined, tt.joined)
+			}
+		})
+	}
+}
+
+func TestJoinChannelsIgnoresUnknown(t *testing.T) {
+	delivered := map[string]bool{"webhook": true, "fax": true, "email": true, "sms": false}
+	if got := joinChannels(delivered); got != "email,webhook" {
+		t.Fatalf("joinChannels = %q, want %q", got, "email,webhook")
+	}
+}
@@ -3,10 +3,13 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/rand"
 	"net/http"
 	"os"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -15,6 +18,7 @@ import (
 	amqp "github.com/rabbitmq/amqp091-go"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/exporters/jaeger"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
@@ -22,11 +26,22 @@ import (
 	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
 	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+
+	"shared/adminauth"
+	"shared/chaos"
+	"shared/messaging"
+	"shared/money"
+	"shared/shutdown"
+	"shared/usemetrics"
 )
 
 var (
 	logger *zap.Logger
 	tracer trace.Tracer
+	// Senders por canal; as mensagens em andamento são limitadas pelo prefetch
+	notificationDispatcher *dispatcher
+	// nil com o tracing desabilitado; Shutdown envia os spans pendentes do batcher
+	tracerProvider *tracesdk.TracerProvider
 
 	// Métricas RED
 	notificationsSent = promauto.NewCounterVec(
@@ -55,6 +70,59 @@ var (
 		[]string{"channel"},
 	)
 
+	// Confirmação das mensagens: ack, retry, dead_letter ou requeue
+	messageAcks = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "notification_message_acks_total",
+			Help: "Consumed messages by acknowledgement outcome (ack, retry, dead_letter, requeue)",
+		},
+		[]string{"outcome"},
+	)
+
+	// Resultado agregado por mensagem: delivered, partial, failed, skipped,
+	// dropped ou malformed
+	notificationMessages = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "notification_messages_total",
+			Help: "Consumed messages by aggregated outcome across all channels",
+		},
+		[]string{"outcome"},
+	)
+
+	// Dispatcher (USE): limite, senders ocupados e espera por canal, e
+	// mensagens em andamento
+	notificationChannelConcurrency = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "notification_channel_concurrency_limit",
+			Help: "Concurrent senders allowed per notification channel",
+		},
+		[]string{"channel"},
+	)
+
+	notificationChannelBusy = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "notification_channel_in_flight",
+			Help: "Notifications currently being sent per channel",
+		},
+		[]string{"channel"},
+	)
+
+	notificationChannelWait = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "notification_channel_queue_wait_seconds",
+			Help:    "Time a notification waited for a free sender of its channel",
+			Buckets: []float64{0.001, 0.01, 0.05, 0.1, 0.25, 0.5, 1.0, 2.5, 5.0},
+		},
+		[]string{"channel"},
+	)
+
+	notificationMessagesInFlight = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "notification_messages_in_flight",
+			Help: "Consumed messages currently being processed",
+		},
+	)
+
 	// Métricas de erro
 	notificationErrors = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -65,6 +133,17 @@ var (
 	)
 )
 
+// PaymentEvent contém os campos do evento da exchange "payments" usados aqui;
+// os valores chegam como money.Money (unidades menores + moeda), sem float64
+type PaymentEvent struct {
+	Event        string       `json:"event"`
+	PaymentID    string       `json:"paymentId"`
+	AccountID    string       `json:"accountId"`
+	Amount       money.Money  `json:"amount"`
+	RefundAmount *money.Money `json:"refundAmount,omitempty"`
+	TS           int64        `json:"ts"`
+}
+
 func initTracing() {
 	jaegerEndpoint := os.Getenv("JAEGER_ENDPOINT")
 
@@ -104,6 +183,7 @@ func initTracing() {
 		propagation.Baggage{},
 	))
 
+	tracerProvider = tp
 	tracer = otel.Tracer("notification-service")
 }
 
@@ -115,49 +195,46 @@ func initLogger() {
 	}
 }
 
-func extractTraceContext(headers amqp.Table) context.Context {
-	ctx := context.Background()
-	propagator := otel.GetTextMapPropagator()
-
-	carrier := make(map[string]string)
-	if headers != nil {
-		if traceID, ok := headers["X-Trace-ID"].(string); ok {
-			carrier["traceparent"] = traceID
-		}
-		if correlationID, ok := headers["X-Correlation-ID"].(string); ok {
-			carrier["baggage-correlation-id"] = correlationID
-		}
-	}
-
-	ctx = propagator.Extract(ctx, propagation.MapCarrier(carrier))
-	return ctx
-}
-
-func sendNotification(ctx context.Context, channel string, paymentID string, amount float64, correlationID, traceID string) error {
+func sendNotification(ctx context.Context, channel, notificationType string, paymentID string, amount money.Money, correlationID, traceID string) error {
 	start := time.Now()
-	ctx, span := tracer.Start(ctx, fmt.Sprintf("notification.send.%s", channel))
+	// Span client: a chamada ao provedor do canal, filho do notification.process
+	ctx, span := tracer.Start(ctx, fmt.Sprintf("notification.send.%s", channel),
+		trace.WithSpanKind(trace.SpanKindClient))
 	defer span.End()
 
-	span.SetAttributes(attribute.String("notification.channel", channel))
-
-	// Simular envio de notificação (I/O bound)
-	// Simular latência variável com cauda longa
-	baseDelay := 50 * time.Millisecond
-	if rand.Float64() < 0.02 { // 2% tem latência muito alta
-		baseDelay += 1 * time.Second
-		span.RecordError(fmt.Errorf("slow notification: %v", baseDelay))
-	}
-	time.Sleep(baseDelay)
+	span.SetAttributes(
+		attribute.String("notification.channel", channel),
+		attribute.String("notification.type", notificationType),
+	)
 
-	// Simular 5% de falha
-	if rand.Float64() < 0.05 {
-		err := fmt.Errorf("notification service unavailable")
-		span.RecordError(err)
-		notificationErrors.WithLabelValues(channel, "service_unavailable").Inc()
+	// Falhas injetadas (padrão: 5% de erro no envio)
+	if fault, err := faultInjector.Inject(ctx, chaosStageSend, zap.String("channel", channel)); err != nil {
+		errorType := "service_unavailable"
+		switch fault {
+		case chaos.FaultTimeout:
+			errorType = "timeout"
+		case chaos.FaultMalformed:
+			errorType = "malformed_response"
+		}
+		notificationErrors.WithLabelValues(channel, errorType).Inc()
 		notificationsSent.WithLabelValues(channel, "error").Inc()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, errorType)
 		return err
 	}
 
+	// Lag intencional tem prioridade sobre a latência simulada
+	if _, ok := lagController.Inject(ctx, chaosStageSend, zap.String("channel", channel)); !ok {
+		// Simular envio de notificação (I/O bound)
+		// Simular latência variável com cauda longa
+		baseDelay := 50 * time.Millisecond
+		if rand.Float64() < 0.02 { // 2% tem latência muito alta
+			baseDelay += 1 * time.Second
+			span.RecordError(fmt.Errorf("slow notification: %v", baseDelay))
+		}
+		time.Sleep(baseDelay)
+	}
+
 	duration := time.Since(start)
 	notificationDuration.WithLabelValues(channel).Observe(duration.Seconds())
 	notificationDurationPercentiles.WithLabelValues(channel).(prometheus.Summary).Observe(duration.Seconds())
@@ -166,8 +243,10 @@ func sendNotification(ctx context.Context, channel string, paymentID string, amo
 	logger.Info("notification_sent",
 		zap.String("service", "notification-service"),
 		zap.String("channel", channel),
+		zap.String("notification_type", notificationType),
 		zap.String("payment_id", paymentID),
-		zap.Float64("amount", amount),
+		zap.String("amount", amount.Decimal()),
+		zap.String("currency", amount.Currency()),
 		zap.Duration("duration_ms", duration),
 		zap.String("correlation_id", correlationID),
 		zap.String("trace_id", traceID),
@@ -178,48 +257,155 @@ func sendNotification(ctx context.Context, channel string, paymentID string, amo
 	return nil
 }
 
-func processPayment(ctx context.Context, msgBody []byte, headers amqp.Table) {
-	correlationID := ""
-	traceID := ""
-	if headers != nil {
-		if cid, ok := headers["X-Correlation-ID"].(string); ok {
-			correlationID = cid
-		}
-		if tid, ok := headers["X-Trace-ID"].(string); ok {
-			traceID = tid
-		}
-	}
-
-	ctx, span := tracer.Start(ctx, "notification.process")
+// processPayment envia as notificações de um evento da exchange "payments" e
+// só retorna quando todos os canais terminam. O erro retornado decide a
+// confirmação da mensagem (veja settle)
+func processPayment(ctx context.Context, msg amqp.Delivery) error {
+	start := time.Now()
+	// Span consumer filho do producer do payment (traceparent nos headers)
+	ctx, span := tracer.Start(ctx, "notification.process",
+		messaging.ConsumeSpanOptions(retryTopology.Config().Queue, msg)...)
 	defer span.End()
 
-	var event map[string]interface{}
+	correlationID := messaging.CorrelationID(ctx, msg.Headers)
+	traceID := span.SpanContext().TraceID().String()
+	ctx = context.WithValue(ctx, "correlation_id", correlationID)
+	ctx = context.WithValue(ctx, "trace_id", traceID)
+	msgBody := msg.Body
+
+	// Falhas injetadas no consumo: evento perdido, corrompido ou duplicado
+	fault, _ := faultInjector.Inject(ctx, chaosStageConsume)
+	switch fault {
+	case chaos.FaultDrop:
+		notificationMessages.WithLabelValues(outcomeDropped).Inc()
+		return nil
+	case chaos.FaultMalformed:
+		msgBody = msgBody[:len(msgBody)/2]
+	}
+
+	var event PaymentEvent
 	if err := json.Unmarshal(msgBody, &event); err != nil {
 		logger.Error("failed_to_unmarshal",
 			zap.Error(err),
 			zap.String("correlation_id", correlationID),
 			zap.String("trace_id", traceID),
 		)
-		return
+		notificationMessages.WithLabelValues(outcomeMalformed).Inc()
+		return messaging.Permanent(reasonMalformedEvent, fmt.Errorf("unmarshal event: %w", err))
+	}
+
+	// Atraso ponta a ponta: do registro do evento no payment até o consumo
+	usemetrics.ObserveEventAge(event.Event, event.TS)
+
+	// A exchange "payments" recebe um evento por transição de estado;
+	// apenas pagamentos novos e estornos geram notificação
+	paymentID := event.PaymentID
+	amount := event.Amount
+	var notificationType string
+	switch event.Event {
+	case "PaymentCreated":
+		notificationType = "payment_created"
+	case "PaymentRefunded":
+		notificationType = "payment_refunded"
+		if event.RefundAmount != nil {
+			amount = *event.RefundAmount
+		}
+	default:
+		notificationMessages.WithLabelValues(outcomeSkipped).Inc()
+		return nil
+	}
+	span.SetAttributes(attribute.String("notification.type", notificationType))
+
+	// Lag direcionado e lag no consumo: segura a mensagem antes do envio,
+	// ocupando uma das vagas de mensagens em andamento
+	ctx = lagController.Target(ctx, lagTargetFromEvent(ctx, event))
+	lagController.Inject(ctx, chaosStageConsume)
+
+	deliveries := 1
+	if fault == chaos.FaultDuplicate {
+		deliveries = 2
 	}
 
-	paymentID, _ := event["paymentId"].(string)
-	amount, _ := event["amount"].(float64)
+	// Canais já enviados em tentativas anteriores (header gravado na nova
+	// tentativa): não são repetidos, para o cliente não receber duplicatas
+	delivered := deliveredChannels(msg.Headers)
+	pending := make([]string, 0, len(notificationChannels))
+	for _, channel := range notificationChannels {
+		if !delivered[channel] {
+			pending = append(pending, channel)
+		}
+	}
 
-	// Enviar notificações em paralelo (simular serviço chatty)
-	channels := []string{"email", "sms", "push", "webhook"}
-	for _, channel := range channels {
-		go func(ch string) {
-			_ = sendNotification(ctx, ch, paymentID, amount, correlationID, traceID)
-		}(channel)
+	// Enviar notificações em paralelo pelo dispatcher (simular serviço
+	// chatty). Os spans de envio são filhos de notification.process, que só
+	// termina depois de todos os canais. Uma falha em qualquer canal agenda
+	// uma nova tentativa da mensagem, que reenvia apenas os canais que
+	// falharam (entrega at-least-once por canal)
+	results := make(chan channelResult, deliveries*len(pending))
+	for i := 0; i < deliveries; i++ {
+		for _, channel := range pending {
+			channel := channel
+			notificationDispatcher.Submit(ctx, channel, func(ctx context.Context) error {
+				return sendNotification(ctx, channel, notificationType, paymentID, amount, correlationID, traceID)
+			}, results)
+		}
+	}
+	channelResults := make([]channelResult, 0, cap(results))
+	for len(channelResults) < cap(results) {
+		channelResults = append(channelResults, <-results)
+	}
+
+	outcome, err := messageOutcome(channelResults)
+	failedChannels := make([]string, 0, len(channelResults))
+	for _, r := range channelResults {
+		if r.Err != nil {
+			failedChannels = append(failedChannels, r.Channel)
+		} else {
+			delivered[r.Channel] = true
+		}
+	}
+	if err != nil {
+		err = messaging.WithHeaders(err, amqp.Table{headerDeliveredChannels: joinChannels(delivered)})
 	}
+	notificationMessages.WithLabelValues(outcome).Inc()
+	span.SetAttributes(
+		attribute.String("notification.outcome", outcome),
+		attribute.Int("notification.channels", len(channelResults)),
+		attribute.Int("notification.skipped_channels", len(notificationChannels)-len(pending)),
+		attribute.StringSlice("notification.failed_channels", failedChannels),
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, outcome)
+	}
+	logger.Info("notification_message_completed",
+		zap.String("service", "notification-service"),
+		zap.String("payment_id", paymentID),
+		zap.String("notification_type", notificationType),
+		zap.String("outcome", outcome),
+		zap.Strings("failed_channels", failedChannels),
+		zap.Duration("duration_ms", time.Since(start)),
+		zap.String("correlation_id", correlationID),
+		zap.String("trace_id", traceID),
+	)
+	return err
 }
 
+// Tag do consumidor no canal, usada para cancelar o consumo no encerramento
+const consumerTag = "notification-service"
+
 func main() {
 	initLogger()
 	defer logger.Sync()
 
 	initTracing()
+	initChaosFromEnv()
+
+	// Métricas USE reais: CPU e RSS do processo (/proc) e runtime do Go
+	usemetrics.Start(context.Background(), logger, 5*time.Second)
+
+	// Encerramento coordenado: captura SIGTERM/SIGINT desde o início
+	shutdownManager := shutdown.NewFromEnv(logger)
 
 	rabbitURL := os.Getenv("RABBIT_URL")
 	if rabbitURL == "" {
@@ -230,41 +416,143 @@ func main() {
 	if err != nil {
 		logger.Fatal("failed_to_connect_rabbitmq", zap.Error(err))
 	}
-	defer conn.Close()
 
 	ch, err := conn.Channel()
 	if err != nil {
 		logger.Fatal("failed_to_open_channel", zap.Error(err))
 	}
-	defer ch.Close()
-
-	ch.ExchangeDeclare("payments", "fanout", true, false, false, false, nil)
 
-	q, err := ch.QueueDeclare("", false, true, true, false, nil)
+	// Fila durável compartilhada pelas réplicas, com prefetch limitado
+	queueCfg := messaging.QueueConfigFromEnv(defaultQueueName)
+	q, err := messaging.DeclareQueue(ch, queueCfg)
 	if err != nil {
 		logger.Fatal("failed_to_declare_queue", zap.Error(err))
 	}
 
-	ch.QueueBind(q.Name, "", "payments", false, nil)
+	// Filas de espera com backoff exponencial e DLQ (<fila>.dlx / <fila>.dlq)
+	retryTopology, err = messaging.NewTopology(conn, logger, messaging.RetryConfigFromEnv(q.Name))
+	if err != nil {
+		logger.Fatal("failed_to_declare_retry_topology", zap.Error(err))
+	}
 
-	msgs, err := ch.Consume(q.Name, "", true, false, false, false, nil)
+	// Ack manual: a mensagem só sai da fila depois de processada (settle), e
+	// as recebidas durante o encerramento voltam para a fila
+	msgs, err := ch.Consume(q.Name, consumerTag, false, false, false, false, nil)
 	if err != nil {
 		logger.Fatal("failed_to_register_consumer", zap.Error(err))
 	}
 
-	// Expor métricas
+	// Backlog da fila e da DLQ: mensagens prontas e consumidores a cada 5s
+	monitorCtx, stopMonitor := context.WithCancel(context.Background())
+	usemetrics.MonitorQueues(monitorCtx, logger, 5*time.Second, messaging.QueueInspector(conn),
+		q.Name, retryTopology.Config().DeadLetterQueue())
+
+	// Expor métricas, /ready, /admin/lag, /admin/faults e /admin/dlq
+	http.Handle("/metrics", promhttp.Handler())
+	retryTopology.RegisterAdmin(http.DefaultServeMux)
+	http.HandleFunc("/ready", shutdownManager.HandleReady)
+	// Rotas /admin/* exigem ADMIN_TOKEN (Authorization: Bearer)
+	adminGuard := adminauth.FromEnv(logger)
+	server := &http.Server{Addr: ":8080", Handler: usemetrics.InFlight(adminGuard.Protect(http.DefaultServeMux))}
 	go func() {
-		http.Handle("/metrics", promhttp.Handler())
-		http.ListenAndServe(":8080", nil)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("metrics_server_failed", zap.Error(err))
+		}
 	}()
 
 	logger.Info("notification-service ready",
 		zap.String("service", "notification-service"),
 		zap.String("version", "1.0.0"),
+		zap.String("queue", q.Name),
+		zap.Int("prefetch", queueCfg.Prefetch),
+		zap.Int("max_attempts", retryTopology.Config().MaxAttempts),
 	)
 
-	for msg := range msgs {
-		ctx := extractTraceContext(msg.Headers)
-		processPayment(ctx, msg.Body, msg.Headers)
+	// consuming vira false logo antes do basic.cancel: o que ainda estiver no
+	// buffer do canal volta para a fila sem ser processado
+	var consuming atomic.Bool
+	consuming.Store(true)
+
+	// Mensagens processadas em paralelo até o prefetch; os envios de cada
+	// canal passam pelos senders do dispatcher
+	notificationDispatcher = newDispatcherFromEnv(notificationChannels)
+	maxInFlight := queueCfg.Prefetch
+	if maxInFlight == 0 {
+		maxInFlight = messaging.DefaultPrefetch
 	}
+	inFlight := make(chan struct{}, maxInFlight)
+	var handlers sync.WaitGroup
+
+	consumerDone := make(chan struct{})
+	go func() {
+		defer close(consumerDone)
+		// Canal fechado pelo broker (fora do encerramento): sem consumidor,
+		// o processo encerra para ser reiniciado
+		defer func() {
+			if !shutdownManager.Draining() {
+				logger.Error("rabbitmq_consumer_closed")
+				shutdownManager.Trigger("consumer closed")
+			}
+		}()
+		// Espera as mensagens em andamento e só então para os senders
+		defer notificationDispatcher.Close()
+		defer handlers.Wait()
+		for msg := range msgs {
+			if !consuming.Load() {
+				msg.Nack(false, true)
+				continue
+			}
+			inFlight <- struct{}{}
+			handlers.Add(1)
+			notificationMessagesInFlight.Inc()
+			go func(msg amqp.Delivery) {
+				defer func() {
+					notificationMessagesInFlight.Dec()
+					handlers.Done()
+					<-inFlight
+				}()
+				ctx := messaging.ExtractTraceContext(context.Background(), msg.Headers)
+				settle(msg, processPayment(ctx, msg))
+			}(msg)
+		}
+	}()
+
+	// SIGTERM/SIGINT: /ready passa a responder 503, o consumidor para de
+	// receber, as mensagens em andamento terminam (as já entregues e não
+	// iniciadas voltam para a fila) e só então o AMQP é fechado. Mensagens
+	// sem ack quando o prazo acaba são devolvidas pelo broker ao fechar o canal
+	reason := shutdownManager.Wait()
+	shutdownManager.Shutdown(reason,
+		shutdown.Step{Name: "amqp-consumer", Fn: func(ctx context.Context) error {
+			select {
+			case <-consumerDone:
+				return nil // canal já fechado pelo broker
+			default:
+			}
+			consuming.Store(false)
+			if err := ch.Cancel(consumerTag, false); err != nil {
+				return err
+			}
+			select {
+			case <-consumerDone:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}},
+		shutdown.Step{Name: "http", Fn: server.Shutdown},
+		shutdown.Step{Name: "scenario", Fn: shutdown.Func(func() { scenarioRunner.Stop() })},
+		shutdown.Step{Name: "amqp-connection", Fn: func(ctx context.Context) error {
+			stopMonitor()
+			retryTopology.Close()
+			ch.Close()
+			return conn.Close()
+		}},
+		shutdown.Step{Name: "tracer", Fn: func(ctx context.Context) error {
+			if tracerProvider == nil {
+				return nil
+			}
+			return tracerProvider.Shutdown(ctx)
+		}},
+	)
 }
@@ -0,0 +1,561 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ============================================================================
+// CIRCUIT BREAKER (um por dependência, compartilhado entre requisições)
+// ============================================================================
+
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+func (s CircuitState) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+var (
+	ErrCircuitOpen = errors.New("circuit breaker is open")
+	// Half-open: todas as chamadas de teste já foram liberadas
+	ErrCircuitProbeLimit = errors.New("circuit breaker half-open probe budget exhausted")
+	ErrBreakerNotFound   = errors.New("circuit breaker not found")
+)
+
+type CircuitBreakerConfig struct {
+	// Abre após N falhas consecutivas (0 desabilita)
+	MaxFailures int
+	// Abre quando a taxa de falhas na janela atinge o limite (0 desabilita),
+	// desde que haja ao menos MinRequests chamadas na janela
+	FailureRate float64
+	Window      time.Duration
+	MinRequests int
+	// Tempo em open antes de liberar chamadas de teste (half-open)
+	OpenTimeout time.Duration
+	// Chamadas de teste liberadas por ciclo half-open e quantas precisam
+	// ter sucesso para fechar o circuito
+	HalfOpenProbes    int
+	HalfOpenSuccesses int
+}
+
+// Durações expostas em milissegundos, como nas variáveis de ambiente
+func (c CircuitBreakerConfig) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		MaxFailures       int     `json:"maxFailures"`
+		FailureRate       float64 `json:"failureRate"`
+		WindowMs          int64   `json:"windowMs"`
+		MinRequests       int     `json:"minRequests"`
+		OpenTimeoutMs     int64   `json:"openTimeoutMs"`
+		HalfOpenProbes    int     `json:"halfOpenProbes"`
+		HalfOpenSuccesses int     `json:"halfOpenSuccesses"`
+	}{c.MaxFailures, c.FailureRate, c.Window.Milliseconds(), c.MinRequests,
+		c.OpenTimeout.Milliseconds(), c.HalfOpenProbes, c.HalfOpenSuccesses})
+}
+
+// Configuração via CIRCUIT_BREAKER_<CAMPO>, com sobrescrita por dependência
+// em CIRCUIT_BREAKER_<DEPENDENCIA>_<CAMPO> (ex: CIRCUIT_BREAKER_EXTERNAL_SERVICE_MAX_FAILURES)
+func circuitBreakerConfigFromEnv(name string) CircuitBreakerConfig {
+	cfg := CircuitBreakerConfig{
+		MaxFailures:       5,
+		FailureRate:       0.5,
+		Window:            30 * time.Second,
+		MinRequests:       20,
+		OpenTimeout:       30 * time.Second,
+		HalfOpenProbes:    3,
+		HalfOpenSuccesses: 2,
+	}
+	prefix := "CIRCUIT_BREAKER_" + strings.NewReplacer("-", "_", ".", "_").Replace(strings.ToUpper(name)) + "_"
+	lookup := func(field string) string {
+		if v := os.Getenv(prefix + field); v != "" {
+			return v
+		}
+		return os.Getenv("CIRCUIT_BREAKER_" + field)
+	}
+	envInt := func(field string, dst *int) {
+		if v, err := strconv.Atoi(lookup(field)); err == nil && v >= 0 {
+			*dst = v
+		}
+	}
+	envMillis := func(field string, dst *time.Duration) {
+		if v, err := strconv.Atoi(lookup(field)); err == nil && v > 0 {
+			*dst = time.Duration(v) * time.Millisecond
+		}
+	}
+
+	envInt("MAX_FAILURES", &cfg.MaxFailures)
+	if v, err := strconv.ParseFloat(lookup("FAILURE_RATE"), 64); err == nil && v >= 0 && v <= 1 {
+		cfg.FailureRate = v
+	}
+	envMillis("WINDOW_MS", &cfg.Window)
+	envInt("MIN_REQUESTS", &cfg.MinRequests)
+	envMillis("OPEN_TIMEOUT_MS", &cfg.OpenTimeout)
+	envInt("HALF_OPEN_PROBES", &cfg.HalfOpenProbes)
+	envInt("HALF_OPEN_SUCCESSES", &cfg.HalfOpenSuccesses)
+	return cfg
+}
+
+type CircuitStateChange func(name string, from, to CircuitState)
+
+type CircuitBreaker struct {
+	name string
+	cfg  CircuitBreakerConfig
+
+	mu     sync.Mutex
+	state  CircuitState
+	forced bool // estado fixado manualmente via admin
+	// Incrementada a cada transição: resultados de chamadas iniciadas em
+	// outro estado são ignorados
+	generation          uint64
+	consecutiveFailures int
+	window              *slidingWindow
+	openedAt            time.Time
+	lastTransitionAt    time.Time
+	halfOpenProbes      int
+	halfOpenSuccesses   int
+
+	listeners []CircuitStateChange
+	pending   []circuitTransition
+
+	// Decide quais erros contam como falha (nil = qualquer erro); os demais
+	// não contam como sucesso nem como falha
+	isFailure func(error) bool
+
+	now func() time.Time // relógio (substituído nos testes)
+}
+
+// Resultado de uma chamada para o breaker
+type callOutcome int
+
+const (
+	outcomeSuccess callOutcome = iota
+	outcomeFailure
+	// Erro que não diz nada sobre a dependência (ex: cliente desconectou)
+	outcomeIgnored
+)
+
+type circuitTransition struct {
+	from, to CircuitState
+}
+
+func NewCircuitBreaker(name string, cfg CircuitBreakerConfig) *CircuitBreaker {
+	if cfg.HalfOpenProbes < 1 {
+		cfg.HalfOpenProbes = 1
+	}
+	if cfg.HalfOpenSuccesses < 1 || cfg.HalfOpenSuccesses > cfg.HalfOpenProbes {
+		cfg.HalfOpenSuccesses = cfg.HalfOpenProbes
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = 30 * time.Second
+	}
+	return &CircuitBreaker{
+		name:             name,
+		cfg:              cfg,
+		state:            CircuitClosed,
+		window:           newSlidingWindow(cfg.Window, 10),
+		lastTransitionAt: time.Now(),
+		now:              time.Now,
+	}
+}
+
+// OnStateChange registra um callback chamado (fora do lock) a cada transição
+func (cb *CircuitBreaker) OnStateChange(fn CircuitStateChange) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.listeners = append(cb.listeners, fn)
+}
+
+// SetFailureFilter restringe as falhas contabilizadas aos erros para os
+// quais isFailure retorna true
+func (cb *CircuitBreaker) SetFailureFilter(isFailure func(error) bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.isFailure = isFailure
+}
+
+// Call executa fn se o circuito permitir e contabiliza o resultado. Um
+// pânico em fn conta como falha (devolvendo a vaga de teste do half-open)
+// e é propagado em seguida
+func (cb *CircuitBreaker) Call(fn func() error) (err error) {
+	generation, err := cb.before()
+	if err != nil {
+		circuitBreakerRejected.WithLabelValues(cb.name).Inc()
+		return err
+	}
+	outcome := outcomeFailure
+	defer func() {
+		if p := recover(); p != nil {
+			cb.after(generation, outcomeFailure)
+			panic(p)
+		}
+		cb.after(generation, outcome)
+	}()
+	err = fn()
+	outcome = cb.classify(err)
+	return err
+}
+
+func (cb *CircuitBreaker) classify(err error) callOutcome {
+	if err == nil {
+		return outcomeSuccess
+	}
+	cb.mu.Lock()
+	isFailure := cb.isFailure
+	cb.mu.Unlock()
+	if isFailure == nil || isFailure(err) {
+		return outcomeFailure
+	}
+	return outcomeIgnored
+}
+
+func (cb *CircuitBreaker) before() (uint64, error) {
+	cb.mu.Lock()
+	defer cb.unlockAndNotify()
+
+	switch cb.state {
+	case CircuitOpen:
+		if cb.forced || cb.now().Sub(cb.openedAt) < cb.cfg.OpenTimeout {
+			return 0, fmt.Errorf("%w: %s", ErrCircuitOpen, cb.name)
+		}
+		cb.setState(CircuitHalfOpen)
+		fallthrough
+	case CircuitHalfOpen:
+		if cb.halfOpenProbes >= cb.cfg.HalfOpenProbes {
+			return 0, fmt.Errorf("%w: %s", ErrCircuitProbeLimit, cb.name)
+		}
+		cb.halfOpenProbes++
+	}
+	return cb.generation, nil
+}
+
+func (cb *CircuitBreaker) after(generation uint64, outcome callOutcome) {
+	cb.mu.Lock()
+	defer cb.unlockAndNotify()
+
+	if generation != cb.generation || cb.forced {
+		return
+	}
+	if outcome == outcomeIgnored {
+		// Devolve a vaga de teste: a chamada não testou a dependência
+		if cb.state == CircuitHalfOpen {
+			cb.halfOpenProbes--
+		}
+		return
+	}
+	success := outcome == outcomeSuccess
+
+	switch cb.state {
+	case CircuitClosed:
+		cb.window.add(cb.now(), success)
+		if success {
+			cb.consecutiveFailures = 0
+			return
+		}
+		cb.consecutiveFailures++
+		if cb.shouldTrip() {
+			cb.setState(CircuitOpen)
+		}
+	case CircuitHalfOpen:
+		if !success {
+			cb.setState(CircuitOpen)
+			return
+		}
+		cb.halfOpenSuccesses++
+		if cb.halfOpenSuccesses >= cb.cfg.HalfOpenSuccesses {
+			cb.setState(CircuitClosed)
+		}
+	}
+}
+
+func (cb *CircuitBreaker) shouldTrip() bool {
+	if cb.cfg.MaxFailures > 0 && cb.consecutiveFailures >= cb.cfg.MaxFailures {
+		return true
+	}
+	if cb.cfg.FailureRate > 0 {
+		total, failures := cb.window.counts(cb.now())
+		if total >= cb.cfg.MinRequests && total > 0 && float64(failures)/float64(total) >= cb.cfg.FailureRate {
+			return true
+		}
+	}
+	return false
+}
+
+// setState aplica a transição e enfileira a notificação; deve ser chamada
+// com cb.mu travado
+func (cb *CircuitBreaker) setState(to CircuitState) {
+	from := cb.state
+	if from == to {
+		return
+	}
+	now := cb.now()
+	cb.state = to
+	cb.generation++
+	cb.lastTransitionAt = now
+	cb.halfOpenProbes = 0
+	cb.halfOpenSuccesses = 0
+
+	switch to {
+	case CircuitOpen:
+		cb.openedAt = now
+	case CircuitClosed:
+		cb.consecutiveFailures = 0
+		cb.window.reset()
+	}
+	cb.pending = append(cb.pending, circuitTransition{from: from, to: to})
+}
+
+// unlockAndNotify libera o lock e só então chama os callbacks, que podem
+// consultar o próprio breaker
+func (cb *CircuitBreaker) unlockAndNotify() {
+	pending := cb.pending
+	cb.pending = nil
+	listeners := cb.listeners
+	cb.mu.Unlock()
+
+	for _, t := range pending {
+		for _, fn := range listeners {
+			fn(cb.name, t.from, t.to)
+		}
+	}
+}
+
+// ForceOpen mantém o circuito aberto até Reset
+func (cb *CircuitBreaker) ForceOpen() {
+	cb.mu.Lock()
+	defer cb.unlockAndNotify()
+	cb.forced = true
+	cb.setState(CircuitOpen)
+}
+
+// ForceClose mantém o circuito fechado, ignorando falhas, até Reset
+func (cb *CircuitBreaker) ForceClose() {
+	cb.mu.Lock()
+	defer cb.unlockAndNotify()
+	cb.forced = true
+	cb.setState(CircuitClosed)
+}
+
+// Reset volta ao controle automático a partir do estado fechado
+func (cb *CircuitBreaker) Reset() {
+	cb.mu.Lock()
+	defer cb.unlockAndNotify()
+	cb.forced = false
+	cb.setState(CircuitClosed)
+	cb.consecutiveFailures = 0
+	cb.window.reset()
+}
+
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state
+}
+
+type CircuitBreakerSnapshot struct {
+	Name                string               `json:"name"`
+	State               CircuitState         `json:"state"`
+	Forced              bool                 `json:"forced"`
+	ConsecutiveFailures int                  `json:"consecutiveFailures"`
+	WindowRequests      int                  `json:"windowRequests"`
+	WindowFailures      int                  `json:"windowFailures"`
+	WindowFailureRate   float64              `json:"windowFailureRate"`
+	HalfOpenProbes      int                  `json:"halfOpenProbes,omitempty"`
+	HalfOpenSuccesses   int                  `json:"halfOpenSuccesses,omitempty"`
+	OpenedAt            *time.Time           `json:"openedAt,omitempty"`
+	LastTransitionAt    time.Time            `json:"lastTransitionAt"`
+	Config              CircuitBreakerConfig `json:"config"`
+}
+
+func (cb *CircuitBreaker) Snapshot() CircuitBreakerSnapshot {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	total, failures := cb.window.counts(cb.now())
+	snap := CircuitBreakerSnapshot{
+		Name:                cb.name,
+		State:               cb.state,
+		Forced:              cb.forced,
+		ConsecutiveFailures: cb.consecutiveFailures,
+		WindowRequests:      total,
+		WindowFailures:      failures,
+		HalfOpenProbes:      cb.halfOpenProbes,
+		HalfOpenSuccesses:   cb.halfOpenSuccesses,
+		LastTransitionAt:    cb.lastTransitionAt,
+		Config:              cb.cfg,
+	}
+	if total > 0 {
+		snap.WindowFailureRate = float64(failures) / float64(total)
+	}
+	if cb.state == CircuitOpen {
+		openedAt := cb.openedAt
+		snap.OpenedAt = &openedAt
+	}
+	return snap
+}
+
+// ----------------------------------------------------------------------------
+// Janela deslizante de resultados (buckets por fração da janela)
+// ----------------------------------------------------------------------------
+
+type windowBucket struct {
+	epoch     int64
+	successes int
+	failures  int
+}
+
+type slidingWindow struct {
+	bucketSize time.Duration
+	buckets    []windowBucket
+}
+
+func newSlidingWindow(size time.Duration, buckets int) *slidingWindow {
+	return &slidingWindow{
+		bucketSize: size / time.Duration(buckets),
+		buckets:    make([]windowBucket, buckets),
+	}
+}
+
+func (w *slidingWindow) add(now time.Time, success bool) {
+	epoch := now.UnixNano() / int64(w.bucketSize)
+	b := &w.buckets[epoch%int64(len(w.buckets))]
+	if b.epoch != epoch {
+		*b = windowBucket{epoch: epoch}
+	}
+	if success {
+		b.successes++
+	} else {
+		b.failures++
+	}
+}
+
+func (w *slidingWindow) counts(now time.Time) (total, failures int) {
+	epoch := now.UnixNano() / int64(w.bucketSize)
+	for _, b := range w.buckets {
+		if epoch-b.epoch < int64(len(w.buckets)) {
+			total += b.successes + b.failures
+			failures += b.failures
+		}
+	}
+	return total, failures
+}
+
+func (w *slidingWindow) reset() {
+	for i := range w.buckets {
+		w.buckets[i] = windowBucket{}
+	}
+}
+
+// ----------------------------------------------------------------------------
+// Registro de breakers por dependência
+// ----------------------------------------------------------------------------
+
+type CircuitBreakerRegistry struct {
+	mu       sync.RWMutex
+	breakers map[string]*CircuitBreaker
+}
+
+var circuitBreakers = &CircuitBreakerRegistry{breakers: make(map[string]*CircuitBreaker)}
+
+// Register cria o breaker da dependência com a configuração do ambiente e
+// liga o gauge circuit_breaker_state às transições
+func (r *CircuitBreakerRegistry) Register(name string) *CircuitBreaker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cb, ok := r.breakers[name]; ok {
+		return cb
+	}
+
+	cb := NewCircuitBreaker(name, circuitBreakerConfigFromEnv(name))
+	cb.OnStateChange(func(name string, from, to CircuitState) {
+		circuitBreakerState.WithLabelValues(name).Set(float64(to))
+		circuitBreakerTransitions.WithLabelValues(name, from.String(), to.String()).Inc()
+		logger.Warn("circuit_breaker_state_changed",
+			zap.String("service", name),
+			zap.String("from", from.String()),
+			zap.String("to", to.String()),
+		)
+	})
+	circuitBreakerState.WithLabelValues(name).Set(float64(CircuitClosed))
+	r.breakers[name] = cb
+	return cb
+}
+
+func (r *CircuitBreakerRegistry) Get(name string) (*CircuitBreaker, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	cb, ok := r.breakers[name]
+	return cb, ok
+}
+
+func (r *CircuitBreakerRegistry) Snapshots() []CircuitBreakerSnapshot {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	snaps := make([]CircuitBreakerSnapshot, 0, len(r.breakers))
+	for _, cb := range r.breakers {
+		snaps = append(snaps, cb.Snapshot())
+	}
+	sort.Slice(snaps, func(i, j int) bool { return snaps[i].Name < snaps[j].Name })
+	return snaps
+}
+
+// ----------------------------------------------------------------------------
+// Admin: consulta e controle manual
+// ----------------------------------------------------------------------------
+
+type BreakerListResponse struct {
+	Items []CircuitBreakerSnapshot `json:"items"`
+}
+
+// GET /admin/breakers
+func handleListBreakers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(BreakerListResponse{Items: circuitBreakers.Snapshots()})
+}
+
+// POST /admin/breakers/{name}/force-open | force-close | reset
+func handleBreakerControl(action string, apply func(cb *CircuitBreaker)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		cb, ok := circuitBreakers.Get(name)
+		if !ok {
+			writeProblem(w, r, newProblem(http.StatusNotFound, CodeBreakerNotFound,
+				fmt.Sprintf("%v: %s", ErrBreakerNotFound, name)))
+			return
+		}
+		apply(cb)
+
+		correlationID, _ := r.Context().Value("correlation_id").(string)
+		logger.Warn("circuit_breaker_manual_override",
+			zap.String("service", name),
+			zap.String("action", action),
+			zap.String("correlation_id", correlationID),
+		)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(cb.Snapshot())
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"shared/chaos"
+)
+
+var errDependency = errors.New("dependency failed")
+
+// testClock é um relógio manual: o breaker só muda de estado por tempo
+// quando o teste avança o relógio, sem depender de time.Sleep
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newTestBreaker(cfg CircuitBreakerConfig) (*CircuitBreaker, *testClock) {
+	clock := &testClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	cb := NewCircuitBreaker("test", cfg)
+	cb.now = clock.Now
+	return cb, clock
+}
+
+func callN(cb *CircuitBreaker, n int, err error) {
+	for i := 0; i < n; i++ {
+		cb.Call(func() error { return err })
+	}
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	cfg := CircuitBreakerConfig{
+		MaxFailures:       3,
+		Window:            time.Minute,
+		OpenTimeout:       time.Minute,
+		HalfOpenProbes:    2,
+		HalfOpenSuccesses: 2,
+	}
+	tests := []struct {
+		name string
+		run  func(cb *CircuitBreaker, clock *testClock) error
+		want CircuitState
+		err  error
+	}{
+		{"stays closed below MaxFailures", func(cb *CircuitBreaker, clock *testClock) error {
+			callN(cb, 2, errDependency)
+			return cb.Call(func() error { return nil })
+		}, CircuitClosed, nil},
+		{"success resets consecutive failures", func(cb *CircuitBreaker, clock *testClock) error {
+			callN(cb, 2, errDependency)
+			callN(cb, 1, nil)
+			callN(cb, 2, errDependency)
+			return nil
+		}, CircuitClosed, nil},
+		{"opens after MaxFailures", func(cb *CircuitBreaker, clock *testClock) error {
+			callN(cb, 3, errDependency)
+			return cb.Call(func() error { return nil })
+		}, CircuitOpen, ErrCircuitOpen},
+		{"half-open after OpenTimeout closes on successes", func(cb *CircuitBreaker, clock *testClock) error {
+			callN(cb, 3, errDependency)
+			clock.Advance(cfg.OpenTimeout)
+			callN(cb, 2, nil)
+			return nil
+		}, CircuitClosed, nil},
+		{"half-open failure reopens", func(cb *CircuitBreaker, clock *testClock) error {
+			callN(cb, 3, errDependency)
+			clock.Advance(cfg.OpenTimeout)
+			callN(cb, 1, nil)
+			return cb.Call(func() error { return errDependency })
+		}, CircuitOpen, errDependency},
+		{"forced open ignores timeout", func(cb *CircuitBreaker, clock *testClock) error {
+			cb.ForceOpen()
+			clock.Advance(cfg.OpenTimeout)
+			return cb.Call(func() error { return nil })
+		}, CircuitOpen, ErrCircuitOpen},
+		{"forced closed ignores failures", func(cb *CircuitBreaker, clock *testClock) error {
+			cb.ForceClose()
+			callN(cb, 5, errDependency)
+			return nil
+		}, CircuitClosed, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cb, clock := newTestBreaker(cfg)
+			if err := tt.run(cb, clock); !errors.Is(err, tt.err) {
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			}
+			if got := cb.State(); got != tt.want {
+				t.Fatalf("state = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerHalfOpenProbeLimit(t *testing.T) {
+	cb, clock := newTestBreaker(CircuitBreakerConfig{
+		MaxFailures: 1, Window: time.Minute, OpenTimeout: time.Second,
+		HalfOpenProbes: 1, HalfOpenSuccesses: 1,
+	})
+	callN(cb, 1, errDependency)
+	clock.Advance(time.Second)
+
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		cb.Call(func() error { <-release; return nil })
+		close(done)
+	}()
+	for cb.Snapshot().HalfOpenProbes == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := cb.Call(func() error { return nil }); !errors.Is(err, ErrCircuitProbeLimit) {
+		t.Fatalf("second probe error = %v, want %v", err, ErrCircuitProbeLimit)
+	}
+	close(release)
+	<-done
+	if got := cb.State(); got != CircuitClosed {
+		t.Fatalf("state = %s, want closed", got)
+	}
+}
+
+func TestCircuitBreakerPanicCountsAsFailure(t *testing.T) {
+	cb, clock := newTestBreaker(CircuitBreakerConfig{
+		MaxFailures: 1, Window: time.Minute, OpenTimeout: time.Second,
+		HalfOpenProbes: 1, HalfOpenSuccesses: 1,
+	})
+	callPanicking := func() (recovered interface{}) {
+		defer func() { recovered = recover() }()
+		cb.Call(func() error { panic("injected") })
+		return nil
+	}
+
+	if callPanicking() == nil {
+		t.Fatal("panic was swallowed")
+	}
+	if got := cb.State(); got != CircuitOpen {
+		t.Fatalf("after panic while closed: state = %s, want open", got)
+	}
+
+	// Pânico durante o half-open reabre o circuito em vez de consumir a
+	// vaga de teste para sempre
+	for i := 0; i < 3; i++ {
+		clock.Advance(time.Second)
+		callPanicking()
+		if got := cb.State(); got != CircuitOpen {
+			t.Fatalf("after half-open panic %d: state = %s, want open", i, got)
+		}
+	}
+	clock.Advance(time.Second)
+	if err := cb.Call(func() error { return nil }); err != nil {
+		t.Fatalf("probe after panics error = %v", err)
+	}
+	if got := cb.State(); got != CircuitClosed {
+		t.Fatalf("state = %s, want closed", got)
+	}
+}
+
+func TestCircuitBreakerFailureRate(t *testing.T) {
+	cb, _ := newTestBreaker(CircuitBreakerConfig{
+		FailureRate: 0.5, Window: time.Minute, MinRequests: 10, OpenTimeout: time.Minute,
+	})
+	// Alternando sucesso e falha: nunca há falhas consecutivas suficientes,
+	// mas a taxa chega a 50% quando a janela tem MinRequests chamadas
+	for i := 0; i < 9; i++ {
+		var err error
+		if i%2 == 0 {
+			err = errDependency
+		}
+		callN(cb, 1, err)
+	}
+	if got := cb.State(); got != CircuitClosed {
+		t.Fatalf("below MinRequests: state = %s, want closed", got)
+	}
+	callN(cb, 1, errDependency)
+	if got := cb.State(); got != CircuitOpen {
+		t.Fatalf("state = %s, want open", got)
+	}
+}
+
+func TestCircuitBreakerCountsOnlyDependencyFailures(t *testing.T) {
+	cfg := CircuitBreakerConfig{
+		MaxFailures: 2, Window: time.Minute, OpenTimeout: time.Second,
+		HalfOpenProbes: 1, HalfOpenSuccesses: 1,
+	}
+	canceled := fmt.Errorf("%s: %w", faultStageExternalService, context.Canceled)
+	budget := &DependencyTimeoutError{Dependency: faultStageExternalService, BudgetExhausted: true, Err: context.DeadlineExceeded}
+	timeout := &DependencyTimeoutError{Dependency: faultStageExternalService, Timeout: time.Second, Err: context.DeadlineExceeded}
+
+	tests := []struct {
+		name string
+		err  error
+		want CircuitState
+	}{
+		{"client canceled is ignored", canceled, CircuitClosed},
+		{"request budget exhausted is ignored", budget, CircuitClosed},
+		{"unrelated error is ignored", errDependency, CircuitClosed},
+		{"dependency timeout opens", timeout, CircuitOpen},
+		{"injected timeout opens", &DependencyTimeoutError{Dependency: faultStageExternalService, Err: chaos.ErrInjectedTimeout}, CircuitOpen},
+		{"injected fault opens", chaos.ErrInjectedFault, CircuitOpen},
+		{"injected malformed response opens", chaos.ErrInjectedMalformed, CircuitOpen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cb, _ := newTestBreaker(cfg)
+			cb.SetFailureFilter(isDependencyFailure)
+			callN(cb, 5, tt.err)
+			if got := cb.State(); got != tt.want {
+				t.Fatalf("state = %s, want %s", got, tt.want)
+			}
+			if snap := cb.Snapshot(); tt.want == CircuitClosed && snap.WindowRequests != 0 {
+				t.Fatalf("ignored errors recorded in window: %d requests", snap.WindowRequests)
+			}
+		})
+	}
+
+	// Half-open: uma chamada cancelada devolve a vaga de teste em vez de
+	// reabrir o circuito ou deixá-lo sem vagas
+	t.Run("half-open canceled probe frees the slot", func(t *testing.T) {
+		cb, clock := newTestBreaker(cfg)
+		cb.SetFailureFilter(isDependencyFailure)
+		callN(cb, 2, timeout)
+		clock.Advance(cfg.OpenTimeout)
+		if err := cb.Call(func() error { return canceled }); !errors.Is(err, context.Canceled) {
+			t.Fatalf("probe error = %v, want context.Canceled", err)
+		}
+		if got := cb.State(); got != CircuitHalfOpen {
+			t.Fatalf("after canceled probe: state = %s, want half-open", got)
+		}
+		if err := cb.Call(func() error { return nil }); err != nil {
+			t.Fatalf("next probe error = %v", err)
+		}
+		if got := cb.State(); got != CircuitClosed {
+			t.Fatalf("state = %s, want closed", got)
+		}
+	})
+}
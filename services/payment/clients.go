@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/sha256"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// ============================================================================
+// IDENTIDADE DO CLIENTE (rate limit por cliente e escopo de Idempotency-Key)
+// ============================================================================
+
+// Chaves de API em API_KEYS="cliente-a:segredo-a,cliente-b:segredo-b",
+// enviadas como "Authorization: Bearer <segredo>". Indexadas pelo hash do
+// segredo, que não fica em memória em claro
+type apiKeyRegistry struct {
+	clients map[[sha256.Size]byte]string
+}
+
+var apiKeys = newAPIKeyRegistryFromEnv()
+
+func newAPIKeyRegistryFromEnv() *apiKeyRegistry {
+	return &apiKeyRegistry{clients: parseAPIKeys(os.Getenv("API_KEYS"))}
+}
+
+func parseAPIKeys(pairs string) map[[sha256.Size]byte]string {
+	clients := make(map[[sha256.Size]byte]string)
+	for _, pair := range strings.Split(pairs, ",") {
+		client, secret, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || client == "" || secret == "" {
+			continue
+		}
+		clients[sha256.Sum256([]byte(secret))] = client
+	}
+	return clients
+}
+
+func (reg *apiKeyRegistry) lookup(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return "", false
+	}
+	client, ok := reg.clients[sha256.Sum256([]byte(strings.TrimSpace(token)))]
+	return client, ok
+}
+
+// clientIdentity identifica o cliente pela chave de API ou, sem uma chave
+// válida, pelo IP de origem. Headers informados pelo próprio cliente (como
+// X-Client-ID) não são usados: trocar o valor a cada requisição contornaria
+// o limite por cliente
+func clientIdentity(r *http.Request) string {
+	if client, ok := apiKeys.lookup(r); ok {
+		return "key:" + client
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"shared/chaos"
+)
+
+// ============================================================================
+// DEPENDÊNCIAS SIMULADAS (timeouts por dependência e cancelamento)
+// ============================================================================
+
+// Status não padronizado (nginx) para requisições abandonadas pelo cliente:
+// separa desconexões de erros do serviço em http_requests_total
+const statusClientClosedRequest = 499
+
+// DependencyTimeoutError indica que uma dependência não respondeu a tempo:
+// pelo timeout próprio (DEPENDENCY_TIMEOUT_<NOME>_MS) ou porque o prazo da
+// requisição acabou antes (BudgetExhausted)
+type DependencyTimeoutError struct {
+	Dependency      string
+	Timeout         time.Duration // timeout próprio da dependência (0 = sem limite)
+	Elapsed         time.Duration
+	BudgetExhausted bool
+	Err             error // context.DeadlineExceeded ou chaos.ErrInjectedTimeout
+}
+
+func (e *DependencyTimeoutError) Error() string {
+	if e.BudgetExhausted {
+		return fmt.Sprintf("%s: request deadline exceeded after %v", e.Dependency, e.Elapsed.Round(time.Millisecond))
+	}
+	return fmt.Sprintf("%s: timed out after %v", e.Dependency, e.Elapsed.Round(time.Millisecond))
+}
+
+func (e *DependencyTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// DependencyTimeouts guarda o timeout de cada dependência simulada
+type DependencyTimeouts map[string]time.Duration
+
+var dependencyTimeouts DependencyTimeouts
+
+// Padrões acima dos delays padrão do lag intencional, para que o lag só
+// estoure o timeout com distribuições de cauda longa ou delays maiores.
+// Sobrescritos por DEPENDENCY_TIMEOUT_<NOME>_MS (ex: DEPENDENCY_TIMEOUT_EXTERNAL_SERVICE_MS);
+// 0 desabilita o timeout da dependência
+func newDependencyTimeoutsFromEnv() DependencyTimeouts {
+	timeouts := DependencyTimeouts{
+		lagStageDatabase:          5 * time.Second,
+		lagStageCache:             1 * time.Second,
+		lagStageExternal:          2 * time.Second,
+		faultStageExternalService: 2 * time.Second,
+	}
+	for name := range timeouts {
+		key := "DEPENDENCY_TIMEOUT_" + strings.NewReplacer("-", "_").Replace(strings.ToUpper(name)) + "_MS"
+		if v, err := strconv.Atoi(os.Getenv(key)); err == nil && v >= 0 {
+			timeouts[name] = time.Duration(v) * time.Millisecond
+		}
+	}
+	return timeouts
+}
+
+// callDependency executa fn com o timeout da dependência, limitado pelo prazo
+// restante da requisição. Se o contexto terminar antes de fn retornar, o
+// resultado de fn é descartado e o erro vira DependencyTimeoutError (prazo)
+// ou context.Canceled (cliente desconectou). O span do contexto é marcado
+func callDependency(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	timeout := dependencyTimeouts[name]
+	callCtx, cancel := ctx, context.CancelFunc(func() {})
+	if timeout > 0 {
+		callCtx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	defer cancel()
+
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.String("dependency.name", name),
+		attribute.Int64("dependency.timeout_ms", timeout.Milliseconds()),
+	)
+
+	start := time.Now()
+	err := fn(callCtx)
+	elapsed := time.Since(start)
+
+	switch {
+	case ctx.Err() == context.Canceled:
+		err = fmt.Errorf("%s: %w", name, context.Canceled)
+	case ctx.Err() == context.DeadlineExceeded:
+		err = &DependencyTimeoutError{Dependency: name, Timeout: timeout, Elapsed: elapsed, BudgetExhausted: true, Err: context.DeadlineExceeded}
+	case callCtx.Err() == context.DeadlineExceeded:
+		err = &DependencyTimeoutError{Dependency: name, Timeout: timeout, Elapsed: elapsed, Err: context.DeadlineExceeded}
+	case errors.Is(err, chaos.ErrInjectedTimeout):
+		err = &DependencyTimeoutError{Dependency: name, Timeout: timeout, Elapsed: elapsed, Err: err}
+	}
+
+	var timeoutErr *DependencyTimeoutError
+	if errors.As(err, &timeoutErr) {
+		span.SetAttributes(
+			attribute.Bool("dependency.timeout", true),
+			attribute.Bool("dependency.budget_exhausted", timeoutErr.BudgetExhausted),
+		)
+	}
+	if errors.Is(err, context.Canceled) {
+		span.SetAttributes(attribute.Bool("dependency.canceled", true))
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// isDependencyFailure diz se err indica problema na própria dependência e
+// deve contar no circuit breaker: timeouts da dependência e falhas injetadas.
+// Cliente desconectado e prazo da requisição esgotado antes da resposta
+// (PAYMENT_DEADLINE_MS) não dizem nada sobre a saúde da dependência
+func isDependencyFailure(err error) bool {
+	var timeoutErr *DependencyTimeoutError
+	if errors.As(err, &timeoutErr) {
+		return !timeoutErr.BudgetExhausted
+	}
+	return errors.Is(err, chaos.ErrInjectedFault) || errors.Is(err, chaos.ErrInjectedMalformed)
+}
+
+// sleepContext espera d ou o fim do contexto, o que vier primeiro
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// dependencyProblem traduz a falha de uma dependência: timeout vira 504,
+// desconexão do cliente vira 499 e as demais falhas 503
+func dependencyProblem(err error) *Problem {
+	var timeoutErr *DependencyTimeoutError
+	switch {
+	case errors.Is(err, context.Canceled):
+		p := newProblem(statusClientClosedRequest, CodeClientClosedRequest, "client closed the request")
+		p.Title = "Client Closed Request"
+		return p
+	case errors.As(err, &timeoutErr) && !timeoutErr.BudgetExhausted:
+		return newProblem(http.StatusGatewayTimeout, CodeDependencyTimeout,
+			fmt.Sprintf("dependency %s timed out", timeoutErr.Dependency))
+	case errors.Is(err, context.DeadlineExceeded):
+		return newProblem(http.StatusGatewayTimeout, CodeDeadlineExceeded, "request deadline exceeded")
+	case errors.Is(err, chaos.ErrInjectedTimeout):
+		return newProblem(http.StatusGatewayTimeout, CodeDependencyTimeout, "dependency timed out")
+	}
+	return newProblem(http.StatusServiceUnavailable, CodeDependencyUnavailable, "service temporarily unavailable")
+}
+
+// logDependencyFailure registra a falha de uma dependência; cancelamento pelo
+// cliente não é erro do serviço e fica em Warn
+func logDependencyFailure(ctx context.Context, event string, err error, fields ...zap.Field) {
+	correlationID, _ := ctx.Value("correlation_id").(string)
+	traceID, _ := ctx.Value("trace_id").(string)
+	fields = append(fields,
+		zap.String("correlation_id", correlationID),
+		zap.String("trace_id", traceID),
+		zap.Error(err),
+	)
+	if errors.Is(err, context.Canceled) {
+		logger.Warn(event, fields...)
+		return
+	}
+	logger.Error(event, fields...)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"shared/money"
+)
+
+// ============================================================================
+// EVENTOS DE PAGAMENTO (exchange "payments")
+// ============================================================================
+
+// PaymentEvent é o payload publicado a cada transição de estado
+type PaymentEvent struct {
+	Event          string        `json:"event"`
+	PaymentID      string        `json:"paymentId"`
+	AccountID      string        `json:"accountId"`
+	Amount         money.Money   `json:"amount"`
+	Status         PaymentStatus `json:"status"`
+	PreviousStatus PaymentStatus `json:"previousStatus,omitempty"`
+	Reason         string        `json:"reason,omitempty"`
+	// Preenchidos apenas em PaymentRefunded
+	RefundID      string       `json:"refundId,omitempty"`
+	RefundAmount  *money.Money `json:"refundAmount,omitempty"`
+	RefundedTotal *money.Money `json:"refundedTotal,omitempty"`
+	CorrelationID string       `json:"correlationId"`
+	TraceID       string       `json:"traceId"`
+	TS            int64        `json:"ts"`
+}
+
+func newPaymentEvent(p Payment) PaymentEvent {
+	return PaymentEvent{
+		Event:         paymentStatusEvents[p.Status],
+		PaymentID:     p.ID,
+		AccountID:     p.AccountID,
+		Amount:        p.Amount,
+		Status:        p.Status,
+		CorrelationID: p.CorrelationID,
+		TraceID:       p.TraceID,
+		TS:            time.Now().UnixMilli(),
+	}
+}
+
+// Situação da entrega do evento informada nas respostas da API. Eventos
+// UNCONFIRMED continuam no outbox e são reenviados pelo relay
+const (
+	EventStatusConfirmed   = "CONFIRMED"
+	EventStatusUnconfirmed = "UNCONFIRMED"
+)
+
+func eventStatus(err error) string {
+	if err != nil {
+		return EventStatusUnconfirmed
+	}
+	return EventStatusConfirmed
+}
+
+// outboxEventStatus dá o eventStatus de uma resposta repetida: UNCONFIRMED
+// enquanto houver eventos do pagamento no outbox
+func outboxEventStatus(ctx context.Context, paymentID string) (string, error) {
+	pending, err := paymentRepository.PendingOutbox(ctx, paymentID)
+	if err != nil {
+		return "", err
+	}
+	if len(pending) > 0 {
+		return EventStatusUnconfirmed, nil
+	}
+	return EventStatusConfirmed, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+
+	"shared/chaos"
+)
+
+// ============================================================================
+// INJEÇÃO DE FALHAS (biblioteca compartilhada shared/chaos)
+// ============================================================================
+
+// Estágios de falha além dos estágios de lag (database, cache, external)
+const (
+	faultStageExternalService = "external-service" // chamada protegida pelo circuit breaker
+	faultStagePublish         = "publish"          // publicação de eventos do outbox
+)
+
+var faultInjector *chaos.FaultInjector
+
+// Campos de log de lag e falhas: correlation_id e trace_id da requisição
+func chaosOptions() chaos.Options {
+	return chaos.Options{
+		Logger: logger,
+		ContextFields: func(ctx context.Context) []zap.Field {
+			correlationID, _ := ctx.Value("correlation_id").(string)
+			traceID, _ := ctx.Value("trace_id").(string)
+			return []zap.Field{
+				zap.String("correlation_id", correlationID),
+				zap.String("trace_id", traceID),
+			}
+		},
+	}
+}
+
+// Falhas aceitas por estágio. publish roda também no relay em background,
+// onde um pânico derrubaria o processo; drop/duplicate só fazem sentido em
+// eventos. Padrão: 5% de erro no serviço externo (comportamento original),
+// sobrescrito por FAULT_* (ver chaos.FaultInjector.LoadEnv)
+func newFaultInjectorFromEnv() *chaos.FaultInjector {
+	fi := chaos.NewFaultInjector(chaosOptions(),
+		chaos.FaultStage{Name: lagStageDatabase, Faults: []string{chaos.FaultError, chaos.FaultTimeout, chaos.FaultPanic}},
+		chaos.FaultStage{Name: lagStageCache, Faults: []string{chaos.FaultError, chaos.FaultTimeout, chaos.FaultPanic, chaos.FaultMalformed}},
+		chaos.FaultStage{Name: lagStageExternal, Faults: []string{chaos.FaultError, chaos.FaultTimeout, chaos.FaultPanic, chaos.FaultMalformed}},
+		chaos.FaultStage{Name: faultStageExternalService, Faults: []string{chaos.FaultError, chaos.FaultTimeout, chaos.FaultPanic, chaos.FaultMalformed}},
+		chaos.FaultStage{Name: faultStagePublish, Faults: []string{chaos.FaultError, chaos.FaultTimeout, chaos.FaultMalformed, chaos.FaultDrop, chaos.FaultDuplicate}},
+	)
+	fi.Apply(chaos.FaultConfig{
+		Enabled: true,
+		Stages:  map[string]chaos.StageFaults{faultStageExternalService: {Error: 0.05}},
+	})
+	fi.LoadEnv()
+	return fi
+}
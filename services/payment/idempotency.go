@@ -0,0 +1,423 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// ============================================================================
+// IDEMPOTÊNCIA (Idempotency-Key)
+// ============================================================================
+
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotencyRecord é a resposta memorizada de uma requisição. Fica no
+// repositório de pagamentos: a reserva (chave + fingerprint) é gravada na
+// mesma operação que cria o recurso, e a resposta completa logo depois
+type IdempotencyRecord struct {
+	// Chaves são isoladas por cliente
+	Client      string `json:"client"`
+	Key         string `json:"key"`
+	Fingerprint string `json:"fingerprint"`
+	// Recurso criado pela requisição (pagamento); permite remontar a
+	// resposta se o processo cair antes de ela ser gravada
+	ResourceID string      `json:"resourceId,omitempty"`
+	StatusCode int         `json:"statusCode,omitempty"` // 0 = resposta não gravada
+	Header     http.Header `json:"header,omitempty"`
+	Body       []byte      `json:"body,omitempty"`
+	CreatedAt  time.Time   `json:"createdAt"`
+}
+
+func idempotencyID(client, key string) string {
+	return client + "\x00" + key
+}
+
+// IdempotencyRepository é implementado pelo mesmo armazenamento dos
+// pagamentos, como o outbox
+type IdempotencyRepository interface {
+	GetIdempotency(ctx context.Context, client, key string) (IdempotencyRecord, bool, error)
+	SaveIdempotency(ctx context.Context, rec IdempotencyRecord) error
+	// DeleteIdempotencyBefore remove os registros criados antes de cutoff
+	DeleteIdempotencyBefore(ctx context.Context, cutoff time.Time) (int, error)
+}
+
+// idempotencyReservation acompanha a requisição pelo contexto até o
+// repositório, que a grava junto com o primeiro recurso criado
+type idempotencyReservation struct {
+	client      string
+	key         string
+	fingerprint string
+	createdAt   time.Time
+	resourceID  string // preenchido quando a reserva foi gravada
+}
+
+type idempotencyContextKey struct{}
+
+func idempotencyReservationFrom(ctx context.Context) *idempotencyReservation {
+	res, _ := ctx.Value(idempotencyContextKey{}).(*idempotencyReservation)
+	return res
+}
+
+// pendingIdempotency retorna o registro a gravar junto com resourceID, se a
+// requisição tem Idempotency-Key e a reserva ainda não foi gravada; bound
+// deve ser chamada depois que a gravação for bem-sucedida
+func pendingIdempotency(ctx context.Context, resourceID string) (rec *IdempotencyRecord, bound func()) {
+	res := idempotencyReservationFrom(ctx)
+	if res == nil || res.resourceID != "" {
+		return nil, func() {}
+	}
+	return &IdempotencyRecord{
+		Client:      res.client,
+		Key:         res.key,
+		Fingerprint: res.fingerprint,
+		ResourceID:  resourceID,
+		CreatedAt:   res.createdAt,
+	}, func() {
+		res.resourceID = resourceID
+	}
+}
+
+// idempotencyCall coordena requisições simultâneas com a mesma chave
+type idempotencyCall struct {
+	fingerprint string
+	done        chan struct{} // fechado quando a requisição original termina
+	completed   bool
+	resourceID  string
+	statusCode  int
+	header      http.Header
+	body        []byte
+}
+
+// IdempotencyStore serializa as requisições em andamento em memória e lê e
+// grava as respostas concluídas no repositório, que sobrevive a restarts
+type IdempotencyStore struct {
+	mu       sync.Mutex
+	inFlight map[string]*idempotencyCall
+	// Chaves sendo lidas do repositório (fora do lock); fechado ao terminar
+	lookups map[string]chan struct{}
+	ttl     time.Duration
+	repo    IdempotencyRepository
+}
+
+func NewIdempotencyStore(repo IdempotencyRepository, ttl time.Duration) *IdempotencyStore {
+	return &IdempotencyStore{
+		inFlight: make(map[string]*idempotencyCall),
+		lookups:  make(map[string]chan struct{}),
+		ttl:      ttl,
+		repo:     repo,
+	}
+}
+
+var idempotencyStore *IdempotencyStore
+
+// Begin retorna a chamada em andamento ou já concluída para a chave, ou
+// reserva uma nova. owner=true indica que o chamador executa a requisição
+func (s *IdempotencyStore) Begin(ctx context.Context, client, key, fingerprint string) (call *idempotencyCall, owner bool, err error) {
+	id := idempotencyID(client, key)
+	for {
+		s.mu.Lock()
+		if call, ok := s.inFlight[id]; ok {
+			s.mu.Unlock()
+			return call, false, nil
+		}
+		// Outra requisição com a mesma chave está lendo o repositório:
+		// esperar e conferir de novo
+		if lookup, ok := s.lookups[id]; ok {
+			s.mu.Unlock()
+			select {
+			case <-lookup:
+				continue
+			case <-ctx.Done():
+				return nil, false, ctx.Err()
+			}
+		}
+		lookup := make(chan struct{})
+		s.lookups[id] = lookup
+		s.mu.Unlock()
+
+		// Leitura fora do lock: as demais chaves não esperam o disco
+		rec, found, err := s.repo.GetIdempotency(ctx, client, key)
+
+		s.mu.Lock()
+		delete(s.lookups, id)
+		close(lookup)
+		defer s.mu.Unlock()
+		if err != nil {
+			return nil, false, err
+		}
+		if found && time.Since(rec.CreatedAt) <= s.ttl {
+			call = &idempotencyCall{
+				fingerprint: rec.Fingerprint,
+				done:        make(chan struct{}),
+				completed:   rec.StatusCode != 0,
+				resourceID:  rec.ResourceID,
+				statusCode:  rec.StatusCode,
+				header:      rec.Header,
+				body:        rec.Body,
+			}
+			close(call.done)
+			return call, false, nil
+		}
+
+		call = &idempotencyCall{fingerprint: fingerprint, done: make(chan struct{})}
+		s.inFlight[id] = call
+		return call, true, nil
+	}
+}
+
+// Complete grava a resposta no repositório e libera as requisições
+// duplicadas em espera. Se a gravação falhar, a reserva feita junto com o
+// recurso ainda permite remontar a resposta depois de um restart
+func (s *IdempotencyStore) Complete(ctx context.Context, res *idempotencyReservation, call *idempotencyCall, statusCode int, header http.Header, body []byte) {
+	err := s.repo.SaveIdempotency(ctx, IdempotencyRecord{
+		Client:      res.client,
+		Key:         res.key,
+		Fingerprint: res.fingerprint,
+		ResourceID:  res.resourceID,
+		StatusCode:  statusCode,
+		Header:      header,
+		Body:        body,
+		CreatedAt:   res.createdAt,
+	})
+	if err != nil {
+		logger.Error("idempotency_record_store_failed",
+			zap.String("idempotency_key", res.key),
+			zap.String("resource_id", res.resourceID),
+			zap.Error(err),
+		)
+	}
+
+	s.mu.Lock()
+	call.statusCode = statusCode
+	call.header = header
+	call.body = body
+	call.resourceID = res.resourceID
+	call.completed = true
+	delete(s.inFlight, idempotencyID(res.client, res.key))
+	s.mu.Unlock()
+	close(call.done)
+}
+
+// Abort descarta a chamada em andamento (ex: falha transitória) para
+// permitir nova tentativa; se um recurso já foi gravado com a reserva, a
+// nova tentativa recebe a resposta remontada a partir dele
+func (s *IdempotencyStore) Abort(res *idempotencyReservation, call *idempotencyCall) {
+	s.mu.Lock()
+	call.resourceID = res.resourceID
+	id := idempotencyID(res.client, res.key)
+	if s.inFlight[id] == call {
+		delete(s.inFlight, id)
+	}
+	s.mu.Unlock()
+	close(call.done)
+}
+
+// Cleanup remove do repositório os registros expirados
+func (s *IdempotencyStore) Cleanup(ctx context.Context) {
+	removed, err := s.repo.DeleteIdempotencyBefore(ctx, time.Now().Add(-s.ttl))
+	if err != nil {
+		logger.Error("idempotency_cleanup_failed", zap.Error(err))
+		return
+	}
+	if removed > 0 {
+		logger.Info("idempotency_records_expired", zap.Int("removed", removed))
+	}
+}
+
+func (s *IdempotencyStore) snapshot(call *idempotencyCall) (completed bool, resourceID string, statusCode int, header http.Header, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return call.completed, call.resourceID, call.statusCode, call.header, call.body
+}
+
+// idempotencyReplayFunc remonta a resposta de uma requisição cujo recurso
+// foi gravado mas cuja resposta não chegou a ser (crash no meio do caminho)
+type idempotencyReplayFunc func(ctx context.Context, rec IdempotencyRecord) (statusCode int, body interface{}, err error)
+
+func requestFingerprint(client string, r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(client))
+	h.Write([]byte{0})
+	h.Write([]byte(r.Method))
+	h.Write([]byte{0})
+	h.Write([]byte(r.URL.Path))
+	h.Write([]byte{0})
+	h.Write(canonicalBody(body))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Normaliza JSON (ordem de campos, espaços) para que o fingerprint
+// dependa apenas do conteúdo; corpos inválidos são usados como estão.
+// Números mantêm o texto original (UseNumber): como float64, valores como
+// 90071992547409.93 e 90071992547409.92 teriam o mesmo fingerprint
+func canonicalBody(body []byte) []byte {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return body
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return body
+	}
+	canonical, err := json.Marshal(v)
+	if err != nil {
+		return body
+	}
+	return canonical
+}
+
+// Respostas que não devem ser memorizadas: o cliente pode tentar novamente
+// (inclusive depois de abandonar a requisição, 499)
+func isRetryableStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode == statusClientClosedRequest || statusCode >= 500
+}
+
+// recordingResponseWriter copia status e corpo da resposta para armazenamento
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func (rw *recordingResponseWriter) WriteHeader(code int) {
+	rw.statusCode = code
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *recordingResponseWriter) Write(b []byte) (int, error) {
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
+
+func idempotencyMiddleware(next http.HandlerFunc, replay idempotencyReplayFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" || r.Method != http.MethodPost {
+			next(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		correlationID, _ := ctx.Value("correlation_id").(string)
+		traceID, _ := ctx.Value("trace_id").(string)
+		span := trace.SpanFromContext(ctx)
+		span.SetAttributes(attribute.String("idempotency.key", key))
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBodyBytes))
+		if err != nil {
+			writeProblem(w, r, decodeProblem(err))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		client := clientIdentity(r)
+		fingerprint := requestFingerprint(client, r, body)
+
+		for {
+			call, owner, err := idempotencyStore.Begin(ctx, client, key, fingerprint)
+			if err != nil {
+				logger.Error("idempotency_lookup_failed",
+					zap.String("idempotency_key", key),
+					zap.String("correlation_id", correlationID),
+					zap.String("trace_id", traceID),
+					zap.Error(err),
+				)
+				writeProblem(w, r, newProblem(http.StatusInternalServerError, CodeInternalError, "failed to check Idempotency-Key"))
+				return
+			}
+			if owner {
+				res := &idempotencyReservation{client: client, key: key, fingerprint: fingerprint, createdAt: time.Now()}
+				r = r.WithContext(context.WithValue(ctx, idempotencyContextKey{}, res))
+				rw := &recordingResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+				// Pânico no handler: liberar a chave antes de propagar
+				defer func() {
+					if p := recover(); p != nil {
+						idempotencyStore.Abort(res, call)
+						panic(p)
+					}
+				}()
+				next(rw, r)
+				if isRetryableStatus(rw.statusCode) {
+					idempotencyStore.Abort(res, call)
+				} else {
+					idempotencyStore.Complete(ctx, res, call, rw.statusCode, w.Header().Clone(), rw.body.Bytes())
+				}
+				return
+			}
+
+			if call.fingerprint != fingerprint {
+				idempotencyConflicts.WithLabelValues("fingerprint_mismatch").Inc()
+				span.SetAttributes(attribute.String("idempotency.result", "conflict"))
+				logger.Warn("idempotency_key_conflict",
+					zap.String("idempotency_key", key),
+					zap.String("correlation_id", correlationID),
+					zap.String("trace_id", traceID),
+				)
+				writeProblem(w, r, newProblem(http.StatusUnprocessableEntity, CodeIdempotencyKeyConflict,
+					"Idempotency-Key was already used with a different request"))
+				return
+			}
+
+			// Requisição original ainda em andamento: serializar aguardando o término
+			select {
+			case <-call.done:
+			case <-ctx.Done():
+				return
+			}
+
+			completed, resourceID, statusCode, header, storedBody := idempotencyStore.snapshot(call)
+			if !completed && resourceID == "" {
+				// Original abortada antes de gravar algo: tentar assumir a chave
+				continue
+			}
+
+			idempotencyHits.Inc()
+			span.SetAttributes(attribute.String("idempotency.result", "replayed"))
+			logger.Info("idempotency_replay",
+				zap.String("idempotency_key", key),
+				zap.Int("status", statusCode),
+				zap.String("resource_id", resourceID),
+				zap.Bool("rebuilt", !completed),
+				zap.String("correlation_id", correlationID),
+				zap.String("trace_id", traceID),
+			)
+
+			if !completed {
+				// Recurso gravado, resposta perdida: remontar a partir do recurso
+				statusCode, response, err := replay(ctx, IdempotencyRecord{
+					Client: client, Key: key, Fingerprint: fingerprint, ResourceID: resourceID,
+				})
+				if err != nil {
+					writeProblem(w, r, newProblem(http.StatusInternalServerError, CodeInternalError, "failed to replay idempotent request"))
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(statusCode)
+				json.NewEncoder(w).Encode(response)
+				return
+			}
+
+			for name, values := range header {
+				w.Header()[name] = values
+			}
+			// Tempos da requisição original não descrevem esta resposta
+			w.Header().Del("Server-Timing")
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(statusCode)
+			w.Write(storedBody)
+			return
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCanonicalBody(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b string
+		same bool
+	}{
+		{"ordem e espaços", `{"amount":10,"currency":"BRL"}`, `{ "currency": "BRL", "amount": 10 }`, true},
+		{"números além da precisão de float64", `{"amount":90071992547409.93}`, `{"amount":90071992547409.92}`, false},
+		{"inteiros grandes", `{"amount":9007199254740993}`, `{"amount":9007199254740992}`, false},
+		{"corpo inválido usado como está", `{"amount":`, `{"amount":`, true},
+		{"conteúdo após o JSON", `{"amount":1} x`, `{"amount":1}`, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			a, b := canonicalBody([]byte(tc.a)), canonicalBody([]byte(tc.b))
+			if got := bytes.Equal(a, b); got != tc.same {
+				t.Fatalf("canonicalBody(%s)=%s, canonicalBody(%s)=%s, iguais=%v, esperado %v", tc.a, a, tc.b, b, got, tc.same)
+			}
+		})
+	}
+}
+
+// blockingIdempotencyRepo segura GetIdempotency da chave "lenta" até release
+type blockingIdempotencyRepo struct {
+	*MemoryPaymentRepository
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (r *blockingIdempotencyRepo) GetIdempotency(ctx context.Context, client, key string) (IdempotencyRecord, bool, error) {
+	if key == "lenta" {
+		r.entered <- struct{}{}
+		<-r.release
+	}
+	return r.MemoryPaymentRepository.GetIdempotency(ctx, client, key)
+}
+
+func TestIdempotencyStoreBeginLooksUpOutsideLock(t *testing.T) {
+	repo := &blockingIdempotencyRepo{
+		MemoryPaymentRepository: NewMemoryPaymentRepository(),
+		entered:                 make(chan struct{}, 1),
+		release:                 make(chan struct{}),
+	}
+	store := NewIdempotencyStore(repo, time.Hour)
+	ctx := context.Background()
+
+	type result struct {
+		call  *idempotencyCall
+		owner bool
+	}
+	slow := make(chan result, 2)
+	go func() {
+		call, owner, _ := store.Begin(ctx, "c", "lenta", "fp")
+		slow <- result{call, owner}
+	}()
+	<-repo.entered
+
+	// Outra chave não espera a leitura lenta
+	done := make(chan struct{})
+	go func() {
+		if _, owner, err := store.Begin(ctx, "c", "rapida", "fp"); err != nil || !owner {
+			t.Errorf("Begin(rapida) owner=%v err=%v", owner, err)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Begin de outra chave bloqueado pela leitura do repositório")
+	}
+
+	// A mesma chave espera a leitura em andamento e recebe a mesma chamada
+	go func() {
+		call, owner, _ := store.Begin(ctx, "c", "lenta", "fp")
+		slow <- result{call, owner}
+	}()
+	close(repo.release)
+	first, second := <-slow, <-slow
+	if first.owner == second.owner {
+		t.Fatalf("esperado exatamente um dono, owners=%v/%v", first.owner, second.owner)
+	}
+	if first.call != second.call {
+		t.Fatal("requisições com a mesma chave receberam chamadas diferentes")
+	}
+}
+
+func TestIdempotencyStoreBeginSingleOwner(t *testing.T) {
+	store := NewIdempotencyStore(NewMemoryPaymentRepository(), time.Hour)
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		owners int
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, owner, err := store.Begin(context.Background(), "c", "k", "fp")
+			if err != nil {
+				t.Error(err)
+			}
+			if owner {
+				mu.Lock()
+				owners++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if owners != 1 {
+		t.Fatalf("owners = %d, esperado 1", owners)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ============================================================================
+// CICLO DE VIDA DO PAGAMENTO (máquina de estados)
+// ============================================================================
+
+type PaymentStatus string
+
+const (
+	StatusPending    PaymentStatus = "PENDING"
+	StatusAuthorized PaymentStatus = "AUTHORIZED"
+	StatusCaptured   PaymentStatus = "CAPTURED"
+	StatusSettled    PaymentStatus = "SETTLED"
+	StatusDeclined   PaymentStatus = "DECLINED"
+	StatusFailed     PaymentStatus = "FAILED"
+	StatusRefunded   PaymentStatus = "REFUNDED"
+	StatusCanceled   PaymentStatus = "CANCELED"
+)
+
+var allPaymentStatuses = []PaymentStatus{
+	StatusPending, StatusAuthorized, StatusCaptured, StatusSettled,
+	StatusDeclined, StatusFailed, StatusRefunded, StatusCanceled,
+}
+
+// Transições permitidas: PENDING → AUTHORIZED → CAPTURED → SETTLED,
+// com saídas para DECLINED, FAILED, CANCELED e REFUNDED
+var paymentTransitions = map[PaymentStatus][]PaymentStatus{
+	StatusPending:    {StatusAuthorized, StatusDeclined, StatusFailed, StatusCanceled},
+	StatusAuthorized: {StatusCaptured, StatusDeclined, StatusFailed, StatusCanceled},
+	StatusCaptured:   {StatusSettled, StatusRefunded, StatusFailed},
+	StatusSettled:    {StatusRefunded},
+	// DECLINED, FAILED, REFUNDED e CANCELED são estados finais
+}
+
+// Evento publicado na exchange "payments" ao entrar em cada estado
+var paymentStatusEvents = map[PaymentStatus]string{
+	StatusPending:    "PaymentCreated",
+	StatusAuthorized: "PaymentAuthorized",
+	StatusCaptured:   "PaymentCaptured",
+	StatusSettled:    "PaymentSettled",
+	StatusDeclined:   "PaymentDeclined",
+	StatusFailed:     "PaymentFailed",
+	StatusRefunded:   "PaymentRefunded",
+	StatusCanceled:   "PaymentCanceled",
+}
+
+var ErrIllegalTransition = errors.New("illegal payment status transition")
+
+func ParsePaymentStatus(s string) (PaymentStatus, bool) {
+	for _, status := range allPaymentStatuses {
+		if string(status) == s {
+			return status, true
+		}
+	}
+	return "", false
+}
+
+func (s PaymentStatus) IsTerminal() bool {
+	return len(paymentTransitions[s]) == 0
+}
+
+func (s PaymentStatus) CanTransitionTo(to PaymentStatus) bool {
+	for _, allowed := range paymentTransitions[s] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// applyTransition valida e aplica a transição no registro; deve ser chamada
+// dentro de PaymentRepository.Update para que a validação seja atômica
+func applyTransition(p *Payment, to PaymentStatus) error {
+	if !p.Status.CanTransitionTo(to) {
+		paymentTransitionsRejected.WithLabelValues(string(p.Status), string(to)).Inc()
+		return fmt.Errorf("%w: %s -> %s", ErrIllegalTransition, p.Status, to)
+	}
+	p.Status = to
+	p.UpdatedAt = time.Now()
+	return nil
+}
+
+// recordTransition atualiza métricas e log após a transição ser persistida
+func recordTransition(p Payment, from PaymentStatus, reason string) {
+	paymentTransitionsTotal.WithLabelValues(string(from), string(p.Status)).Inc()
+	paymentsByState.WithLabelValues(string(from)).Dec()
+	paymentsByState.WithLabelValues(string(p.Status)).Inc()
+
+	logger.Info("payment_status_changed",
+		zap.String("payment_id", p.ID),
+		zap.String("from", string(from)),
+		zap.String("to", string(p.Status)),
+		zap.String("reason", reason),
+		zap.String("correlation_id", p.CorrelationID),
+		zap.String("trace_id", p.TraceID),
+	)
+}
+
+// transitionPayment aplica a transição de forma atômica no repositório,
+// gravando o evento correspondente no outbox; a entrega fica com o relay
+func transitionPayment(ctx context.Context, id string, to PaymentStatus, reason string) (Payment, error) {
+	var from PaymentStatus
+	payment, err := paymentRepository.Update(ctx, id, func(p *Payment) ([]PaymentEvent, error) {
+		from = p.Status
+		if err := applyTransition(p, to); err != nil {
+			return nil, err
+		}
+		event := newPaymentEvent(*p)
+		event.PreviousStatus = from
+		event.Reason = reason
+		return []PaymentEvent{event}, nil
+	})
+	if err != nil {
+		return Payment{}, err
+	}
+	recordTransition(payment, from, reason)
+	return payment, nil
+}
+
+// Inicializa o gauge por estado a partir dos pagamentos já persistidos
+func initPaymentStateGauge(ctx context.Context) error {
+	counts, err := paymentRepository.CountByStatus(ctx)
+	if err != nil {
+		return err
+	}
+	for _, status := range allPaymentStatuses {
+		paymentsByState.WithLabelValues(string(status)).Set(float64(counts[status]))
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCanTransitionTo(t *testing.T) {
+	allowed := map[PaymentStatus][]PaymentStatus{
+		StatusPending:    {StatusAuthorized, StatusDeclined, StatusFailed, StatusCanceled},
+		StatusAuthorized: {StatusCaptured, StatusDeclined, StatusFailed, StatusCanceled},
+		StatusCaptured:   {StatusSettled, StatusRefunded, StatusFailed},
+		StatusSettled:    {StatusRefunded},
+	}
+	for _, from := range allPaymentStatuses {
+		for _, to := range allPaymentStatuses {
+			want := false
+			for _, s := range allowed[from] {
+				if s == to {
+					want = true
+				}
+			}
+			if got := from.CanTransitionTo(to); got != want {
+				t.Errorf("%s -> %s = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	terminal := map[PaymentStatus]bool{
+		StatusDeclined: true, StatusFailed: true, StatusRefunded: true, StatusCanceled: true,
+	}
+	for _, s := range allPaymentStatuses {
+		if got := s.IsTerminal(); got != terminal[s] {
+			t.Errorf("%s.IsTerminal() = %v, want %v", s, got, terminal[s])
+		}
+	}
+}
+
+func TestApplyTransition(t *testing.T) {
+	tests := []struct {
+		from, to PaymentStatus
+		err      error
+	}{
+		{StatusPending, StatusAuthorized, nil},
+		{StatusAuthorized, StatusCaptured, nil},
+		{StatusCaptured, StatusSettled, nil},
+		{StatusPending, StatusCaptured, ErrIllegalTransition},
+		{StatusSettled, StatusPending, ErrIllegalTransition},
+		{StatusRefunded, StatusCaptured, ErrIllegalTransition},
+		{StatusCaptured, StatusCaptured, ErrIllegalTransition},
+	}
+	for _, tt := range tests {
+		p := Payment{Status: tt.from}
+		err := applyTransition(&p, tt.to)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s -> %s error = %v, want %v", tt.from, tt.to, err, tt.err)
+		}
+		want := tt.to
+		if tt.err != nil {
+			want = tt.from
+		}
+		if p.Status != want {
+			t.Errorf("%s -> %s left status %s, want %s", tt.from, tt.to, p.Status, want)
+		}
+	}
+}
+
+func TestEveryStatusHasEvent(t *testing.T) {
+	for _, s := range allPaymentStatuses {
+		if paymentStatusEvents[s] == "" {
+			t.Errorf("%s has no event", s)
+		}
+	}
+}
@@ -0,0 +1,561 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"shared/chaos"
+)
+
+// ============================================================================
+// TRANSACTIONAL OUTBOX (eventos gravados junto com o pagamento)
+// ============================================================================
+
+type OutboxStatus string
+
+const (
+	// Aguardando entrega (ou nova tentativa após backoff)
+	OutboxPending OutboxStatus = "PENDING"
+	// Tentativas esgotadas: bloqueia o agregado até um re-drive manual
+	OutboxStuck OutboxStatus = "STUCK"
+)
+
+var (
+	ErrOutboxEntryNotFound = errors.New("outbox entry not found")
+	// Há eventos anteriores do mesmo pagamento aguardando backoff ou re-drive
+	ErrOutboxBlocked = errors.New("earlier outbox events of the aggregate are not delivered yet")
+)
+
+// OutboxEntry é um evento serializado aguardando confirmação do broker.
+// Seq é global e crescente: a entrega respeita a ordem de Seq por agregado
+type OutboxEntry struct {
+	ID            string          `json:"id"`
+	Seq           int64           `json:"seq"`
+	AggregateID   string          `json:"aggregateId"`
+	Event         string          `json:"event"`
+	Payload       json.RawMessage `json:"payload"`
+	CorrelationID string          `json:"correlationId,omitempty"`
+	TraceID       string          `json:"traceId,omitempty"`
+	// Contexto W3C (traceparent, tracestate, baggage) de quem gerou o evento:
+	// a publicação, mesmo pelo relay, continua o trace da requisição
+	TraceContext  map[string]string `json:"traceContext,omitempty"`
+	CreatedAt     time.Time         `json:"createdAt"`
+	Status        OutboxStatus      `json:"status"`
+	Attempts      int               `json:"attempts"`
+	LastError     string            `json:"lastError,omitempty"`
+	LastAttemptAt *time.Time        `json:"lastAttemptAt,omitempty"`
+	NextAttemptAt time.Time         `json:"nextAttemptAt"`
+}
+
+// OutboxStore é implementado pelo mesmo armazenamento dos pagamentos, para
+// que pagamento e eventos sejam gravados na mesma operação
+type OutboxStore interface {
+	// PendingOutbox retorna as entradas não entregues em ordem de Seq,
+	// filtradas pelo agregado quando aggregateID não é vazio
+	PendingOutbox(ctx context.Context, aggregateID string) ([]OutboxEntry, error)
+	UpdateOutboxEntry(ctx context.Context, e OutboxEntry) error
+	MarkOutboxDelivered(ctx context.Context, id string) error
+}
+
+func newOutboxEntry(ctx context.Context, seq int64, event PaymentEvent) (OutboxEntry, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return OutboxEntry{}, fmt.Errorf("marshal %s: %w", event.Event, err)
+	}
+	traceContext := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, traceContext)
+	now := time.Now()
+	return OutboxEntry{
+		ID:            fmt.Sprintf("evt-%d-%d", now.UnixNano(), rand.Intn(10000)),
+		Seq:           seq,
+		AggregateID:   event.PaymentID,
+		Event:         event.Event,
+		Payload:       payload,
+		CorrelationID: event.CorrelationID,
+		TraceID:       event.TraceID,
+		TraceContext:  traceContext,
+		CreatedAt:     now,
+		Status:        OutboxPending,
+		NextAttemptAt: now,
+	}, nil
+}
+
+// ----------------------------------------------------------------------------
+// Relay: entrega at-least-once, em ordem por pagamento
+// ----------------------------------------------------------------------------
+
+// OutboxRelay publica as entradas pendentes em background. A entrada só é
+// removida após o confirm do broker; o MessageId é o ID da entrada, o que
+// permite aos consumidores descartar duplicatas
+type OutboxRelay struct {
+	store        OutboxStore
+	interval     time.Duration
+	maxAttempts  int
+	concurrency  int
+	baseBackoff  time.Duration
+	maxBackoff   time.Duration
+	aggregateMus keyedMutex
+
+	wake      chan struct{}
+	closeOnce sync.Once
+	closed    chan struct{}
+	done      chan struct{}
+}
+
+func NewOutboxRelay(store OutboxStore, interval time.Duration, maxAttempts, concurrency int) *OutboxRelay {
+	return &OutboxRelay{
+		store:        store,
+		interval:     interval,
+		maxAttempts:  maxAttempts,
+		concurrency:  concurrency,
+		baseBackoff:  time.Second,
+		maxBackoff:   5 * time.Minute,
+		aggregateMus: keyedMutex{locks: make(map[string]*keyedLock)},
+		wake:         make(chan struct{}, 1),
+		closed:       make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+}
+
+// Configuração via OUTBOX_POLL_INTERVAL_MS, OUTBOX_MAX_ATTEMPTS e
+// OUTBOX_RELAY_CONCURRENCY
+func newOutboxRelayFromEnv(store OutboxStore) *OutboxRelay {
+	interval := time.Second
+	if v, err := strconv.Atoi(os.Getenv("OUTBOX_POLL_INTERVAL_MS")); err == nil && v > 0 {
+		interval = time.Duration(v) * time.Millisecond
+	}
+	maxAttempts := 10
+	if v, err := strconv.Atoi(os.Getenv("OUTBOX_MAX_ATTEMPTS")); err == nil && v > 0 {
+		maxAttempts = v
+	}
+	concurrency := 4
+	if v, err := strconv.Atoi(os.Getenv("OUTBOX_RELAY_CONCURRENCY")); err == nil && v > 0 {
+		concurrency = v
+	}
+	return NewOutboxRelay(store, interval, maxAttempts, concurrency)
+}
+
+func (r *OutboxRelay) Start() {
+	go r.run()
+}
+
+func (r *OutboxRelay) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	r.refreshGauges(context.Background())
+	for {
+		select {
+		case <-ticker.C:
+		case <-r.wake:
+		case <-r.closed:
+			return
+		}
+		r.drain(context.Background())
+	}
+}
+
+// Notify antecipa o próximo ciclo do relay (ex: após um re-drive)
+func (r *OutboxRelay) Notify() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Close interrompe o relay após o ciclo em andamento
+func (r *OutboxRelay) Close() {
+	r.closeOnce.Do(func() { close(r.closed) })
+	<-r.done
+}
+
+// drain tenta entregar todos os agregados com eventos pendentes, até
+// `concurrency` agregados em paralelo
+func (r *OutboxRelay) drain(ctx context.Context) {
+	defer r.refreshGauges(ctx)
+
+	entries, err := r.store.PendingOutbox(ctx, "")
+	if err != nil {
+		logger.Error("outbox_load_failed", zap.Error(err))
+		return
+	}
+
+	var aggregates []string
+	seen := make(map[string]bool)
+	now := time.Now()
+	for _, e := range entries {
+		if seen[e.AggregateID] {
+			continue
+		}
+		seen[e.AggregateID] = true
+		// Apenas a primeira entrada de cada agregado pode ser entregue
+		if e.Status == OutboxPending && !e.NextAttemptAt.After(now) {
+			aggregates = append(aggregates, e.AggregateID)
+		}
+	}
+
+	sem := make(chan struct{}, r.concurrency)
+	var wg sync.WaitGroup
+	for _, aggregateID := range aggregates {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(aggregateID string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			r.deliver(ctx, aggregateID)
+		}(aggregateID)
+	}
+	wg.Wait()
+}
+
+// Flush entrega imediatamente os eventos pendentes de um pagamento; usado
+// pelos handlers logo após a gravação. Em caso de erro o relay assume
+func (r *OutboxRelay) Flush(ctx context.Context, aggregateID string) error {
+	return r.deliver(ctx, aggregateID)
+}
+
+// deliver publica em ordem as entradas do agregado, parando na primeira
+// falha para não entregar um evento antes dos anteriores
+func (r *OutboxRelay) deliver(ctx context.Context, aggregateID string) error {
+	unlock := r.aggregateMus.Lock(aggregateID)
+	defer unlock()
+
+	// Relido sob o lock: outra entrega pode ter concluído nesse intervalo
+	entries, err := r.store.PendingOutbox(ctx, aggregateID)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.Status == OutboxStuck || e.NextAttemptAt.After(time.Now()) {
+			return fmt.Errorf("%w: %s %s", ErrOutboxBlocked, e.ID, e.Status)
+		}
+		if err := publishOutboxEntry(ctx, e); err != nil {
+			r.recordFailure(ctx, e, err)
+			return err
+		}
+		outboxDeliveries.WithLabelValues("delivered").Inc()
+		if err := r.store.MarkOutboxDelivered(ctx, e.ID); err != nil {
+			// Publicado mas não marcado: será reenviado (at-least-once)
+			logger.Error("outbox_mark_delivered_failed",
+				zap.String("outbox_id", e.ID),
+				zap.String("payment_id", e.AggregateID),
+				zap.Error(err),
+			)
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *OutboxRelay) recordFailure(ctx context.Context, e OutboxEntry, publishErr error) {
+	now := time.Now()
+	e.Attempts++
+	e.LastError = publishErr.Error()
+	e.LastAttemptAt = &now
+	e.NextAttemptAt = now.Add(r.backoff(e.Attempts))
+
+	result := "failed"
+	if e.Attempts >= r.maxAttempts {
+		e.Status = OutboxStuck
+		result = "stuck"
+		logger.Error("outbox_entry_stuck",
+			zap.String("outbox_id", e.ID),
+			zap.String("payment_id", e.AggregateID),
+			zap.String("event", e.Event),
+			zap.Int("attempts", e.Attempts),
+			zap.String("correlation_id", e.CorrelationID),
+			zap.String("trace_id", e.TraceID),
+			zap.Error(publishErr),
+		)
+	} else {
+		logger.Warn("outbox_delivery_failed",
+			zap.String("outbox_id", e.ID),
+			zap.String("payment_id", e.AggregateID),
+			zap.String("event", e.Event),
+			zap.Int("attempts", e.Attempts),
+			zap.Time("next_attempt_at", e.NextAttemptAt),
+			zap.Error(publishErr),
+		)
+	}
+	outboxDeliveries.WithLabelValues(result).Inc()
+
+	if err := r.store.UpdateOutboxEntry(ctx, e); err != nil {
+		logger.Error("outbox_update_failed", zap.String("outbox_id", e.ID), zap.Error(err))
+	}
+}
+
+// Backoff exponencial com jitter de até 50%, limitado a maxBackoff
+func (r *OutboxRelay) backoff(attempts int) time.Duration {
+	d := r.baseBackoff
+	for i := 1; i < attempts && d < r.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > r.maxBackoff {
+		d = r.maxBackoff
+	}
+	return d + time.Duration(rand.Int63n(int64(d)/2+1))
+}
+
+// Redrive devolve entradas à fila de entrega zerando tentativas e backoff;
+// sem IDs, todas as entradas STUCK são reenviadas
+func (r *OutboxRelay) Redrive(ctx context.Context, ids ...string) (int, error) {
+	entries, err := r.store.PendingOutbox(ctx, "")
+	if err != nil {
+		return 0, err
+	}
+	byID := make(map[string]OutboxEntry, len(entries))
+	for _, e := range entries {
+		byID[e.ID] = e
+	}
+
+	var selected []OutboxEntry
+	if len(ids) == 0 {
+		for _, e := range entries {
+			if e.Status == OutboxStuck {
+				selected = append(selected, e)
+			}
+		}
+	}
+	for _, id := range ids {
+		e, ok := byID[id]
+		if !ok {
+			return 0, fmt.Errorf("%w: %s", ErrOutboxEntryNotFound, id)
+		}
+		selected = append(selected, e)
+	}
+
+	count := 0
+	now := time.Now()
+	for _, e := range selected {
+		e.Status = OutboxPending
+		e.Attempts = 0
+		e.NextAttemptAt = now
+		if err := r.store.UpdateOutboxEntry(ctx, e); err != nil {
+			return count, err
+		}
+		count++
+		logger.Info("outbox_entry_redriven",
+			zap.String("outbox_id", e.ID),
+			zap.String("payment_id", e.AggregateID),
+			zap.String("event", e.Event),
+		)
+	}
+	r.Notify()
+	return count, nil
+}
+
+type outboxStats struct {
+	Pending          int     `json:"pending"`
+	Stuck            int     `json:"stuck"`
+	OldestAgeSeconds float64 `json:"oldestAgeSeconds"`
+}
+
+func computeOutboxStats(entries []OutboxEntry) outboxStats {
+	stats := outboxStats{Pending: len(entries)}
+	var oldest time.Time
+	for _, e := range entries {
+		if e.Status == OutboxStuck {
+			stats.Stuck++
+		}
+		if oldest.IsZero() || e.CreatedAt.Before(oldest) {
+			oldest = e.CreatedAt
+		}
+	}
+	if !oldest.IsZero() {
+		stats.OldestAgeSeconds = time.Since(oldest).Seconds()
+	}
+	return stats
+}
+
+func (r *OutboxRelay) refreshGauges(ctx context.Context) {
+	entries, err := r.store.PendingOutbox(ctx, "")
+	if err != nil {
+		return
+	}
+	stats := computeOutboxStats(entries)
+	outboxPending.Set(float64(stats.Pending))
+	outboxStuck.Set(float64(stats.Stuck))
+	outboxOldestAge.Set(stats.OldestAgeSeconds)
+}
+
+// publishOutboxEntry publica a entrada com o ID como MessageId. Sem span
+// ativo (relay em background), a publicação continua o trace que gerou o
+// evento. Falhas injetadas no estágio publish simulam erro do broker, corpo
+// corrompido, evento perdido (não publicado, mas dado como entregue) ou
+// duplicado
+func publishOutboxEntry(ctx context.Context, e OutboxEntry) error {
+	if !trace.SpanContextFromContext(ctx).IsValid() && len(e.TraceContext) > 0 {
+		ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(e.TraceContext))
+	}
+	ctx = context.WithValue(ctx, "correlation_id", e.CorrelationID)
+	ctx = context.WithValue(ctx, "trace_id", e.TraceID)
+	fault, err := faultInjector.Inject(ctx, faultStagePublish)
+	body := e.Payload
+	switch {
+	case fault == chaos.FaultDrop:
+		return nil
+	case fault == chaos.FaultMalformed:
+		body = e.Payload[:len(e.Payload)/2]
+	case err != nil:
+		return fmt.Errorf("publish %s: %w", e.Event, err)
+	}
+
+	msg := amqp.Publishing{
+		MessageId:    e.ID,
+		Body:         body,
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Type:         e.Event,
+		Timestamp:    e.CreatedAt,
+		Headers: amqp.Table{
+			"X-Correlation-ID": e.CorrelationID,
+			"X-Trace-ID":       e.TraceID,
+		},
+	}
+	copies := 1
+	if fault == chaos.FaultDuplicate {
+		copies = 2
+	}
+	for i := 0; i < copies; i++ {
+		if err := paymentPublisher.Publish(ctx, "payments", "", msg); err != nil {
+			return fmt.Errorf("publish %s: %w", e.Event, err)
+		}
+	}
+	return nil
+}
+
+// keyedMutex serializa as entregas de um mesmo agregado sem bloquear os demais
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	sync.Mutex
+	refs int
+}
+
+func (k *keyedMutex) Lock(key string) (unlock func()) {
+	k.mu.Lock()
+	l, ok := k.locks[key]
+	if !ok {
+		l = &keyedLock{}
+		k.locks[key] = l
+	}
+	l.refs++
+	k.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		k.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
+
+// ----------------------------------------------------------------------------
+// Admin: inspeção e re-drive
+// ----------------------------------------------------------------------------
+
+type OutboxListResponse struct {
+	outboxStats
+	Items []OutboxEntry `json:"items"`
+}
+
+type OutboxRedriveRequest struct {
+	// IDs a reenviar; vazio = todas as entradas STUCK
+	IDs []string `json:"ids"`
+}
+
+type OutboxRedriveResponse struct {
+	Redriven int `json:"redriven"`
+}
+
+// GET /admin/outbox?status=STUCK&paymentId=...&limit=100
+func handleListOutbox(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	status := OutboxStatus(query.Get("status"))
+	limit := 100
+
+	var fieldErrors []FieldError
+	if status != "" && status != OutboxPending && status != OutboxStuck {
+		fieldErrors = append(fieldErrors, FieldError{Field: "status", Code: "invalid_value", Message: "status must be PENDING or STUCK"})
+	}
+	if v := query.Get("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 || limit > 1000 {
+			fieldErrors = append(fieldErrors, FieldError{Field: "limit", Code: "out_of_range", Message: "limit must be between 1 and 1000"})
+		}
+	}
+	if len(fieldErrors) > 0 {
+		problem := newProblem(http.StatusBadRequest, CodeInvalidQuery, "invalid query parameters")
+		problem.Errors = fieldErrors
+		writeProblem(w, r, problem)
+		return
+	}
+
+	entries, err := paymentRepository.PendingOutbox(r.Context(), query.Get("paymentId"))
+	if err != nil {
+		writeProblem(w, r, newProblem(http.StatusInternalServerError, CodeInternalError, "failed to load outbox"))
+		return
+	}
+
+	response := OutboxListResponse{outboxStats: computeOutboxStats(entries), Items: []OutboxEntry{}}
+	for _, e := range entries {
+		if status != "" && e.Status != status {
+			continue
+		}
+		if len(response.Items) == limit {
+			break
+		}
+		response.Items = append(response.Items, e)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// POST /admin/outbox/redrive {"ids": [...]}
+func handleRedriveOutbox(w http.ResponseWriter, r *http.Request) {
+	var req OutboxRedriveRequest
+	if problem := decodeJSONBody(w, r, &req); problem != nil {
+		writeProblem(w, r, problem)
+		return
+	}
+
+	count, err := outboxRelay.Redrive(r.Context(), req.IDs...)
+	switch {
+	case errors.Is(err, ErrOutboxEntryNotFound):
+		writeProblem(w, r, newProblem(http.StatusNotFound, CodeOutboxEntryNotFound, err.Error()))
+		return
+	case err != nil:
+		writeProblem(w, r, newProblem(http.StatusInternalServerError, CodeInternalError, "failed to re-drive outbox entries"))
+		return
+	}
+
+	logger.Info("outbox_redrive_requested",
+		zap.Strings("ids", req.IDs),
+		zap.Int("redriven", count),
+	)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(OutboxRedriveResponse{Redriven: count})
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"shared/problem"
+)
+
+// ============================================================================
+// ERROS HTTP (RFC 7807 - application/problem+json)
+// ============================================================================
+
+// Códigos estáveis: clientes devem decidir pelo campo "code", nunca pelo texto
+const (
+	CodeInvalidJSON            = "invalid_json"
+	CodeUnknownField           = "unknown_field"
+	CodeBodyTooLarge           = "body_too_large"
+	CodeValidationFailed       = "validation_failed"
+	CodeMethodNotAllowed       = "method_not_allowed"
+	CodeInvalidQuery           = "invalid_query"
+	CodeRateLimited            = "rate_limited"
+	CodeDependencyUnavailable  = "dependency_unavailable"
+	CodeDependencyTimeout      = "dependency_timeout"
+	CodeDeadlineExceeded       = "deadline_exceeded"
+	CodeClientClosedRequest    = "client_closed_request"
+	CodePaymentNotFound        = "payment_not_found"
+	CodeIllegalTransition      = "illegal_transition"
+	CodeIdempotencyKeyConflict = "idempotency_key_conflict"
+	CodeRefundNotAllowed       = "refund_not_allowed"
+	CodeRefundExceedsAmount    = "refund_exceeds_amount"
+	CodeOutboxEntryNotFound    = "outbox_entry_not_found"
+	CodeBreakerNotFound        = "breaker_not_found"
+	CodeScenarioConflict       = "scenario_conflict"
+	CodeInternalError          = "internal_error"
+)
+
+// Limite do corpo das requisições JSON
+const maxRequestBodyBytes = 64 << 10
+
+// Problem e FieldError são os tipos comuns de shared/problem, usados também
+// pelas bibliotecas de administração (chaos, messaging, adminauth)
+type (
+	Problem    = problem.Problem
+	FieldError = problem.FieldError
+)
+
+var (
+	newProblem = problem.New
+	// writeProblem inclui correlationId e traceId do contexto da requisição
+	writeProblem = problem.Write
+	// methodNotAllowed responde 405 para métodos não suportados de uma rota
+	methodNotAllowed = problem.MethodNotAllowed
+)
+
+// decodeJSONBody decodifica o corpo de forma estrita: limite de tamanho,
+// campos desconhecidos rejeitados e um único objeto JSON por requisição
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, dst interface{}) *Problem {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodyBytes)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(dst); err != nil {
+		return decodeProblem(err)
+	}
+	if err := dec.Decode(&struct{}{}); err != io.EOF {
+		if err != nil {
+			if p := decodeProblem(err); p.Code == CodeBodyTooLarge {
+				return p
+			}
+		}
+		return newProblem(http.StatusBadRequest, CodeInvalidJSON, "request body must contain a single JSON object")
+	}
+	return nil
+}
+
+func decodeProblem(err error) *Problem {
+	var maxBytesErr *http.MaxBytesError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return newProblem(http.StatusRequestEntityTooLarge, CodeBodyTooLarge,
+			fmt.Sprintf("request body must not exceed %d bytes", maxBytesErr.Limit))
+	case errors.Is(err, io.EOF):
+		return newProblem(http.StatusBadRequest, CodeInvalidJSON, "request body must not be empty")
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return newProblem(http.StatusBadRequest, CodeInvalidJSON, "request body contains malformed JSON")
+	case errors.As(err, &typeErr):
+		p := newProblem(http.StatusBadRequest, CodeInvalidJSON, "request body contains a field with the wrong type")
+		p.Errors = []FieldError{{
+			Field:   typeErr.Field,
+			Code:    "invalid_type",
+			Message: fmt.Sprintf("must be of type %s", typeErr.Type),
+		}}
+		return p
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		p := newProblem(http.StatusBadRequest, CodeUnknownField, fmt.Sprintf("unknown field %q", field))
+		p.Errors = []FieldError{{Field: field, Code: "unknown", Message: "field is not allowed"}}
+		return p
+	}
+	return newProblem(http.StatusBadRequest, CodeInvalidJSON, "request body could not be decoded")
+}
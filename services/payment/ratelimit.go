@@ -0,0 +1,326 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ============================================================================
+// RATE LIMITING (token bucket por chave: global, cliente e conta)
+// ============================================================================
+
+const (
+	rateLimitScopeGlobal  = "global"
+	rateLimitScopeClient  = "client"
+	rateLimitScopeAccount = "account"
+)
+
+// Rótulo usado nas métricas quando o limite de chaves distintas é atingido
+const rateLimitOtherKey = "other"
+
+// RateLimit define a taxa sustentada (tokens/s) e a rajada máxima.
+// Rate <= 0 desabilita o escopo
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+type RateLimitConfig struct {
+	Global  RateLimit
+	Client  RateLimit
+	Account RateLimit
+	// Máximo de buckets mantidos por escopo (client/account)
+	MaxKeys int
+	// Máximo de chaves distintas com série própria nas métricas
+	MetricMaxKeys int
+}
+
+type RateLimitKey struct {
+	Scope string
+	Key   string
+}
+
+// RateLimitDecision descreve o resultado para os headers RateLimit-*
+type RateLimitDecision struct {
+	Allowed    bool
+	Scope      string
+	Key        string
+	Limit      int // 0 = sem limite (escopo desabilitado)
+	Remaining  int
+	Reset      time.Duration // até o bucket encher novamente
+	RetryAfter time.Duration // até haver um token (apenas quando rejeitado)
+}
+
+// restrictive retorna a decisão mais restritiva entre d e o
+func (d RateLimitDecision) restrictive(o RateLimitDecision) RateLimitDecision {
+	switch {
+	case d.Limit == 0:
+		return o
+	case o.Limit == 0:
+		return d
+	case !o.Allowed && d.Allowed:
+		return o
+	case o.Allowed == d.Allowed && o.Remaining < d.Remaining:
+		return o
+	}
+	return d
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// refill acumula tokens proporcionalmente ao tempo decorrido
+func (b *tokenBucket) refill(limit RateLimit, now time.Time) {
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+}
+
+// scopeLimiter mantém os buckets do escopo em ordem de uso (LRU): o mais
+// recente na frente, o candidato a descarte no fim
+type scopeLimiter struct {
+	scope   string
+	limit   RateLimit
+	maxKeys int
+
+	mu      sync.Mutex
+	buckets map[string]*list.Element // valor: *keyedBucket
+	lru     *list.List
+	labels  *boundedLabels
+}
+
+type keyedBucket struct {
+	key string
+	tokenBucket
+}
+
+func newScopeLimiter(scope string, limit RateLimit, maxKeys, metricMaxKeys int) *scopeLimiter {
+	if limit.Burst <= 0 {
+		limit.Burst = int(math.Max(1, math.Ceil(limit.Rate)))
+	}
+	if maxKeys < 1 {
+		maxKeys = 1
+	}
+	return &scopeLimiter{
+		scope:   scope,
+		limit:   limit,
+		maxKeys: maxKeys,
+		buckets: make(map[string]*list.Element),
+		lru:     list.New(),
+		labels:  newBoundedLabels(metricMaxKeys),
+	}
+}
+
+func (s *scopeLimiter) allow(key string, now time.Time) RateLimitDecision {
+	if s.limit.Rate <= 0 {
+		return RateLimitDecision{Allowed: true, Scope: s.scope, Key: key}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var b *keyedBucket
+	if el, ok := s.buckets[key]; ok {
+		s.lru.MoveToFront(el)
+		b = el.Value.(*keyedBucket)
+	} else {
+		// Cheio: descarta o bucket usado há mais tempo (O(1))
+		if s.lru.Len() >= s.maxKeys {
+			oldest := s.lru.Back()
+			s.lru.Remove(oldest)
+			delete(s.buckets, oldest.Value.(*keyedBucket).key)
+		}
+		b = &keyedBucket{key: key, tokenBucket: tokenBucket{tokens: float64(s.limit.Burst), last: now}}
+		s.buckets[key] = s.lru.PushFront(b)
+		rateLimitTrackedKeys.WithLabelValues(s.scope).Set(float64(s.lru.Len()))
+	}
+	b.refill(s.limit, now)
+
+	decision := RateLimitDecision{Scope: s.scope, Key: key, Limit: s.limit.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		decision.Allowed = true
+	} else {
+		decision.RetryAfter = secondsToDuration((1 - b.tokens) / s.limit.Rate)
+	}
+	decision.Remaining = int(b.tokens)
+	decision.Reset = secondsToDuration((float64(s.limit.Burst) - b.tokens) / s.limit.Rate)
+	return decision
+}
+
+// release devolve o token consumido por uma requisição que acabou
+// rejeitada em outro escopo
+func (s *scopeLimiter) release(key string) {
+	if s.limit.Rate <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.buckets[key]; ok {
+		b := el.Value.(*keyedBucket)
+		b.tokens = math.Min(float64(s.limit.Burst), b.tokens+1)
+	}
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// boundedLabels limita a cardinalidade das séries por chave: as primeiras
+// N chaves ganham série própria, as demais são agregadas em "other"
+type boundedLabels struct {
+	mu   sync.Mutex
+	max  int
+	seen map[string]struct{}
+}
+
+func newBoundedLabels(max int) *boundedLabels {
+	return &boundedLabels{max: max, seen: make(map[string]struct{})}
+}
+
+func (l *boundedLabels) label(key string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.seen[key]; ok {
+		return key
+	}
+	if len(l.seen) >= l.max {
+		return rateLimitOtherKey
+	}
+	l.seen[key] = struct{}{}
+	return key
+}
+
+// RateLimiter é único por processo e mantém os buckets entre requisições
+type RateLimiter struct {
+	scopes map[string]*scopeLimiter
+}
+
+func NewRateLimiter(cfg RateLimitConfig) *RateLimiter {
+	return &RateLimiter{
+		scopes: map[string]*scopeLimiter{
+			rateLimitScopeGlobal:  newScopeLimiter(rateLimitScopeGlobal, cfg.Global, 1, 1),
+			rateLimitScopeClient:  newScopeLimiter(rateLimitScopeClient, cfg.Client, cfg.MaxKeys, cfg.MetricMaxKeys),
+			rateLimitScopeAccount: newScopeLimiter(rateLimitScopeAccount, cfg.Account, cfg.MaxKeys, cfg.MetricMaxKeys),
+		},
+	}
+}
+
+// Configuração via RATE_LIMIT_{GLOBAL,CLIENT,ACCOUNT}_RPS e _BURST,
+// RATE_LIMIT_MAX_KEYS e RATE_LIMIT_METRIC_MAX_KEYS
+func newRateLimiterFromEnv() *RateLimiter {
+	cfg := RateLimitConfig{
+		Global:        rateLimitFromEnv("GLOBAL", RateLimit{Rate: 100, Burst: 100}),
+		Client:        rateLimitFromEnv("CLIENT", RateLimit{Rate: 50, Burst: 50}),
+		Account:       rateLimitFromEnv("ACCOUNT", RateLimit{Rate: 10, Burst: 20}),
+		MaxKeys:       10000,
+		MetricMaxKeys: 50,
+	}
+	if v, err := strconv.Atoi(os.Getenv("RATE_LIMIT_MAX_KEYS")); err == nil && v > 0 {
+		cfg.MaxKeys = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("RATE_LIMIT_METRIC_MAX_KEYS")); err == nil && v >= 0 {
+		cfg.MetricMaxKeys = v
+	}
+	logger.Info("rate_limiter_configured",
+		zap.Float64("global_rps", cfg.Global.Rate),
+		zap.Int("global_burst", cfg.Global.Burst),
+		zap.Float64("client_rps", cfg.Client.Rate),
+		zap.Int("client_burst", cfg.Client.Burst),
+		zap.Float64("account_rps", cfg.Account.Rate),
+		zap.Int("account_burst", cfg.Account.Burst),
+	)
+	return NewRateLimiter(cfg)
+}
+
+func rateLimitFromEnv(scope string, def RateLimit) RateLimit {
+	limit := def
+	if v, err := strconv.ParseFloat(os.Getenv("RATE_LIMIT_"+scope+"_RPS"), 64); err == nil && v >= 0 {
+		limit.Rate = v
+		limit.Burst = 0 // sem _BURST explícito, rajada = 1s de taxa
+	}
+	if v, err := strconv.Atoi(os.Getenv("RATE_LIMIT_" + scope + "_BURST")); err == nil && v > 0 {
+		limit.Burst = v
+	}
+	return limit
+}
+
+// Allow consome um token de cada escopo, na ordem informada, e para no
+// primeiro que rejeitar, devolvendo os tokens já consumidos nos anteriores
+// (uma requisição rejeitada não gasta o orçamento global). Retorna a
+// decisão mais restritiva
+func (rl *RateLimiter) Allow(keys ...RateLimitKey) RateLimitDecision {
+	now := time.Now()
+	decision := RateLimitDecision{Allowed: true}
+	for i, k := range keys {
+		decision = decision.restrictive(rl.allow(k, now))
+		if !decision.Allowed {
+			rl.Release(keys[:i]...)
+			break
+		}
+	}
+	return decision
+}
+
+// Release devolve um token a cada escopo informado; usado quando um escopo
+// verificado depois (ex: conta) rejeita a requisição
+func (rl *RateLimiter) Release(keys ...RateLimitKey) {
+	for _, k := range keys {
+		rl.scopes[k.Scope].release(k.Key)
+	}
+}
+
+func (rl *RateLimiter) allow(k RateLimitKey, now time.Time) RateLimitDecision {
+	s := rl.scopes[k.Scope]
+	decision := s.allow(k.Key, now)
+	if !decision.Allowed {
+		rateLimitRejected.WithLabelValues(k.Scope).Inc()
+		rateLimitRejectedByKey.WithLabelValues(k.Scope, s.labels.label(k.Key)).Inc()
+	}
+	return decision
+}
+
+// setRateLimitHeaders publica RateLimit-Limit/Remaining/Reset (segundos) e,
+// quando rejeitado, Retry-After
+func setRateLimitHeaders(w http.ResponseWriter, d RateLimitDecision) {
+	if d.Limit == 0 {
+		return
+	}
+	h := w.Header()
+	h.Set("RateLimit-Limit", strconv.Itoa(d.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(d.Reset)))
+	if !d.Allowed {
+		h.Set("Retry-After", strconv.Itoa(ceilSeconds(d.RetryAfter)))
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// writeRateLimited responde 429 com os headers de rate limit
+func writeRateLimited(w http.ResponseWriter, r *http.Request, d RateLimitDecision) {
+	ctx := r.Context()
+	correlationID, _ := ctx.Value("correlation_id").(string)
+	traceID, _ := ctx.Value("trace_id").(string)
+	logger.Warn("rate_limit_exceeded",
+		zap.String("scope", d.Scope),
+		zap.String("key", d.Key),
+		zap.Duration("retry_after", d.RetryAfter),
+		zap.String("correlation_id", correlationID),
+		zap.String("trace_id", traceID),
+	)
+	setRateLimitHeaders(w, d)
+	writeProblem(w, r, newProblem(http.StatusTooManyRequests, CodeRateLimited,
+		fmt.Sprintf("%s rate limit exceeded", d.Scope)))
+}
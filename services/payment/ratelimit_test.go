@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketRefill(t *testing.T) {
+	limit := RateLimit{Rate: 10, Burst: 5}
+	start := time.Unix(0, 0)
+	tests := []struct {
+		name    string
+		tokens  float64
+		elapsed time.Duration
+		want    float64
+	}{
+		{"no time elapsed", 2, 0, 2},
+		{"partial refill", 0, 150 * time.Millisecond, 1.5},
+		{"one second refills the burst", 0, time.Second, 5},
+		{"capped at burst", 4, time.Hour, 5},
+		{"already full", 5, 100 * time.Millisecond, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := tokenBucket{tokens: tt.tokens, last: start}
+			b.refill(limit, start.Add(tt.elapsed))
+			if diff := b.tokens - tt.want; diff > 1e-9 || diff < -1e-9 {
+				t.Fatalf("tokens = %v, want %v", b.tokens, tt.want)
+			}
+			if !b.last.Equal(start.Add(tt.elapsed)) {
+				t.Fatalf("last = %v, want %v", b.last, start.Add(tt.elapsed))
+			}
+		})
+	}
+}
+
+func TestScopeLimiterAllow(t *testing.T) {
+	s := newScopeLimiter("client", RateLimit{Rate: 2, Burst: 3}, 10, 10)
+	now := time.Unix(100, 0)
+
+	for i := 0; i < 3; i++ {
+		if d := s.allow("a", now); !d.Allowed || d.Remaining != 2-i {
+			t.Fatalf("request %d: allowed=%v remaining=%d", i, d.Allowed, d.Remaining)
+		}
+	}
+	d := s.allow("a", now)
+	if d.Allowed {
+		t.Fatal("burst exhausted but request allowed")
+	}
+	if d.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("RetryAfter = %v, want 500ms", d.RetryAfter)
+	}
+	if d.Reset != 1500*time.Millisecond {
+		t.Fatalf("Reset = %v, want 1.5s", d.Reset)
+	}
+	if d := s.allow("a", now.Add(500*time.Millisecond)); !d.Allowed {
+		t.Fatal("token refilled after RetryAfter but request rejected")
+	}
+	if d := s.allow("b", now); !d.Allowed || d.Remaining != 2 {
+		t.Fatalf("other key shares bucket: allowed=%v remaining=%d", d.Allowed, d.Remaining)
+	}
+}
+
+func TestScopeLimiterEvictsLeastRecentlyUsed(t *testing.T) {
+	s := newScopeLimiter("client", RateLimit{Rate: 1, Burst: 1}, 2, 2)
+	now := time.Unix(100, 0)
+
+	s.allow("a", now)
+	s.allow("b", now)
+	s.allow("a", now) // "a" volta a ser o mais recente
+	s.allow("c", now) // descarta "b"
+
+	if _, ok := s.buckets["b"]; ok {
+		t.Fatal("least recently used key was not evicted")
+	}
+	if _, ok := s.buckets["a"]; !ok {
+		t.Fatal("recently used key was evicted")
+	}
+	if s.lru.Len() != 2 || len(s.buckets) != 2 {
+		t.Fatalf("tracked keys = %d/%d, want 2", s.lru.Len(), len(s.buckets))
+	}
+}
+
+func TestRateLimiterReleasesEarlierScopesOnRejection(t *testing.T) {
+	rl := NewRateLimiter(RateLimitConfig{
+		Global:  RateLimit{Rate: 1, Burst: 2},
+		Client:  RateLimit{Rate: 1, Burst: 1},
+		MaxKeys: 10, MetricMaxKeys: 10,
+	})
+	global := RateLimitKey{Scope: rateLimitScopeGlobal, Key: rateLimitScopeGlobal}
+	client := func(k string) RateLimitKey { return RateLimitKey{Scope: rateLimitScopeClient, Key: k} }
+
+	if d := rl.Allow(global, client("a")); !d.Allowed {
+		t.Fatal("first request rejected")
+	}
+	// Rejeitada pelo cliente: o token global consumido é devolvido
+	for i := 0; i < 5; i++ {
+		if d := rl.Allow(global, client("a")); d.Allowed || d.Scope != rateLimitScopeClient {
+			t.Fatalf("request %d: allowed=%v scope=%s, want rejected by client", i, d.Allowed, d.Scope)
+		}
+	}
+	if d := rl.Allow(global, client("b")); !d.Allowed {
+		t.Fatalf("global budget consumed by rejected requests: %+v", d)
+	}
+
+	// Release explícito (rejeição por um escopo verificado depois)
+	rl.Release(global, client("b"))
+	if d := rl.Allow(global, client("b")); !d.Allowed {
+		t.Fatalf("released tokens not returned: %+v", d)
+	}
+}
+
+func TestClientIdentity(t *testing.T) {
+	apiKeys = &apiKeyRegistry{clients: parseAPIKeys("loja-a:segredo-a")}
+	defer func() { apiKeys = newAPIKeyRegistryFromEnv() }()
+
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   string
+	}{
+		{"remote address", nil, "ip:10.0.0.1"},
+		{"valid api key", map[string]string{"Authorization": "Bearer segredo-a"}, "key:loja-a"},
+		{"unknown api key", map[string]string{"Authorization": "Bearer outro"}, "ip:10.0.0.1"},
+		{"client-supplied header is ignored", map[string]string{"X-Client-ID": "spoofed"}, "ip:10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/payments", nil)
+			r.RemoteAddr = "10.0.0.1:5555"
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			if got := clientIdentity(r); got != tt.want {
+				t.Fatalf("clientIdentity = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+
+	"shared/money"
+)
+
+// ============================================================================
+// ESTORNOS (totais e parciais)
+// ============================================================================
+
+type Refund struct {
+	ID             string      `json:"refundId"`
+	Amount         money.Money `json:"amount"`
+	Reason         string      `json:"reason,omitempty"`
+	IdempotencyKey string      `json:"idempotencyKey,omitempty"`
+	// Fingerprint da requisição original (cliente, rota e corpo): a mesma
+	// chave com outra requisição é rejeitada em vez de repetida
+	RequestFingerprint string    `json:"requestFingerprint,omitempty"`
+	CreatedAt          time.Time `json:"createdAt"`
+}
+
+type RefundRequest struct {
+	// Valor a estornar na moeda do pagamento; omitido = estorno total do
+	// saldo restante
+	Amount json.RawMessage `json:"amount"`
+	Reason string          `json:"reason"`
+}
+
+type RefundResponse struct {
+	Refund
+	PaymentID       string        `json:"paymentId"`
+	PaymentStatus   PaymentStatus `json:"paymentStatus"`
+	RefundedAmount  money.Money   `json:"refundedAmount"`
+	RemainingAmount money.Money   `json:"remainingAmount"`
+	EventStatus     string        `json:"eventStatus"`
+}
+
+var (
+	ErrPaymentNotRefundable = errors.New("payment is not in a refundable state")
+	ErrRefundExceedsAmount  = errors.New("refund exceeds remaining captured amount")
+
+	// Sinaliza (internamente) que o estorno já existe para a Idempotency-Key
+	errRefundAlreadyApplied = errors.New("refund already applied")
+	// A Idempotency-Key já gerou um estorno a partir de outra requisição
+	errRefundKeyConflict = errors.New("idempotency key was already used with a different refund request")
+)
+
+// refundAmountError carrega o erro de campo do valor do estorno, que só pode
+// ser validado dentro da atualização atômica (a moeda vem do pagamento)
+type refundAmountError struct {
+	fieldErr FieldError
+}
+
+func (e *refundAmountError) Error() string {
+	return "invalid refund amount: " + e.fieldErr.Message
+}
+
+func generateRefundID() string {
+	return fmt.Sprintf("ref-%d-%d", time.Now().UnixNano(), rand.Intn(10000))
+}
+
+func newRefundResponse(payment Payment, refund Refund) RefundResponse {
+	remaining, _ := payment.Amount.Sub(payment.RefundedAmount)
+	return RefundResponse{
+		Refund:          refund,
+		PaymentID:       payment.ID,
+		PaymentStatus:   payment.Status,
+		RefundedAmount:  payment.RefundedAmount,
+		RemainingAmount: remaining,
+	}
+}
+
+// replayRefund remonta a resposta de POST /payments/{id}/refunds a partir
+// do estorno gravado com a Idempotency-Key, no mesmo formato do 201 original
+func replayRefund(ctx context.Context, rec IdempotencyRecord) (int, interface{}, error) {
+	payment, err := paymentRepository.Get(ctx, rec.ResourceID)
+	if err != nil {
+		return 0, nil, err
+	}
+	for _, refund := range payment.Refunds {
+		if refund.IdempotencyKey == rec.Key && refund.RequestFingerprint == rec.Fingerprint {
+			response := newRefundResponse(payment, refund)
+			if response.EventStatus, err = outboxEventStatus(ctx, payment.ID); err != nil {
+				return 0, nil, err
+			}
+			return http.StatusCreated, response, nil
+		}
+	}
+	return 0, nil, fmt.Errorf("refund for Idempotency-Key %q not found in payment %s", rec.Key, payment.ID)
+}
+
+// applyRefund valida e registra o estorno no pagamento (saldo estornado e,
+// quando o saldo zera, a transição para REFUNDED); deve ser chamada dentro
+// de PaymentRepository.Update. Uma Idempotency-Key já usada retorna o
+// estorno existente com errRefundAlreadyApplied
+func applyRefund(p *Payment, req RefundRequest, idempotencyKey, fingerprint string) (Refund, error) {
+	if idempotencyKey != "" {
+		for _, existing := range p.Refunds {
+			if existing.IdempotencyKey != idempotencyKey {
+				continue
+			}
+			if existing.RequestFingerprint != fingerprint {
+				return Refund{}, errRefundKeyConflict
+			}
+			return existing, errRefundAlreadyApplied
+		}
+	}
+
+	if !isRefundable(p.Status) {
+		return Refund{}, fmt.Errorf("%w: status %s", ErrPaymentNotRefundable, p.Status)
+	}
+
+	remaining, err := p.Amount.Sub(p.RefundedAmount)
+	if err != nil {
+		return Refund{}, err
+	}
+	amount := remaining
+	if len(req.Amount) > 0 && string(req.Amount) != "null" {
+		// O valor do estorno é interpretado na moeda do pagamento
+		var fieldErr *FieldError
+		if amount, fieldErr = validateAmount("amount", req.Amount, p.Amount.Currency()); fieldErr != nil {
+			return Refund{}, &refundAmountError{fieldErr: *fieldErr}
+		}
+	}
+	if cmp, _ := amount.Cmp(remaining); cmp > 0 {
+		return Refund{}, fmt.Errorf("%w: requested %s, remaining %s", ErrRefundExceedsAmount, amount, remaining)
+	}
+
+	refund := Refund{
+		ID:                 generateRefundID(),
+		Amount:             amount,
+		Reason:             req.Reason,
+		IdempotencyKey:     idempotencyKey,
+		RequestFingerprint: fingerprint,
+		CreatedAt:          time.Now(),
+	}
+	p.Refunds = append(p.Refunds, refund)
+	p.RefundedAmount, _ = p.RefundedAmount.Add(amount)
+	p.UpdatedAt = refund.CreatedAt
+
+	// Saldo zerado: estorno total encerra o ciclo de vida
+	if cmp, _ := amount.Cmp(remaining); cmp == 0 {
+		if err := applyTransition(p, StatusRefunded); err != nil {
+			return Refund{}, err
+		}
+	}
+	return refund, nil
+}
+
+func isRefundable(status PaymentStatus) bool {
+	return status == StatusCaptured || status == StatusSettled
+}
+
+func handleRefund(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	ctx, span := tracer.Start(r.Context(), "refund.process")
+	defer span.End()
+
+	correlationID := ctx.Value("correlation_id").(string)
+	traceID := ctx.Value("trace_id").(string)
+	paymentID := r.PathValue("id")
+	idempotencyKey := r.Header.Get(idempotencyKeyHeader)
+	var fingerprint string
+	if res := idempotencyReservationFrom(ctx); res != nil {
+		fingerprint = res.fingerprint
+	}
+	span.SetAttributes(attribute.String("payment.id", paymentID))
+
+	result := "error"
+	defer func() {
+		refundRequestsTotal.WithLabelValues(result).Inc()
+		refundDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+		span.SetAttributes(attribute.String("refund.result", result))
+	}()
+
+	fail := func(err error, problem *Problem) {
+		if problem.Status >= 500 {
+			span.SetStatus(codes.Error, problem.Detail)
+		}
+		span.RecordError(err)
+		logger.Warn("refund_rejected",
+			zap.String("payment_id", paymentID),
+			zap.String("correlation_id", correlationID),
+			zap.String("trace_id", traceID),
+			zap.Int("status", problem.Status),
+			zap.String("code", problem.Code),
+			zap.Error(err),
+		)
+		writeProblem(w, r, problem)
+	}
+
+	var req RefundRequest
+	if problem := decodeJSONBody(w, r, &req); problem != nil {
+		result = "rejected"
+		fail(problem, problem)
+		return
+	}
+	if fieldErr := validateReason(req.Reason); fieldErr != nil {
+		result = "rejected"
+		problem := validationProblem([]FieldError{*fieldErr})
+		fail(problem, problem)
+		return
+	}
+
+	// Validar e registrar o estorno de forma atômica no repositório
+	_, persistSpan := tracer.Start(ctx, "refund.persist")
+	var refund Refund
+	var from PaymentStatus
+	payment, err := paymentRepository.Update(ctx, paymentID, func(p *Payment) ([]PaymentEvent, error) {
+		from = p.Status
+		var err error
+		if refund, err = applyRefund(p, req, idempotencyKey, fingerprint); err != nil {
+			return nil, err
+		}
+		amount := refund.Amount
+
+		// PaymentRefunded (um evento por estorno, parcial ou total) gravado
+		// no outbox junto com o estorno
+		refundedTotal := p.RefundedAmount
+		event := newPaymentEvent(*p)
+		event.Event = "PaymentRefunded"
+		if p.Status != from {
+			event.PreviousStatus = from
+		}
+		event.Reason = refund.Reason
+		event.RefundID = refund.ID
+		event.RefundAmount = &amount
+		event.RefundedTotal = &refundedTotal
+		event.CorrelationID = correlationID
+		event.TraceID = traceID
+		return []PaymentEvent{event}, nil
+	})
+	persistSpan.End()
+
+	replayed := errors.Is(err, errRefundAlreadyApplied)
+	if replayed {
+		payment, err = paymentRepository.Get(ctx, paymentID)
+	}
+	var amountErr *refundAmountError
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrPaymentNotFound):
+		result = "rejected"
+		fail(err, newProblem(http.StatusNotFound, CodePaymentNotFound, "payment not found"))
+		return
+	case errors.Is(err, errRefundKeyConflict):
+		result = "rejected"
+		idempotencyConflicts.WithLabelValues("fingerprint_mismatch").Inc()
+		fail(err, newProblem(http.StatusUnprocessableEntity, CodeIdempotencyKeyConflict, err.Error()))
+		return
+	case errors.As(err, &amountErr):
+		result = "rejected"
+		fail(err, validationProblem([]FieldError{amountErr.fieldErr}))
+		return
+	case errors.Is(err, ErrPaymentNotRefundable), errors.Is(err, ErrIllegalTransition):
+		result = "rejected"
+		fail(err, newProblem(http.StatusConflict, CodeRefundNotAllowed, err.Error()))
+		return
+	case errors.Is(err, ErrRefundExceedsAmount):
+		result = "rejected"
+		fail(err, newProblem(http.StatusUnprocessableEntity, CodeRefundExceedsAmount, err.Error()))
+		return
+	default:
+		fail(err, newProblem(http.StatusInternalServerError, CodeInternalError, "failed to refund payment"))
+		return
+	}
+
+	span.SetAttributes(
+		attribute.String("refund.id", refund.ID),
+		attribute.String("refund.amount", refund.Amount.Decimal()),
+		attribute.String("refund.currency", refund.Amount.Currency()),
+		attribute.Bool("refund.replayed", replayed),
+	)
+
+	response := newRefundResponse(payment, refund)
+
+	if replayed {
+		result = "replayed"
+		if response.EventStatus, err = outboxEventStatus(ctx, payment.ID); err != nil {
+			response.EventStatus = EventStatusUnconfirmed
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	result = "partial"
+	if payment.Status == StatusRefunded {
+		result = "full"
+		recordTransition(payment, from, refund.Reason)
+	}
+	refundAmount.WithLabelValues(refund.Amount.Currency()).Observe(refund.Amount.Float64())
+
+	// Entregar PaymentRefunded já gravado no outbox; falhas ficam com o relay
+	publishCtx, publishSpan := tracer.Start(ctx, "refund.publish")
+	publishErr := outboxRelay.Flush(publishCtx, payment.ID)
+	if publishErr != nil {
+		publishSpan.RecordError(publishErr)
+		logger.Warn("payment_event_delivery_deferred",
+			zap.String("payment_id", payment.ID),
+			zap.String("refund_id", refund.ID),
+			zap.String("correlation_id", correlationID),
+			zap.String("trace_id", traceID),
+			zap.Error(publishErr),
+		)
+	}
+	publishSpan.End()
+	response.EventStatus = eventStatus(publishErr)
+
+	logger.Info("payment_refunded",
+		zap.String("payment_id", payment.ID),
+		zap.String("refund_id", refund.ID),
+		zap.String("amount", refund.Amount.Decimal()),
+		zap.String("refunded_total", payment.RefundedAmount.Decimal()),
+		zap.String("currency", refund.Amount.Currency()),
+		zap.String("payment_status", string(payment.Status)),
+		zap.String("correlation_id", correlationID),
+		zap.String("trace_id", traceID),
+		zap.String("status", result),
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Correlation-ID", correlationID)
+	w.Header().Set("X-Trace-ID", traceID)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
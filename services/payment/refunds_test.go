@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"shared/money"
+)
+
+func capturedPayment(t *testing.T, minor int64, currency string) Payment {
+	t.Helper()
+	amount, err := money.New(minor, currency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zero, _ := money.Zero(currency)
+	return Payment{ID: "pay-1", Amount: amount, Status: StatusCaptured, RefundedAmount: zero}
+}
+
+func TestApplyRefund(t *testing.T) {
+	type step struct {
+		amount       string // "" = saldo restante
+		err          error
+		wantRefunded int64
+		wantStatus   PaymentStatus
+	}
+	tests := []struct {
+		name     string
+		currency string
+		total    int64
+		steps    []step
+	}{
+		{"full refund of the balance", "BRL", 10050, []step{
+			{"", nil, 10050, StatusRefunded},
+		}},
+		{"partial then remaining", "BRL", 10000, []step{
+			{"30.25", nil, 3025, StatusCaptured},
+			{"", nil, 10000, StatusRefunded},
+		}},
+		{"partials adding up to the total", "USD", 1000, []step{
+			{"4", nil, 400, StatusCaptured},
+			{"6.00", nil, 1000, StatusRefunded},
+		}},
+		{"exceeding the remaining balance", "BRL", 1000, []step{
+			{"7", nil, 700, StatusCaptured},
+			{"3.01", ErrRefundExceedsAmount, 700, StatusCaptured},
+		}},
+		{"after full refund", "BRL", 1000, []step{
+			{"", nil, 1000, StatusRefunded},
+			{"1", ErrPaymentNotRefundable, 1000, StatusRefunded},
+		}},
+		{"currency exponent of the payment", "JPY", 1500, []step{
+			{"0.5", &refundAmountError{}, 0, StatusCaptured},
+			{"500", nil, 500, StatusCaptured},
+		}},
+		{"three-decimal currency", "KWD", 1000, []step{
+			{"0.001", nil, 1, StatusCaptured},
+			{"0.999", nil, 1000, StatusRefunded},
+		}},
+		{"zero amount", "BRL", 1000, []step{
+			{"0", &refundAmountError{}, 0, StatusCaptured},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := capturedPayment(t, tt.total, tt.currency)
+			for i, s := range tt.steps {
+				req := RefundRequest{}
+				if s.amount != "" {
+					req.Amount = json.RawMessage(s.amount)
+				}
+				_, err := applyRefund(&p, req, "", "")
+				var amountErr *refundAmountError
+				switch want := s.err.(type) {
+				case nil:
+					if err != nil {
+						t.Fatalf("step %d: unexpected error %v", i, err)
+					}
+				case *refundAmountError:
+					if !errors.As(err, &amountErr) {
+						t.Fatalf("step %d: error = %v, want invalid amount", i, err)
+					}
+				default:
+					if !errors.Is(err, want) {
+						t.Fatalf("step %d: error = %v, want %v", i, err, want)
+					}
+				}
+				if p.RefundedAmount.Minor() != s.wantRefunded || p.Status != s.wantStatus {
+					t.Fatalf("step %d: refunded %d status %s, want %d %s", i, p.RefundedAmount.Minor(), p.Status, s.wantRefunded, s.wantStatus)
+				}
+			}
+			var sum int64
+			for _, r := range p.Refunds {
+				sum += r.Amount.Minor()
+			}
+			if sum != p.RefundedAmount.Minor() {
+				t.Fatalf("refunds add up to %d, refundedAmount is %d", sum, p.RefundedAmount.Minor())
+			}
+		})
+	}
+}
+
+func TestApplyRefundIdempotencyKey(t *testing.T) {
+	p := capturedPayment(t, 10000, "BRL")
+	first, err := applyRefund(&p, RefundRequest{Amount: json.RawMessage("10")}, "key-1", "fp-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replayed, err := applyRefund(&p, RefundRequest{Amount: json.RawMessage("10")}, "key-1", "fp-a")
+	if !errors.Is(err, errRefundAlreadyApplied) || replayed.ID != first.ID {
+		t.Fatalf("replay = %s, %v; want %s, %v", replayed.ID, err, first.ID, errRefundAlreadyApplied)
+	}
+
+	if _, err := applyRefund(&p, RefundRequest{Amount: json.RawMessage("20")}, "key-1", "fp-b"); !errors.Is(err, errRefundKeyConflict) {
+		t.Fatalf("different request with same key error = %v, want %v", err, errRefundKeyConflict)
+	}
+
+	if len(p.Refunds) != 1 || p.RefundedAmount.Minor() != 1000 {
+		t.Fatalf("refunds = %d, refunded = %d; want 1 refund of 1000", len(p.Refunds), p.RefundedAmount.Minor())
+	}
+}
+
+func TestReplayRefundMatchesOriginalResponse(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryPaymentRepository()
+	previous := paymentRepository
+	paymentRepository = repo
+	t.Cleanup(func() { paymentRepository = previous })
+
+	p := capturedPayment(t, 10000, "BRL")
+	refund, err := applyRefund(&p, RefundRequest{Amount: json.RawMessage("10")}, "key-1", "fp-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Create(ctx, p, newPaymentEvent(p)); err != nil {
+		t.Fatal(err)
+	}
+	rec := IdempotencyRecord{Key: "key-1", Fingerprint: "fp-a", ResourceID: p.ID}
+
+	replay := func() RefundResponse {
+		t.Helper()
+		status, body, err := replayRefund(ctx, rec)
+		if err != nil || status != http.StatusCreated {
+			t.Fatalf("replayRefund = %d, %v", status, err)
+		}
+		response, ok := body.(RefundResponse)
+		if !ok {
+			t.Fatalf("replayRefund body = %T, want RefundResponse", body)
+		}
+		if response.ID != refund.ID {
+			t.Fatalf("refund id = %s, want %s", response.ID, refund.ID)
+		}
+		return response
+	}
+
+	// Evento ainda no outbox: o replay informa UNCONFIRMED, como o 201
+	if got := replay().EventStatus; got != EventStatusUnconfirmed {
+		t.Fatalf("eventStatus with pending outbox = %q, want %q", got, EventStatusUnconfirmed)
+	}
+	pending, _ := repo.PendingOutbox(ctx, p.ID)
+	for _, e := range pending {
+		repo.MarkOutboxDelivered(ctx, e.ID)
+	}
+	response := replay()
+	if response.EventStatus != EventStatusConfirmed {
+		t.Fatalf("eventStatus after delivery = %q, want %q", response.EventStatus, EventStatusConfirmed)
+	}
+
+	raw, _ := json.Marshal(response)
+	var fields map[string]json.RawMessage
+	json.Unmarshal(raw, &fields)
+	for _, key := range []string{"refundId", "paymentId", "paymentStatus", "refundedAmount", "remainingAmount", "eventStatus"} {
+		if _, ok := fields[key]; !ok {
+			t.Errorf("replayed response missing %q: %s", key, raw)
+		}
+	}
+}
@@ -0,0 +1,816 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"shared/money"
+)
+
+// ============================================================================
+// ARMAZENAMENTO DE PAGAMENTOS (Repository)
+// ============================================================================
+
+var ErrPaymentNotFound = errors.New("payment not found")
+
+// Payment é o registro persistido de um pagamento
+type Payment struct {
+	ID            string        `json:"paymentId"`
+	AccountID     string        `json:"accountId"`
+	Amount        money.Money   `json:"amount"`
+	Status        PaymentStatus `json:"status"`
+	CorrelationID string        `json:"correlationId,omitempty"`
+	TraceID       string        `json:"traceId,omitempty"`
+	CreatedAt     time.Time     `json:"createdAt"`
+	UpdatedAt     time.Time     `json:"updatedAt"`
+
+	// Estornos aplicados (parciais ou total)
+	RefundedAmount money.Money `json:"refundedAmount"`
+	Refunds        []Refund    `json:"refunds,omitempty"`
+}
+
+// PaymentFilter define os filtros e a paginação da listagem
+type PaymentFilter struct {
+	AccountID string
+	Status    string
+	From      time.Time // inclusivo
+	To        time.Time // exclusivo
+	Cursor    string
+	Limit     int
+}
+
+const (
+	defaultListLimit = 50
+	maxListLimit     = 200
+)
+
+// PaymentRepository grava cada alteração junto com os eventos que ela gera
+// (transactional outbox): ou ambos são persistidos, ou nenhum
+type PaymentRepository interface {
+	Create(ctx context.Context, p Payment, events ...PaymentEvent) error
+	Get(ctx context.Context, id string) (Payment, error)
+	// Update aplica fn ao registro de forma atômica e enfileira no outbox os
+	// eventos retornados; se fn retornar erro, nada é gravado e o erro é
+	// repassado ao chamador
+	Update(ctx context.Context, id string, fn func(p *Payment) ([]PaymentEvent, error)) (Payment, error)
+	CountByStatus(ctx context.Context) (map[PaymentStatus]int, error)
+	// List retorna os pagamentos do mais recente para o mais antigo e o
+	// cursor da próxima página ("" quando não há mais resultados)
+	List(ctx context.Context, filter PaymentFilter) ([]Payment, string, error)
+
+	OutboxStore
+	IdempotencyRepository
+}
+
+// Cursor opaco: posição (createdAt, id) do último item da página
+type listCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+func encodeCursor(p Payment) string {
+	raw := strconv.FormatInt(p.CreatedAt.UnixNano(), 10) + "|" + p.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (listCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return listCursor{}, fmt.Errorf("invalid cursor")
+	}
+	ts, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return listCursor{}, fmt.Errorf("invalid cursor")
+	}
+	nanos, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return listCursor{}, fmt.Errorf("invalid cursor")
+	}
+	return listCursor{CreatedAt: time.Unix(0, nanos), ID: id}, nil
+}
+
+// Ordenação da listagem: createdAt desc, id desc
+func paymentBefore(a, b Payment) bool {
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.After(b.CreatedAt)
+	}
+	return a.ID > b.ID
+}
+
+// ----------------------------------------------------------------------------
+// Implementação em memória (testes e desenvolvimento)
+// ----------------------------------------------------------------------------
+
+type MemoryPaymentRepository struct {
+	mu       sync.RWMutex
+	payments map[string]Payment
+	ordered  []string // IDs na ordem de listagem
+
+	// Eventos ainda não entregues, indexados pelo ID da entrada
+	outbox    map[string]OutboxEntry
+	outboxSeq int64
+
+	// Respostas memorizadas por (cliente, Idempotency-Key)
+	idempotency map[string]IdempotencyRecord
+}
+
+func NewMemoryPaymentRepository() *MemoryPaymentRepository {
+	return &MemoryPaymentRepository{
+		payments:    make(map[string]Payment),
+		outbox:      make(map[string]OutboxEntry),
+		idempotency: make(map[string]IdempotencyRecord),
+	}
+}
+
+func (m *MemoryPaymentRepository) Create(ctx context.Context, p Payment, events ...PaymentEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.payments[p.ID]; exists {
+		return fmt.Errorf("payment %s already exists", p.ID)
+	}
+	entries, err := m.newOutboxEntries(ctx, events)
+	if err != nil {
+		return err
+	}
+	m.put(p)
+	m.putOutbox(entries...)
+	m.bindIdempotency(ctx, p.ID)
+	return nil
+}
+
+// put insere ou substitui o registro mantendo a ordem de listagem
+func (m *MemoryPaymentRepository) put(p Payment) {
+	if _, exists := m.payments[p.ID]; !exists {
+		i := sort.Search(len(m.ordered), func(i int) bool {
+			return !paymentBefore(m.payments[m.ordered[i]], p)
+		})
+		m.ordered = append(m.ordered, "")
+		copy(m.ordered[i+1:], m.ordered[i:])
+		m.ordered[i] = p.ID
+	}
+	m.payments[p.ID] = p
+}
+
+func (m *MemoryPaymentRepository) Get(ctx context.Context, id string) (Payment, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	p, ok := m.payments[id]
+	if !ok {
+		return Payment{}, ErrPaymentNotFound
+	}
+	return p, nil
+}
+
+func (m *MemoryPaymentRepository) Update(ctx context.Context, id string, fn func(p *Payment) ([]PaymentEvent, error)) (Payment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.payments[id]
+	if !ok {
+		return Payment{}, ErrPaymentNotFound
+	}
+	events, err := fn(&p)
+	if err != nil {
+		return Payment{}, err
+	}
+	entries, err := m.newOutboxEntries(ctx, events)
+	if err != nil {
+		return Payment{}, err
+	}
+	m.put(p)
+	m.putOutbox(entries...)
+	m.bindIdempotency(ctx, p.ID)
+	return p, nil
+}
+
+func (m *MemoryPaymentRepository) CountByStatus(ctx context.Context) (map[PaymentStatus]int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	counts := make(map[PaymentStatus]int)
+	for _, p := range m.payments {
+		counts[p.Status]++
+	}
+	return counts, nil
+}
+
+func (m *MemoryPaymentRepository) List(ctx context.Context, filter PaymentFilter) ([]Payment, string, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	if limit > maxListLimit {
+		limit = maxListLimit
+	}
+
+	var after *listCursor
+	if filter.Cursor != "" {
+		c, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		after = &c
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	start := 0
+	if after != nil {
+		pivot := Payment{ID: after.ID, CreatedAt: after.CreatedAt}
+		start = sort.Search(len(m.ordered), func(i int) bool {
+			return paymentBefore(pivot, m.payments[m.ordered[i]])
+		})
+	}
+
+	page := make([]Payment, 0, limit)
+	for _, id := range m.ordered[start:] {
+		p := m.payments[id]
+		if !matchesFilter(p, filter) {
+			continue
+		}
+		if len(page) == limit {
+			return page, encodeCursor(page[len(page)-1]), nil
+		}
+		page = append(page, p)
+	}
+	return page, "", nil
+}
+
+// newOutboxEntries serializa os eventos e reserva a sequência global;
+// deve ser chamada com m.mu travado
+func (m *MemoryPaymentRepository) newOutboxEntries(ctx context.Context, events []PaymentEvent) ([]OutboxEntry, error) {
+	entries := make([]OutboxEntry, 0, len(events))
+	for _, event := range events {
+		m.outboxSeq++
+		entry, err := newOutboxEntry(ctx, m.outboxSeq, event)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (m *MemoryPaymentRepository) putOutbox(entries ...OutboxEntry) {
+	for _, e := range entries {
+		m.outbox[e.ID] = e
+		if e.Seq > m.outboxSeq {
+			m.outboxSeq = e.Seq
+		}
+	}
+}
+
+func (m *MemoryPaymentRepository) PendingOutbox(ctx context.Context, aggregateID string) ([]OutboxEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	entries := make([]OutboxEntry, 0, len(m.outbox))
+	for _, e := range m.outbox {
+		if aggregateID == "" || e.AggregateID == aggregateID {
+			entries = append(entries, e)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Seq < entries[j].Seq })
+	return entries, nil
+}
+
+func (m *MemoryPaymentRepository) UpdateOutboxEntry(ctx context.Context, e OutboxEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.outbox[e.ID]; !ok {
+		return ErrOutboxEntryNotFound
+	}
+	m.outbox[e.ID] = e
+	return nil
+}
+
+func (m *MemoryPaymentRepository) MarkOutboxDelivered(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.outbox[id]; !ok {
+		return ErrOutboxEntryNotFound
+	}
+	delete(m.outbox, id)
+	return nil
+}
+
+// bindIdempotency grava a reserva da Idempotency-Key da requisição junto
+// com o recurso; deve ser chamada com m.mu travado
+func (m *MemoryPaymentRepository) bindIdempotency(ctx context.Context, resourceID string) {
+	if rec, bound := pendingIdempotency(ctx, resourceID); rec != nil {
+		m.putIdempotency(*rec)
+		bound()
+	}
+}
+
+func (m *MemoryPaymentRepository) putIdempotency(rec IdempotencyRecord) {
+	m.idempotency[idempotencyID(rec.Client, rec.Key)] = rec
+}
+
+func (m *MemoryPaymentRepository) GetIdempotency(ctx context.Context, client, key string) (IdempotencyRecord, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	rec, ok := m.idempotency[idempotencyID(client, key)]
+	return rec, ok, nil
+}
+
+func (m *MemoryPaymentRepository) SaveIdempotency(ctx context.Context, rec IdempotencyRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.putIdempotency(rec)
+	return nil
+}
+
+func (m *MemoryPaymentRepository) DeleteIdempotencyBefore(ctx context.Context, cutoff time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.expireIdempotency(cutoff), nil
+}
+
+func (m *MemoryPaymentRepository) expireIdempotency(cutoff time.Time) int {
+	removed := 0
+	for id, rec := range m.idempotency {
+		if rec.CreatedAt.Before(cutoff) {
+			delete(m.idempotency, id)
+			removed++
+		}
+	}
+	return removed
+}
+
+func matchesFilter(p Payment, filter PaymentFilter) bool {
+	if filter.AccountID != "" && p.AccountID != filter.AccountID {
+		return false
+	}
+	if filter.Status != "" && !strings.EqualFold(string(p.Status), filter.Status) {
+		return false
+	}
+	if !filter.From.IsZero() && p.CreatedAt.Before(filter.From) {
+		return false
+	}
+	if !filter.To.IsZero() && !p.CreatedAt.Before(filter.To) {
+		return false
+	}
+	return true
+}
+
+// ----------------------------------------------------------------------------
+// Implementação embarcada em arquivo (log append-only em JSON lines)
+// ----------------------------------------------------------------------------
+
+// FilePaymentRepository mantém o índice em memória e grava cada alteração
+// em um arquivo append-only, reconstruído na inicialização do serviço.
+// Quando o histórico passa a dominar o arquivo, ele é compactado para uma
+// linha por registro vivo
+type FilePaymentRepository struct {
+	*MemoryPaymentRepository
+	writeMu sync.Mutex
+	path    string
+	file    *os.File
+	// Linhas no arquivo desde a última compactação
+	records int
+	compact compactionPolicy
+}
+
+// Compacta quando há ao menos MinRecords linhas e elas passam de Ratio
+// vezes o número de registros vivos (0 desabilita)
+type compactionPolicy struct {
+	MinRecords int
+	Ratio      int
+}
+
+var defaultCompactionPolicy = compactionPolicy{MinRecords: 1000, Ratio: 4}
+
+// ErrStoreCorrupted indica um registro ilegível no meio do arquivo, que não
+// pode ser explicado por uma escrita interrompida
+var ErrStoreCorrupted = errors.New("payment store corrupted")
+
+// Operações: "create" e "update" (pagamento + eventos gerados na mesma
+// linha, o que torna a gravação atômica), "outbox" (nova situação de uma
+// entrada), "outbox_delivered" (entrada confirmada pelo broker),
+// "idempotency" (resposta memorizada), "idempotency_expired" (registros
+// anteriores a ExpiredBefore removidos) e "checkpoint" (primeira linha de
+// um arquivo compactado). A reserva da Idempotency-Key vai na mesma linha
+// do pagamento que a requisição criou
+type fileRecord struct {
+	Op            string             `json:"op"`
+	Payment       *Payment           `json:"payment,omitempty"`
+	Outbox        []OutboxEntry      `json:"outbox,omitempty"`
+	OutboxID      string             `json:"outboxId,omitempty"`
+	OutboxSeq     int64              `json:"outboxSeq,omitempty"`
+	Idempotency   *IdempotencyRecord `json:"idempotency,omitempty"`
+	ExpiredBefore *time.Time         `json:"expiredBefore,omitempty"`
+}
+
+func OpenFilePaymentRepository(path string) (*FilePaymentRepository, error) {
+	return openFilePaymentRepository(path, defaultCompactionPolicy)
+}
+
+func openFilePaymentRepository(path string, policy compactionPolicy) (*FilePaymentRepository, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create store directory: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open store file: %w", err)
+	}
+
+	repo := &FilePaymentRepository{
+		MemoryPaymentRepository: NewMemoryPaymentRepository(),
+		path:                    path,
+		file:                    file,
+		compact:                 policy,
+	}
+	if err := repo.load(); err != nil {
+		repo.file.Close()
+		return nil, err
+	}
+	if repo.needsCompaction() {
+		if err := repo.compactLocked(); err != nil {
+			repo.file.Close()
+			return nil, err
+		}
+	}
+	return repo, nil
+}
+
+// load reconstrói o índice. Uma última linha sem '\n' ou ilegível vem de uma
+// escrita interrompida e é removida do arquivo (senão o próximo registro
+// seria colado a ela); um registro ilegível seguido de outros é corrupção
+func (f *FilePaymentRepository) load() error {
+	reader := bufio.NewReader(f.file)
+	var offset, good int64
+	var badLine int
+	var badErr error
+	line := 0
+	for {
+		data, err := reader.ReadBytes('\n')
+		if len(data) > 0 {
+			line++
+			offset += int64(len(data))
+			if badErr != nil {
+				return fmt.Errorf("%w: line %d: %v", ErrStoreCorrupted, badLine, badErr)
+			}
+			if data[len(data)-1] != '\n' {
+				badLine, badErr = line, errors.New("missing line terminator")
+			} else if rec, perr := decodeFileRecord(data); perr != nil {
+				badLine, badErr = line, perr
+			} else {
+				f.apply(rec)
+				f.records++
+				good = offset
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read store file: %w", err)
+		}
+	}
+
+	if good < offset {
+		logger.Warn("payment_store_truncated_tail",
+			zap.Int("line", badLine),
+			zap.Int64("discarded_bytes", offset-good),
+			zap.NamedError("reason", badErr),
+		)
+		if err := f.file.Truncate(good); err != nil {
+			return fmt.Errorf("truncate store file: %w", err)
+		}
+		if err := f.file.Sync(); err != nil {
+			return fmt.Errorf("sync store file: %w", err)
+		}
+	}
+	return nil
+}
+
+func decodeFileRecord(data []byte) (fileRecord, error) {
+	var rec fileRecord
+	err := json.Unmarshal(data, &rec)
+	return rec, err
+}
+
+// apply reproduz um registro no índice em memória
+func (f *FilePaymentRepository) apply(rec fileRecord) {
+	mem := f.MemoryPaymentRepository
+	if rec.Payment != nil {
+		mem.put(*rec.Payment)
+	}
+	mem.putOutbox(rec.Outbox...)
+	if rec.Idempotency != nil {
+		mem.putIdempotency(*rec.Idempotency)
+	}
+	switch rec.Op {
+	case "outbox_delivered":
+		delete(mem.outbox, rec.OutboxID)
+	case "idempotency_expired":
+		if rec.ExpiredBefore != nil {
+			mem.expireIdempotency(*rec.ExpiredBefore)
+		}
+	case "checkpoint":
+		if rec.OutboxSeq > mem.outboxSeq {
+			mem.outboxSeq = rec.OutboxSeq
+		}
+	}
+}
+
+// append grava um registro; deve ser chamada com writeMu travado
+func (f *FilePaymentRepository) append(rec fileRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if _, err := f.file.Write(data); err != nil {
+		return fmt.Errorf("write store file: %w", err)
+	}
+	if err := f.file.Sync(); err != nil {
+		return fmt.Errorf("sync store file: %w", err)
+	}
+	f.records++
+	return nil
+}
+
+func (f *FilePaymentRepository) needsCompaction() bool {
+	if f.compact.MinRecords <= 0 || f.records < f.compact.MinRecords {
+		return false
+	}
+	mem := f.MemoryPaymentRepository
+	mem.mu.RLock()
+	live := len(mem.payments) + len(mem.outbox) + len(mem.idempotency) + 1
+	mem.mu.RUnlock()
+	return f.records > f.compact.Ratio*live
+}
+
+// maybeCompact roda após cada gravação; falhas são apenas registradas, pois
+// o arquivo original continua válido
+func (f *FilePaymentRepository) maybeCompact() {
+	if !f.needsCompaction() {
+		return
+	}
+	if err := f.compactLocked(); err != nil {
+		logger.Error("payment_store_compaction_failed", zap.Error(err))
+	}
+}
+
+// compactLocked reescreve o arquivo com o estado atual (checkpoint + um
+// registro por pagamento, por entrada pendente do outbox e por resposta
+// memorizada) em um arquivo
+// temporário e o troca atomicamente pelo original; deve ser chamada com
+// writeMu travado (ou antes de o repositório ser publicado)
+func (f *FilePaymentRepository) compactLocked() error {
+	mem := f.MemoryPaymentRepository
+	mem.mu.RLock()
+	records := make([]fileRecord, 0, len(mem.payments)+len(mem.outbox)+len(mem.idempotency)+1)
+	records = append(records, fileRecord{Op: "checkpoint", OutboxSeq: mem.outboxSeq})
+	for i := len(mem.ordered) - 1; i >= 0; i-- {
+		p := mem.payments[mem.ordered[i]]
+		records = append(records, fileRecord{Op: "create", Payment: &p})
+	}
+	entries := make([]OutboxEntry, 0, len(mem.outbox))
+	for _, e := range mem.outbox {
+		entries = append(entries, e)
+	}
+	for _, rec := range mem.idempotency {
+		rec := rec
+		records = append(records, fileRecord{Op: "idempotency", Idempotency: &rec})
+	}
+	mem.mu.RUnlock()
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Seq < entries[j].Seq })
+	for _, e := range entries {
+		records = append(records, fileRecord{Op: "outbox", Outbox: []OutboxEntry{e}})
+	}
+
+	tmpPath := f.path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("create compacted store: %w", err)
+	}
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, rec := range records {
+		if err = enc.Encode(rec); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, f.path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("write compacted store: %w", err)
+	}
+	syncDir(filepath.Dir(f.path))
+
+	file, err := os.OpenFile(f.path, os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("reopen store file: %w", err)
+	}
+	before := f.records
+	f.file.Close()
+	f.file = file
+	f.records = len(records)
+	logger.Info("payment_store_compacted",
+		zap.Int("records_before", before),
+		zap.Int("records_after", f.records),
+	)
+	return nil
+}
+
+// syncDir garante que o rename sobreviva a um crash
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+func (f *FilePaymentRepository) Create(ctx context.Context, p Payment, events ...PaymentEvent) error {
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+
+	if _, err := f.MemoryPaymentRepository.Get(ctx, p.ID); err == nil {
+		return fmt.Errorf("payment %s already exists", p.ID)
+	}
+	return f.commit(ctx, "create", p, events)
+}
+
+func (f *FilePaymentRepository) Update(ctx context.Context, id string, fn func(p *Payment) ([]PaymentEvent, error)) (Payment, error) {
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+
+	p, err := f.MemoryPaymentRepository.Get(ctx, id)
+	if err != nil {
+		return Payment{}, err
+	}
+	events, err := fn(&p)
+	if err != nil {
+		return Payment{}, err
+	}
+	if err := f.commit(ctx, "update", p, events); err != nil {
+		return Payment{}, err
+	}
+	return p, nil
+}
+
+// commit grava pagamento, eventos e reserva de idempotência em uma única linha e só então atualiza o
+// índice em memória; deve ser chamada com writeMu travado
+func (f *FilePaymentRepository) commit(ctx context.Context, op string, p Payment, events []PaymentEvent) error {
+	mem := f.MemoryPaymentRepository
+	mem.mu.Lock()
+	entries, err := mem.newOutboxEntries(ctx, events)
+	mem.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	idem, bound := pendingIdempotency(ctx, p.ID)
+	if err := f.append(fileRecord{Op: op, Payment: &p, Outbox: entries, Idempotency: idem}); err != nil {
+		return err
+	}
+
+	mem.mu.Lock()
+	mem.put(p)
+	mem.putOutbox(entries...)
+	if idem != nil {
+		mem.putIdempotency(*idem)
+		bound()
+	}
+	mem.mu.Unlock()
+	f.maybeCompact()
+	return nil
+}
+
+func (f *FilePaymentRepository) UpdateOutboxEntry(ctx context.Context, e OutboxEntry) error {
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+
+	if !f.hasOutboxEntry(e.ID) {
+		return ErrOutboxEntryNotFound
+	}
+	if err := f.append(fileRecord{Op: "outbox", Outbox: []OutboxEntry{e}}); err != nil {
+		return err
+	}
+	if err := f.MemoryPaymentRepository.UpdateOutboxEntry(ctx, e); err != nil {
+		return err
+	}
+	f.maybeCompact()
+	return nil
+}
+
+func (f *FilePaymentRepository) MarkOutboxDelivered(ctx context.Context, id string) error {
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+
+	if !f.hasOutboxEntry(id) {
+		return ErrOutboxEntryNotFound
+	}
+	if err := f.append(fileRecord{Op: "outbox_delivered", OutboxID: id}); err != nil {
+		return err
+	}
+	if err := f.MemoryPaymentRepository.MarkOutboxDelivered(ctx, id); err != nil {
+		return err
+	}
+	f.maybeCompact()
+	return nil
+}
+
+func (f *FilePaymentRepository) SaveIdempotency(ctx context.Context, rec IdempotencyRecord) error {
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+
+	if err := f.append(fileRecord{Op: "idempotency", Idempotency: &rec}); err != nil {
+		return err
+	}
+	if err := f.MemoryPaymentRepository.SaveIdempotency(ctx, rec); err != nil {
+		return err
+	}
+	f.maybeCompact()
+	return nil
+}
+
+func (f *FilePaymentRepository) DeleteIdempotencyBefore(ctx context.Context, cutoff time.Time) (int, error) {
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+
+	if !f.hasIdempotencyBefore(cutoff) {
+		return 0, nil
+	}
+	if err := f.append(fileRecord{Op: "idempotency_expired", ExpiredBefore: &cutoff}); err != nil {
+		return 0, err
+	}
+	removed, err := f.MemoryPaymentRepository.DeleteIdempotencyBefore(ctx, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	f.maybeCompact()
+	return removed, nil
+}
+
+func (f *FilePaymentRepository) hasIdempotencyBefore(cutoff time.Time) bool {
+	f.MemoryPaymentRepository.mu.RLock()
+	defer f.MemoryPaymentRepository.mu.RUnlock()
+	for _, rec := range f.MemoryPaymentRepository.idempotency {
+		if rec.CreatedAt.Before(cutoff) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *FilePaymentRepository) hasOutboxEntry(id string) bool {
+	f.MemoryPaymentRepository.mu.RLock()
+	defer f.MemoryPaymentRepository.mu.RUnlock()
+	_, ok := f.MemoryPaymentRepository.outbox[id]
+	return ok
+}
+
+func (f *FilePaymentRepository) Close() error {
+	f.writeMu.Lock()
+	defer f.writeMu.Unlock()
+	return f.file.Close()
+}
+
+// Seleção da implementação via PAYMENT_STORE (file|memory); a compactação
+// do arquivo é ajustada por PAYMENT_STORE_COMPACT_MIN_RECORDS (0 desabilita)
+func newPaymentRepository() (PaymentRepository, error) {
+	switch os.Getenv("PAYMENT_STORE") {
+	case "memory":
+		return NewMemoryPaymentRepository(), nil
+	case "", "file":
+		path := os.Getenv("PAYMENT_STORE_PATH")
+		if path == "" {
+			path = "data/payments.jsonl"
+		}
+		policy := defaultCompactionPolicy
+		if v, err := strconv.Atoi(os.Getenv("PAYMENT_STORE_COMPACT_MIN_RECORDS")); err == nil && v >= 0 {
+			policy.MinRecords = v
+		}
+		return openFilePaymentRepository(path, policy)
+	default:
+		return nil, fmt.Errorf("unknown PAYMENT_STORE %q", os.Getenv("PAYMENT_STORE"))
+	}
+}
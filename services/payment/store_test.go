@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"shared/money"
+)
+
+func testPayment(t *testing.T, id string, createdAt time.Time) Payment {
+	t.Helper()
+	amount, err := money.New(10050, "BRL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	zero, _ := money.Zero("BRL")
+	return Payment{ID: id, AccountID: "acc-1", Amount: amount, Status: StatusPending,
+		CreatedAt: createdAt, UpdatedAt: createdAt, RefundedAmount: zero}
+}
+
+func openTestStore(t *testing.T, path string, policy compactionPolicy) *FilePaymentRepository {
+	t.Helper()
+	repo, err := openFilePaymentRepository(path, policy)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+// seedStore grava dois pagamentos, uma transição e a entrega de um evento
+func seedStore(t *testing.T, repo *FilePaymentRepository) {
+	t.Helper()
+	ctx := context.Background()
+	now := time.Now()
+	for _, id := range []string{"pay-1", "pay-2"} {
+		p := testPayment(t, id, now)
+		if err := repo.Create(ctx, p, newPaymentEvent(p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := repo.Update(ctx, "pay-1", func(p *Payment) ([]PaymentEvent, error) {
+		if err := applyTransition(p, StatusAuthorized); err != nil {
+			return nil, err
+		}
+		return []PaymentEvent{newPaymentEvent(*p)}, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	pending, _ := repo.PendingOutbox(ctx, "pay-2")
+	if err := repo.MarkOutboxDelivered(ctx, pending[0].ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func assertSeeded(t *testing.T, repo PaymentRepository) {
+	t.Helper()
+	ctx := context.Background()
+	p, err := repo.Get(ctx, "pay-1")
+	if err != nil || p.Status != StatusAuthorized {
+		t.Fatalf("pay-1 = %s, %v; want AUTHORIZED", p.Status, err)
+	}
+	if _, err := repo.Get(ctx, "pay-2"); err != nil {
+		t.Fatalf("pay-2: %v", err)
+	}
+	pending, _ := repo.PendingOutbox(ctx, "")
+	if len(pending) != 2 || pending[0].AggregateID != "pay-1" || pending[1].AggregateID != "pay-1" {
+		t.Fatalf("pending outbox = %+v, want the two pay-1 events", pending)
+	}
+}
+
+func TestFileStoreReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "payments.jsonl")
+	repo := openTestStore(t, path, compactionPolicy{})
+	seedStore(t, repo)
+	repo.Close()
+
+	assertSeeded(t, openTestStore(t, path, compactionPolicy{}))
+}
+
+func TestFileStoreRecovery(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(data []byte) []byte
+		err     error
+	}{
+		{"torn last line without newline", func(data []byte) []byte {
+			return append(data, []byte(`{"op":"create","payment":{"paymentId":"pay-3"`)...)
+		}, nil},
+		{"unparseable last line", func(data []byte) []byte {
+			return append(data, []byte("{garbage\n")...)
+		}, nil},
+		{"unparseable line in the middle", func(data []byte) []byte {
+			lines := strings.SplitAfter(string(data), "\n")
+			return []byte(lines[0] + "{garbage\n" + strings.Join(lines[1:], ""))
+		}, ErrStoreCorrupted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "payments.jsonl")
+			repo := openTestStore(t, path, compactionPolicy{})
+			seedStore(t, repo)
+			repo.Close()
+
+			data, _ := os.ReadFile(path)
+			clean := len(data)
+			os.WriteFile(path, tt.corrupt(data), 0o644)
+
+			repo, err := openFilePaymentRepository(path, compactionPolicy{})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("open error = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			defer repo.Close()
+			assertSeeded(t, repo)
+
+			// A cauda foi removida: o próximo registro não é colado a ela
+			if info, _ := os.Stat(path); info.Size() != int64(clean) {
+				t.Fatalf("file size = %d, want truncated to %d", info.Size(), clean)
+			}
+			p := testPayment(t, "pay-4", time.Now())
+			if err := repo.Create(context.Background(), p); err != nil {
+				t.Fatal(err)
+			}
+			repo.Close()
+			reopened := openTestStore(t, path, compactionPolicy{})
+			if _, err := reopened.Get(context.Background(), "pay-4"); err != nil {
+				t.Fatalf("payment written after recovery lost: %v", err)
+			}
+		})
+	}
+}
+
+func TestFileStoreCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "payments.jsonl")
+	policy := compactionPolicy{MinRecords: 10, Ratio: 2}
+	repo := openTestStore(t, path, policy)
+	seedStore(t, repo)
+
+	ctx := context.Background()
+	// Muitas regravações do mesmo registro: o histórico passa a dominar
+	for i := 0; i < 20; i++ {
+		pending, _ := repo.PendingOutbox(ctx, "pay-1")
+		pending[0].Attempts = i + 1
+		if err := repo.UpdateOutboxEntry(ctx, pending[0]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if repo.records > policy.MinRecords {
+		t.Fatalf("records = %d, compaction did not run", repo.records)
+	}
+	repo.Close()
+
+	reopened := openTestStore(t, path, policy)
+	assertSeeded(t, reopened)
+	pending, _ := reopened.PendingOutbox(ctx, "pay-1")
+	if pending[0].Attempts != 20 {
+		t.Fatalf("attempts = %d after compaction, want 20", pending[0].Attempts)
+	}
+	// A sequência do outbox continua de onde parou
+	p := testPayment(t, "pay-5", time.Now())
+	if err := reopened.Create(ctx, p, newPaymentEvent(p)); err != nil {
+		t.Fatal(err)
+	}
+	latest, _ := reopened.PendingOutbox(ctx, "pay-5")
+	if latest[0].Seq <= pending[len(pending)-1].Seq {
+		t.Fatalf("outbox seq restarted: %d <= %d", latest[0].Seq, pending[len(pending)-1].Seq)
+	}
+}
+
+func TestFileStoreIdempotencyWrittenWithPayment(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "payments.jsonl")
+	repo := openTestStore(t, path, compactionPolicy{})
+
+	res := &idempotencyReservation{client: "ip:10.0.0.1", key: "k-1", fingerprint: "fp", createdAt: time.Now()}
+	ctx := context.WithValue(context.Background(), idempotencyContextKey{}, res)
+	p := testPayment(t, "pay-1", time.Now())
+	if err := repo.Create(ctx, p, newPaymentEvent(p)); err != nil {
+		t.Fatal(err)
+	}
+	// Transições seguintes da mesma requisição não regravam a reserva
+	if _, err := repo.Update(ctx, "pay-1", func(p *Payment) ([]PaymentEvent, error) {
+		return nil, applyTransition(p, StatusAuthorized)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	repo.Close()
+
+	// Crash antes de a resposta ser gravada: a reserva sobrevive com o pagamento
+	reopened := openTestStore(t, path, compactionPolicy{})
+	rec, ok, err := reopened.GetIdempotency(context.Background(), "ip:10.0.0.1", "k-1")
+	if err != nil || !ok {
+		t.Fatalf("idempotency record lost: %v", err)
+	}
+	if rec.ResourceID != "pay-1" || rec.Fingerprint != "fp" || rec.StatusCode != 0 {
+		t.Fatalf("record = %+v", rec)
+	}
+	if _, ok, _ := reopened.GetIdempotency(context.Background(), "ip:10.0.0.2", "k-1"); ok {
+		t.Fatal("key leaked to another client")
+	}
+
+	removed, err := reopened.DeleteIdempotencyBefore(context.Background(), time.Now().Add(time.Minute))
+	if err != nil || removed != 1 {
+		t.Fatalf("expired = %d, %v; want 1", removed, err)
+	}
+	reopened.Close()
+	if _, ok, _ := openTestStore(t, path, compactionPolicy{}).GetIdempotency(context.Background(), "ip:10.0.0.1", "k-1"); ok {
+		t.Fatal("expired record came back after replay")
+	}
+}
+
+func TestMemoryRepositoryList(t *testing.T) {
+	repo := NewMemoryPaymentRepository()
+	ctx := context.Background()
+	base := time.Now()
+	for i, id := range []string{"pay-a", "pay-b", "pay-c", "pay-d", "pay-e"} {
+		if err := repo.Create(ctx, testPayment(t, id, base.Add(time.Duration(i)*time.Second))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []string
+	cursor := ""
+	for {
+		page, next, err := repo.List(ctx, PaymentFilter{Limit: 2, Cursor: cursor})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range page {
+			got = append(got, p.ID)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if strings.Join(got, ",") != "pay-e,pay-d,pay-c,pay-b,pay-a" {
+		t.Fatalf("listed %v, want newest first without gaps", got)
+	}
+}
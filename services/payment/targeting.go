@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http"
+
+	"shared/chaos"
+)
+
+// ============================================================================
+// LAG DIRECIONADO (regras por endpoint, conta, moeda, header e correlation ID)
+// ============================================================================
+
+// Header que marca requisições de teste de caos
+const chaosHeader = "X-Chaos"
+
+// lagTargetFromRequest monta o alvo das regras de lag (chaos.LagRule) a partir
+// da requisição e do corpo já validado
+func lagTargetFromRequest(r *http.Request, accountID, currency string) chaos.LagTarget {
+	correlationID, _ := r.Context().Value("correlation_id").(string)
+	return chaos.LagTarget{
+		Endpoint:      r.Method + " " + endpointLabel(r),
+		AccountID:     accountID,
+		Currency:      currency,
+		ChaosHeader:   r.Header.Get(chaosHeader),
+		CorrelationID: correlationID,
+	}
+}
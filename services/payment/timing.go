@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// ============================================================================
+// TEMPOS POR ESTÁGIO (Server-Timing) E PRAZO DA REQUISIÇÃO
+// ============================================================================
+
+// Estágios medidos em handlePayment; as chamadas chatty viram external-0..2
+const (
+	stageRateLimit = "rate-limit"
+	stageBreaker   = "breaker"
+	stageDecode    = "decode"
+	stageCache     = "cache"
+	stageDatabase  = "database"
+	stagePublish   = "publish"
+)
+
+func externalCallStage(i int) string {
+	return fmt.Sprintf("external-%d", i)
+}
+
+// Prazo total de POST /payments (PAYMENT_DEADLINE_MS); 0 desabilita. Quando
+// o prazo acaba, os estágios restantes não rodam e a resposta é
+// 504 deadline_exceeded
+var paymentDeadline time.Duration
+
+func paymentDeadlineFromEnv() time.Duration {
+	if v, err := strconv.Atoi(os.Getenv("PAYMENT_DEADLINE_MS")); err == nil && v > 0 {
+		return time.Duration(v) * time.Millisecond
+	}
+	return 0
+}
+
+type stageTiming struct {
+	stage    string
+	duration time.Duration
+}
+
+// stageTimings acumula a duração dos estágios de uma requisição, na ordem em
+// que começaram. Um estágio medido mais de uma vez (ex: rate limit global e
+// por conta) soma as durações. Usado por uma única goroutine
+type stageTimings struct {
+	start  time.Time
+	stages []stageTiming
+}
+
+func newStageTimings() *stageTimings {
+	return &stageTimings{start: time.Now()}
+}
+
+// Start começa a medir o estágio; a função retornada encerra a medição e
+// observa payment_stage_duration_seconds
+func (t *stageTimings) Start(stage string) func() {
+	begin := time.Now()
+	return func() {
+		d := time.Since(begin)
+		paymentStageDuration.WithLabelValues(stage).Observe(d.Seconds())
+		for i := range t.stages {
+			if t.stages[i].stage == stage {
+				t.stages[i].duration += d
+				return
+			}
+		}
+		t.stages = append(t.stages, stageTiming{stage: stage, duration: d})
+	}
+}
+
+// ServerTiming formata os estágios medidos e o total para o header
+// Server-Timing (durações em milissegundos)
+func (t *stageTimings) ServerTiming() string {
+	parts := make([]string, 0, len(t.stages)+1)
+	for _, s := range t.stages {
+		parts = append(parts, fmt.Sprintf("%s;dur=%.2f", s.stage, milliseconds(s.duration)))
+	}
+	parts = append(parts, fmt.Sprintf("total;dur=%.2f", milliseconds(time.Since(t.start))))
+	return strings.Join(parts, ", ")
+}
+
+// MarshalLogObject grava o campo de log "timings" (milissegundos por estágio)
+func (t *stageTimings) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	for _, s := range t.stages {
+		enc.AddFloat64(s.stage, milliseconds(s.duration))
+	}
+	enc.AddFloat64("total", milliseconds(time.Since(t.start)))
+	return nil
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// timingResponseWriter adiciona o header Server-Timing no momento em que a
+// resposta começa a ser escrita, com os estágios medidos até ali
+type timingResponseWriter struct {
+	http.ResponseWriter
+	timings     *stageTimings
+	wroteHeader bool
+}
+
+func (tw *timingResponseWriter) WriteHeader(code int) {
+	if !tw.wroteHeader {
+		tw.wroteHeader = true
+		tw.Header().Set("Server-Timing", tw.timings.ServerTiming())
+	}
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+func (tw *timingResponseWriter) Write(b []byte) (int, error) {
+	if !tw.wroteHeader {
+		tw.WriteHeader(http.StatusOK)
+	}
+	return tw.ResponseWriter.Write(b)
+}
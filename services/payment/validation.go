@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"shared/money"
+)
+
+// ============================================================================
+// VALIDAÇÃO DE REQUISIÇÕES
+// ============================================================================
+
+const (
+	maxAccountIDLength = 64
+	maxReasonLength    = 255
+)
+
+var (
+	accountIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+	currencyPattern  = regexp.MustCompile(`^[A-Z]{3}$`)
+)
+
+// validatePaymentRequest valida todos os campos e retorna o valor já
+// convertido; os erros de campo são acumulados para um único 422
+func validatePaymentRequest(req PaymentRequest) (money.Money, *Problem) {
+	var fieldErrors []FieldError
+
+	switch {
+	case req.AccountID == "":
+		fieldErrors = append(fieldErrors, FieldError{Field: "accountId", Code: "required", Message: "accountId is required"})
+	case len(req.AccountID) > maxAccountIDLength:
+		fieldErrors = append(fieldErrors, FieldError{Field: "accountId", Code: "too_long", Message: "accountId must have at most 64 characters"})
+	case !accountIDPattern.MatchString(req.AccountID):
+		fieldErrors = append(fieldErrors, FieldError{Field: "accountId", Code: "invalid_format", Message: "accountId may contain only letters, digits, '.', '_' and '-'"})
+	}
+
+	currencyValid := false
+	switch {
+	case req.Currency == "":
+		fieldErrors = append(fieldErrors, FieldError{Field: "currency", Code: "required", Message: "currency is required"})
+	case !currencyPattern.MatchString(req.Currency):
+		fieldErrors = append(fieldErrors, FieldError{Field: "currency", Code: "invalid_format", Message: "currency must be an uppercase ISO-4217 code"})
+	case !money.IsKnownCurrency(req.Currency):
+		fieldErrors = append(fieldErrors, FieldError{Field: "currency", Code: "unsupported", Message: "currency is not supported"})
+	default:
+		currencyValid = true
+	}
+
+	var amount money.Money
+	if len(req.Amount) == 0 || string(req.Amount) == "null" {
+		fieldErrors = append(fieldErrors, FieldError{Field: "amount", Code: "required", Message: "amount is required"})
+	} else if currencyValid {
+		var fieldErr *FieldError
+		amount, fieldErr = validateAmount("amount", req.Amount, req.Currency)
+		if fieldErr != nil {
+			fieldErrors = append(fieldErrors, *fieldErr)
+		}
+	}
+
+	if len(fieldErrors) > 0 {
+		return money.Money{}, validationProblem(fieldErrors)
+	}
+	return amount, nil
+}
+
+// validateAmount converte o literal JSON e exige valor positivo
+func validateAmount(field string, raw []byte, currency string) (money.Money, *FieldError) {
+	amount, err := money.ParseJSON(raw, currency)
+	switch {
+	case errors.Is(err, money.ErrTooManyDecimals):
+		return money.Money{}, &FieldError{Field: field, Code: "too_many_decimals", Message: err.Error()}
+	case errors.Is(err, money.ErrOverflow):
+		return money.Money{}, &FieldError{Field: field, Code: "out_of_range", Message: err.Error()}
+	case err != nil:
+		return money.Money{}, &FieldError{Field: field, Code: "invalid_format", Message: "must be a plain decimal number, e.g. 100.50"}
+	case !amount.IsPositive():
+		return money.Money{}, &FieldError{Field: field, Code: "must_be_positive", Message: "must be greater than zero"}
+	}
+	return amount, nil
+}
+
+func validateReason(reason string) *FieldError {
+	if len(reason) > maxReasonLength {
+		return &FieldError{Field: "reason", Code: "too_long", Message: "reason must have at most 255 characters"}
+	}
+	return nil
+}
+
+func validationProblem(fieldErrors []FieldError) *Problem {
+	fields := make([]string, 0, len(fieldErrors))
+	for _, fe := range fieldErrors {
+		fields = append(fields, fe.Field)
+	}
+	p := newProblem(http.StatusUnprocessableEntity, CodeValidationFailed,
+		"invalid fields: "+strings.Join(fields, ", "))
+	p.Errors = fieldErrors
+	return p
+}
@@ -0,0 +1,83 @@
+// Package adminauth protege as rotas /admin/* dos serviços (lag, falhas,
+// cenários, breakers, outbox e DLQ) com um token compartilhado, lido de
+// ADMIN_TOKEN e enviado em "Authorization: Bearer <token>". Sem token
+// configurado a administração fica desligada (403), nunca aberta.
+package adminauth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"shared/problem"
+)
+
+// Guard exige o token nas rotas administrativas e repassa as demais
+type Guard struct {
+	logger *zap.Logger
+	// Hash do token: a comparação em tempo constante não depende do tamanho
+	tokenHash [sha256.Size]byte
+	enabled   bool
+}
+
+// New cria o guard; token vazio desliga as rotas administrativas
+func New(logger *zap.Logger, token string) *Guard {
+	g := &Guard{logger: logger, enabled: token != ""}
+	if g.enabled {
+		g.tokenHash = sha256.Sum256([]byte(token))
+	}
+	return g
+}
+
+// FromEnv lê ADMIN_TOKEN
+func FromEnv(logger *zap.Logger) *Guard {
+	g := New(logger, os.Getenv("ADMIN_TOKEN"))
+	if !g.enabled {
+		logger.Warn("admin_api_disabled", zap.String("hint", "set ADMIN_TOKEN to enable /admin routes"))
+	}
+	return g
+}
+
+// isAdminPath cobre /admin e tudo abaixo de /admin/
+func isAdminPath(path string) bool {
+	return path == "/admin" || strings.HasPrefix(path, "/admin/")
+}
+
+// Protect envolve o handler do servidor: rotas fora de /admin passam direto
+func (g *Guard) Protect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAdminPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !g.enabled {
+			problem.Error(w, r, http.StatusForbidden, "admin_disabled", "admin API is disabled; set ADMIN_TOKEN")
+			return
+		}
+		if !g.authorized(r) {
+			g.logger.Warn("admin_auth_rejected",
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+				zap.String("remote_addr", r.RemoteAddr),
+				zap.String("user_agent", r.UserAgent()),
+			)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			problem.Error(w, r, http.StatusUnauthorized, "unauthorized", "missing or invalid admin token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (g *Guard) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return false
+	}
+	hash := sha256.Sum256([]byte(token))
+	return subtle.ConstantTimeCompare(hash[:], g.tokenHash[:]) == 1
+}
@@ -0,0 +1,43 @@
+package adminauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestProtect(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	tests := []struct {
+		name          string
+		token         string
+		path          string
+		authorization string
+		want          int
+	}{
+		{"rota pública", "s3cret", "/payments", "", http.StatusOK},
+		{"métricas", "", "/metrics", "", http.StatusOK},
+		{"token correto", "s3cret", "/admin/lag", "Bearer s3cret", http.StatusOK},
+		{"sem token", "s3cret", "/admin/dlq/purge", "", http.StatusUnauthorized},
+		{"token errado", "s3cret", "/admin/faults", "Bearer s3cre", http.StatusUnauthorized},
+		{"esquema errado", "s3cret", "/admin/faults", "Basic s3cret", http.StatusUnauthorized},
+		{"raiz admin", "s3cret", "/admin", "", http.StatusUnauthorized},
+		{"admin desligado", "", "/admin/scenario", "Bearer ", http.StatusForbidden},
+		{"prefixo parecido", "s3cret", "/administrators", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tt.path, nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			New(zap.NewNop(), tt.token).Protect(ok).ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("%s %s = %d, want %d", tt.path, tt.authorization, w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package chaos
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"shared/problem"
+)
+
+// ============================================================================
+// ADMIN HTTP (GET/PUT /admin/lag e /admin/faults, /admin/scenario)
+// ============================================================================
+
+// Limite do corpo das requisições de configuração
+const maxAdminBodyBytes = 64 << 10
+
+// Admin expõe os handlers de configuração em runtime. Decode e Invalid
+// permitem que o serviço use o próprio formato de erro; sem eles, as
+// respostas seguem application/problem+json com os mesmos códigos
+type Admin struct {
+	Options
+	Lag      *LagController
+	Faults   *FaultInjector
+	Scenario *ScenarioRunner
+	// Decodifica o corpo; em erro, escreve a resposta e retorna false
+	Decode func(w http.ResponseWriter, r *http.Request, dst interface{}) bool
+	// Escreve a resposta 422 com os erros de campo
+	Invalid func(w http.ResponseWriter, r *http.Request, errs []FieldError)
+	// Identifica quem fez a alteração na auditoria (padrão: header X-Client-ID)
+	ClientID func(r *http.Request) string
+}
+
+// Register registra as rotas no mux, com 405 para os demais métodos
+func (a *Admin) Register(mux *http.ServeMux) {
+	if a.Lag != nil {
+		mux.HandleFunc("GET /admin/lag", a.HandleGetLag)
+		mux.HandleFunc("PUT /admin/lag", a.HandlePutLag)
+		mux.HandleFunc("/admin/lag", problem.MethodNotAllowed(http.MethodGet, http.MethodPut))
+	}
+	if a.Faults != nil {
+		mux.HandleFunc("GET /admin/faults", a.HandleGetFaults)
+		mux.HandleFunc("PUT /admin/faults", a.HandlePutFaults)
+		mux.HandleFunc("/admin/faults", problem.MethodNotAllowed(http.MethodGet, http.MethodPut))
+	}
+	if a.Scenario != nil {
+		mux.HandleFunc("GET /admin/scenario", a.HandleGetScenario)
+		mux.HandleFunc("POST /admin/scenario/start", a.HandleStartScenario)
+		mux.HandleFunc("POST /admin/scenario/stop", a.HandleStopScenario)
+		mux.HandleFunc("/admin/scenario", problem.MethodNotAllowed(http.MethodGet))
+		mux.HandleFunc("/admin/scenario/start", problem.MethodNotAllowed(http.MethodPost))
+		mux.HandleFunc("/admin/scenario/stop", problem.MethodNotAllowed(http.MethodPost))
+	}
+}
+
+// GET /admin/lag
+func (a *Admin) HandleGetLag(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, a.Lag.Config())
+}
+
+// PUT /admin/lag
+func (a *Admin) HandlePutLag(w http.ResponseWriter, r *http.Request) {
+	var req LagUpdateRequest
+	if !a.decode(w, r, &req) {
+		return
+	}
+
+	before := a.Lag.Config()
+	cfg, fieldErrors := a.Lag.Merge(before, req)
+	if len(fieldErrors) > 0 {
+		a.invalid(w, r, fieldErrors)
+		return
+	}
+
+	a.Lag.Apply(cfg)
+	after := a.Lag.Config()
+	a.audit(r, "intentional_lag_config_changed", before, after)
+	writeJSON(w, after)
+}
+
+// GET /admin/faults
+func (a *Admin) HandleGetFaults(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, a.Faults.Config())
+}
+
+// PUT /admin/faults
+func (a *Admin) HandlePutFaults(w http.ResponseWriter, r *http.Request) {
+	var req FaultUpdateRequest
+	if !a.decode(w, r, &req) {
+		return
+	}
+
+	before := a.Faults.Config()
+	cfg, fieldErrors := a.Faults.Merge(before, req)
+	if len(fieldErrors) > 0 {
+		a.invalid(w, r, fieldErrors)
+		return
+	}
+
+	a.Faults.Apply(cfg)
+	after := a.Faults.Config()
+	a.audit(r, "fault_injection_config_changed", before, after)
+	writeJSON(w, after)
+}
+
+// GET /admin/scenario
+func (a *Admin) HandleGetScenario(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, a.Scenario.Status())
+}
+
+// POST /admin/scenario/start: sem corpo, executa o cenário carregado; com
+// um cenário no corpo (JSON, ou YAML com Content-Type application/yaml),
+// carrega-o e executa
+func (a *Admin) HandleStartScenario(w http.ResponseWriter, r *http.Request) {
+	var err error
+	if r.ContentLength != 0 {
+		var sc Scenario
+		if isYAMLContentType(r.Header.Get("Content-Type")) {
+			var ok bool
+			if sc, ok = a.decodeYAMLScenario(w, r); !ok {
+				return
+			}
+		} else if !a.decode(w, r, &sc) {
+			return
+		}
+		if errs := a.Scenario.Validate(sc); len(errs) > 0 {
+			a.invalid(w, r, errs)
+			return
+		}
+		err = a.Scenario.LoadAndStart(sc, "api")
+	} else {
+		err = a.Scenario.Start()
+	}
+	if err != nil {
+		problem.Error(w, r, http.StatusConflict, "scenario_conflict", err.Error())
+		return
+	}
+	a.auditScenario(r, "start")
+	writeJSON(w, a.Scenario.Status())
+}
+
+// POST /admin/scenario/stop (idempotente)
+func (a *Admin) HandleStopScenario(w http.ResponseWriter, r *http.Request) {
+	if a.Scenario.Stop() {
+		a.auditScenario(r, "stop")
+	}
+	writeJSON(w, a.Scenario.Status())
+}
+
+func isYAMLContentType(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/yaml", "application/x-yaml", "text/yaml":
+		return true
+	}
+	return false
+}
+
+func (a *Admin) decodeYAMLScenario(w http.ResponseWriter, r *http.Request) (Scenario, bool) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxAdminBodyBytes))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			problem.Error(w, r, http.StatusRequestEntityTooLarge, "body_too_large", err.Error())
+		} else {
+			problem.Error(w, r, http.StatusBadRequest, "invalid_yaml", err.Error())
+		}
+		return Scenario{}, false
+	}
+	sc, err := ParseScenarioYAML(data)
+	if err != nil {
+		problem.Error(w, r, http.StatusBadRequest, "invalid_yaml", err.Error())
+		return Scenario{}, false
+	}
+	return sc, true
+}
+
+// audit registra quem alterou, de onde e o que mudou
+func (a *Admin) audit(r *http.Request, event string, before, after interface{}) {
+	a.logger().Warn(event, a.contextFields(r.Context(),
+		zap.Any("before", before),
+		zap.Any("after", after),
+		zap.String("client_id", a.clientID(r)),
+		zap.String("remote_addr", r.RemoteAddr),
+		zap.String("user_agent", r.UserAgent()),
+	)...)
+}
+
+// auditScenario registra quem iniciou ou parou o cenário
+func (a *Admin) auditScenario(r *http.Request, action string) {
+	a.logger().Warn("chaos_scenario_control", a.contextFields(r.Context(),
+		zap.String("action", action),
+		zap.String("client_id", a.clientID(r)),
+		zap.String("remote_addr", r.RemoteAddr),
+		zap.String("user_agent", r.UserAgent()),
+	)...)
+}
+
+func (a *Admin) clientID(r *http.Request) string {
+	if a.ClientID != nil {
+		return a.ClientID(r)
+	}
+	return r.Header.Get("X-Client-ID")
+}
+
+func (a *Admin) decode(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	if a.Decode != nil {
+		return a.Decode(w, r, dst)
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxAdminBodyBytes)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(dst)
+	if err == nil && dec.Decode(&struct{}{}) != io.EOF {
+		err = errors.New("request body must contain a single JSON object")
+	}
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			problem.Error(w, r, http.StatusRequestEntityTooLarge, "body_too_large", err.Error())
+		} else {
+			problem.Error(w, r, http.StatusBadRequest, "invalid_json", err.Error())
+		}
+		return false
+	}
+	return true
+}
+
+func (a *Admin) invalid(w http.ResponseWriter, r *http.Request, errs []FieldError) {
+	if a.Invalid != nil {
+		a.Invalid(w, r, errs)
+		return
+	}
+	p := problem.New(http.StatusUnprocessableEntity, "validation_failed", "request body failed validation")
+	p.Errors = errs
+	problem.Write(w, r, p)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,139 @@
+// Package chaos reúne o lag intencional e a injeção de falhas usados pelos
+// serviços: delays fixos ou sorteados por distribuição, regras de lag
+// direcionado, falhas por estágio, métricas intentional_lag_* e
+// intentional_fault_*, cenários em fases (JSON ou YAML) e os handlers de
+// /admin/lag, /admin/faults e /admin/scenario. Cada serviço declara os
+// próprios estágios; as métricas são registradas no registry padrão do
+// Prometheus, então cada processo cria no máximo um LagController, um
+// FaultInjector e um ScenarioRunner.
+package chaos
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"shared/problem"
+)
+
+// Limite de cada delay (e de cada timeout injetado) configurável em runtime
+const MaxDelayMs = 60000
+
+// Nomes de regras e estágios: usados em métricas, JSON e variáveis de ambiente
+var (
+	namePattern  = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+	stagePattern = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+)
+
+// FieldError descreve um campo inválido (tipo de shared/problem)
+type FieldError = problem.FieldError
+
+// Options são as dependências comuns aos controladores
+type Options struct {
+	Logger *zap.Logger
+	// Campos de log extraídos do contexto da requisição ou mensagem
+	// (ex: correlation_id, trace_id); opcional
+	ContextFields func(ctx context.Context) []zap.Field
+}
+
+func (o Options) logger() *zap.Logger {
+	if o.Logger == nil {
+		return zap.NewNop()
+	}
+	return o.Logger
+}
+
+func (o Options) contextFields(ctx context.Context, fields ...zap.Field) []zap.Field {
+	if o.ContextFields == nil {
+		return fields
+	}
+	return append(fields, o.ContextFields(ctx)...)
+}
+
+// randSource abstrai a fonte aleatória: global ou com seed fixa
+type randSource interface {
+	Float64() float64
+	NormFloat64() float64
+}
+
+type globalRand struct{}
+
+func (globalRand) Float64() float64     { return rand.Float64() }
+func (globalRand) NormFloat64() float64 { return rand.NormFloat64() }
+
+// seededRand é determinística para uma mesma seed e sequência de chamadas
+type seededRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+func newRandSource(seed *int64) randSource {
+	if seed == nil {
+		return globalRand{}
+	}
+	return &seededRand{r: rand.New(rand.NewSource(*seed))}
+}
+
+func (s *seededRand) Float64() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.r.Float64()
+}
+
+func (s *seededRand) NormFloat64() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.r.NormFloat64()
+}
+
+// mustValidStage impede estágios que gerariam nomes de métrica inválidos
+func mustValidStage(name string) {
+	if !stagePattern.MatchString(name) {
+		panic(fmt.Sprintf("chaos: invalid stage name %q", name))
+	}
+}
+
+// envName converte o estágio para variáveis de ambiente ("external-service" -> "EXTERNAL_SERVICE")
+func envName(stage string) string {
+	return strings.ToUpper(strings.ReplaceAll(stage, "-", "_"))
+}
+
+func containsString(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, v string) bool {
+	for _, s := range values {
+		if strings.EqualFold(s, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSeed interpreta o campo seed das atualizações: número fixa a seed,
+// null volta ao gerador aleatório global
+func parseSeed(raw []byte, current *int64) (*int64, []FieldError) {
+	if len(raw) == 0 {
+		return current, nil
+	}
+	if string(raw) == "null" {
+		return nil, nil
+	}
+	var seed int64
+	if err := json.Unmarshal(raw, &seed); err != nil {
+		return current, []FieldError{{Field: "seed", Code: "invalid_type", Message: "must be an integer or null"}}
+	}
+	return &seed, nil
+}
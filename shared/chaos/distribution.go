@@ -0,0 +1,194 @@
+package chaos
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================================
+// DISTRIBUIÇÕES DE LATÊNCIA (lag intencional com cauda longa)
+// ============================================================================
+
+const (
+	DistributionFixed     = "fixed"
+	DistributionUniform   = "uniform"
+	DistributionNormal    = "normal"
+	DistributionLogNormal = "lognormal"
+	DistributionPareto    = "pareto"
+	DistributionBimodal   = "bimodal"
+)
+
+// LatencyDistribution descreve como sortear o delay de um estágio. Todos os
+// valores estão em milissegundos; apenas os campos do tipo escolhido são usados:
+//
+//	fixed:     valueMs
+//	uniform:   minMs, maxMs
+//	normal:    meanMs, jitterMs (desvio padrão)
+//	lognormal: medianMs, sigma
+//	pareto:    scaleMs (mínimo), alpha (quanto menor, mais pesada a cauda)
+//	bimodal:   meanMs/jitterMs (modo rápido), slowMeanMs/slowJitterMs e
+//	           slowProbability (fração de requisições no modo lento)
+//
+// maxMs limita o valor sorteado em qualquer tipo (padrão: 60000)
+type LatencyDistribution struct {
+	Type            string  `json:"type"`
+	ValueMs         float64 `json:"valueMs,omitempty"`
+	MinMs           float64 `json:"minMs,omitempty"`
+	MaxMs           float64 `json:"maxMs,omitempty"`
+	MeanMs          float64 `json:"meanMs,omitempty"`
+	JitterMs        float64 `json:"jitterMs,omitempty"`
+	MedianMs        float64 `json:"medianMs,omitempty"`
+	Sigma           float64 `json:"sigma,omitempty"`
+	ScaleMs         float64 `json:"scaleMs,omitempty"`
+	Alpha           float64 `json:"alpha,omitempty"`
+	SlowMeanMs      float64 `json:"slowMeanMs,omitempty"`
+	SlowJitterMs    float64 `json:"slowJitterMs,omitempty"`
+	SlowProbability float64 `json:"slowProbability,omitempty"`
+}
+
+func (d LatencyDistribution) capMs() float64 {
+	if d.MaxMs > 0 {
+		return d.MaxMs
+	}
+	return MaxDelayMs
+}
+
+// sample sorteia um delay, limitado a [0, maxMs]
+func (d LatencyDistribution) sample(r randSource) time.Duration {
+	var ms float64
+	switch d.Type {
+	case DistributionFixed:
+		ms = d.ValueMs
+	case DistributionUniform:
+		ms = d.MinMs + r.Float64()*(d.MaxMs-d.MinMs)
+	case DistributionNormal:
+		ms = d.MeanMs + d.JitterMs*r.NormFloat64()
+	case DistributionLogNormal:
+		ms = d.MedianMs * math.Exp(d.Sigma*r.NormFloat64())
+	case DistributionPareto:
+		// Inversa da CDF: xm / U^(1/alpha), com U em (0, 1]
+		ms = d.ScaleMs / math.Pow(1-r.Float64(), 1/d.Alpha)
+	case DistributionBimodal:
+		if r.Float64() < d.SlowProbability {
+			ms = d.SlowMeanMs + d.SlowJitterMs*r.NormFloat64()
+		} else {
+			ms = d.MeanMs + d.JitterMs*r.NormFloat64()
+		}
+	}
+	ms = math.Min(math.Max(ms, 0), d.capMs())
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// Mean retorna o valor esperado em ms (aproximado, ignorando o corte em 0),
+// usado nos gauges de configuração
+func (d LatencyDistribution) Mean() float64 {
+	var ms float64
+	switch d.Type {
+	case DistributionFixed:
+		ms = d.ValueMs
+	case DistributionUniform:
+		ms = (d.MinMs + d.MaxMs) / 2
+	case DistributionNormal:
+		ms = d.MeanMs
+	case DistributionLogNormal:
+		ms = d.MedianMs * math.Exp(d.Sigma*d.Sigma/2)
+	case DistributionPareto:
+		if d.Alpha <= 1 {
+			return d.capMs() // média infinita: vale o limite
+		}
+		ms = d.Alpha * d.ScaleMs / (d.Alpha - 1)
+	case DistributionBimodal:
+		ms = (1-d.SlowProbability)*d.MeanMs + d.SlowProbability*d.SlowMeanMs
+	}
+	return math.Min(ms, d.capMs())
+}
+
+// Validate retorna os erros de campo, prefixados com o nome do estágio
+func (d LatencyDistribution) Validate(prefix string) []FieldError {
+	var errs []FieldError
+	field := func(name string) string { return prefix + "." + name }
+	inRange := func(name string, v, min float64) {
+		if v < min || v > MaxDelayMs {
+			errs = append(errs, FieldError{Field: field(name), Code: "out_of_range",
+				Message: fmt.Sprintf("must be between %g and %d", min, MaxDelayMs)})
+		}
+	}
+	positive := func(name string, v float64) {
+		if v <= 0 {
+			errs = append(errs, FieldError{Field: field(name), Code: "must_be_positive", Message: "must be greater than zero"})
+		}
+	}
+
+	if d.Type != DistributionUniform {
+		inRange("maxMs", d.MaxMs, 0)
+	}
+	switch d.Type {
+	case DistributionFixed:
+		inRange("valueMs", d.ValueMs, 0)
+	case DistributionUniform:
+		inRange("minMs", d.MinMs, 0)
+		inRange("maxMs", d.MaxMs, d.MinMs)
+	case DistributionNormal:
+		inRange("meanMs", d.MeanMs, 0)
+		inRange("jitterMs", d.JitterMs, 0)
+	case DistributionLogNormal:
+		positive("medianMs", d.MedianMs)
+		inRange("medianMs", d.MedianMs, 0)
+		if d.Sigma < 0 || d.Sigma > 5 {
+			errs = append(errs, FieldError{Field: field("sigma"), Code: "out_of_range", Message: "must be between 0 and 5"})
+		}
+	case DistributionPareto:
+		positive("scaleMs", d.ScaleMs)
+		inRange("scaleMs", d.ScaleMs, 0)
+		positive("alpha", d.Alpha)
+	case DistributionBimodal:
+		inRange("meanMs", d.MeanMs, 0)
+		inRange("jitterMs", d.JitterMs, 0)
+		inRange("slowMeanMs", d.SlowMeanMs, 0)
+		inRange("slowJitterMs", d.SlowJitterMs, 0)
+		if d.SlowProbability < 0 || d.SlowProbability > 1 {
+			errs = append(errs, FieldError{Field: field("slowProbability"), Code: "out_of_range", Message: "must be between 0.0 and 1.0"})
+		}
+	default:
+		errs = append(errs, FieldError{Field: field("type"), Code: "invalid_value",
+			Message: "type must be one of fixed, uniform, normal, lognormal, pareto, bimodal"})
+	}
+	return errs
+}
+
+// ParseLatencyDistribution interpreta o formato compacto usado nas variáveis
+// de ambiente: "tipo:campo=valor,campo=valor", com os nomes de campo do JSON
+// (ex: "lognormal:medianMs=200,sigma=0.8,maxMs=10000")
+func ParseLatencyDistribution(spec string) (LatencyDistribution, error) {
+	typ, params, _ := strings.Cut(strings.TrimSpace(spec), ":")
+	fields := map[string]interface{}{"type": typ}
+	if params != "" {
+		for _, kv := range strings.Split(params, ",") {
+			key, value, ok := strings.Cut(strings.TrimSpace(kv), "=")
+			if !ok {
+				return LatencyDistribution{}, fmt.Errorf("invalid parameter %q: expected key=value", kv)
+			}
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return LatencyDistribution{}, fmt.Errorf("invalid value for %s: %q", key, value)
+			}
+			fields[key] = n
+		}
+	}
+
+	raw, _ := json.Marshal(fields)
+	var d LatencyDistribution
+	dec := json.NewDecoder(strings.NewReader(string(raw)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&d); err != nil {
+		return LatencyDistribution{}, fmt.Errorf("invalid distribution %q: %v", spec, err)
+	}
+	if errs := d.Validate("distribution"); len(errs) > 0 {
+		return LatencyDistribution{}, fmt.Errorf("invalid distribution %q: %s %s", spec, errs[0].Field, errs[0].Message)
+	}
+	return d, nil
+}
@@ -0,0 +1,375 @@
+package chaos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// ============================================================================
+// INJEÇÃO DE FALHAS (erros, timeouts, pânicos, respostas malformadas e
+// eventos perdidos/duplicados)
+// ============================================================================
+
+const (
+	FaultError     = "error"
+	FaultTimeout   = "timeout"
+	FaultPanic     = "panic"
+	FaultMalformed = "malformed"
+	FaultDrop      = "drop"
+	FaultDuplicate = "duplicate"
+)
+
+var (
+	ErrInjectedFault     = errors.New("injected fault")
+	ErrInjectedTimeout   = errors.New("injected timeout")
+	ErrInjectedMalformed = errors.New("injected malformed response")
+)
+
+// Duração padrão de uma chamada "pendurada" antes do erro de timeout
+const defaultFaultTimeoutMs = 3000
+
+// FaultStage descreve um estágio e as falhas que ele aceita. Pânico só deve
+// ser aceito onde há recover; malformed/drop/duplicate exigem que quem chama
+// Inject saiba aplicar o efeito (ex: truncar ou duplicar um evento)
+type FaultStage struct {
+	Name   string
+	Faults []string
+}
+
+// StageFaults define a probabilidade (0.0 a 1.0) de cada falha em um estágio.
+// No máximo uma falha é sorteada por chamada, então a soma não pode passar de 1
+type StageFaults struct {
+	Error     float64 `json:"error,omitempty"`
+	Timeout   float64 `json:"timeout,omitempty"`
+	Panic     float64 `json:"panic,omitempty"`
+	Malformed float64 `json:"malformed,omitempty"`
+	Drop      float64 `json:"drop,omitempty"`
+	Duplicate float64 `json:"duplicate,omitempty"`
+	// Quanto a chamada fica pendurada antes do timeout (padrão: 3000)
+	TimeoutMs int64 `json:"timeoutMs,omitempty"`
+}
+
+type faultProbability struct {
+	fault string
+	p     float64
+}
+
+func (s StageFaults) probabilities() []faultProbability {
+	return []faultProbability{
+		{FaultError, s.Error},
+		{FaultTimeout, s.Timeout},
+		{FaultPanic, s.Panic},
+		{FaultMalformed, s.Malformed},
+		{FaultDrop, s.Drop},
+		{FaultDuplicate, s.Duplicate},
+	}
+}
+
+func (s *StageFaults) probability(fault string) *float64 {
+	switch fault {
+	case FaultError:
+		return &s.Error
+	case FaultTimeout:
+		return &s.Timeout
+	case FaultPanic:
+		return &s.Panic
+	case FaultMalformed:
+		return &s.Malformed
+	case FaultDrop:
+		return &s.Drop
+	case FaultDuplicate:
+		return &s.Duplicate
+	}
+	return nil
+}
+
+func (s StageFaults) timeout() time.Duration {
+	if s.TimeoutMs > 0 {
+		return time.Duration(s.TimeoutMs) * time.Millisecond
+	}
+	return defaultFaultTimeoutMs * time.Millisecond
+}
+
+// validate retorna os erros de campo, prefixados com o nome do estágio
+func (s StageFaults) validate(stage string, allowed []string) []FieldError {
+	var errs []FieldError
+	total := 0.0
+	for _, fp := range s.probabilities() {
+		field := "stages." + stage + "." + fp.fault
+		switch {
+		case fp.p < 0 || fp.p > 1:
+			errs = append(errs, FieldError{Field: field, Code: "out_of_range", Message: "must be between 0.0 and 1.0"})
+		case fp.p > 0 && !containsString(allowed, fp.fault):
+			errs = append(errs, FieldError{Field: field, Code: "invalid_value",
+				Message: fmt.Sprintf("fault not supported in stage %s (allowed: %s)", stage, strings.Join(allowed, ", "))})
+		}
+		total += fp.p
+	}
+	if total > 1 {
+		errs = append(errs, FieldError{Field: "stages." + stage, Code: "out_of_range", Message: "sum of probabilities must not exceed 1.0"})
+	}
+	if s.TimeoutMs < 0 || s.TimeoutMs > MaxDelayMs {
+		errs = append(errs, FieldError{Field: "stages." + stage + ".timeoutMs", Code: "out_of_range",
+			Message: fmt.Sprintf("must be between 0 and %d", MaxDelayMs)})
+	}
+	return errs
+}
+
+// FaultConfig é a configuração completa, exposta em /admin/faults
+type FaultConfig struct {
+	Enabled bool                   `json:"enabled"`
+	Stages  map[string]StageFaults `json:"stages"`
+	Seed    *int64                 `json:"seed,omitempty"`
+}
+
+type faultMetrics struct {
+	injections  *prometheus.CounterVec
+	probability *prometheus.GaugeVec
+}
+
+type FaultInjector struct {
+	opts    Options
+	stages  []FaultStage
+	metrics faultMetrics
+
+	mu  sync.RWMutex
+	cfg FaultConfig
+	rng randSource
+}
+
+// NewFaultInjector cria o injetor habilitado e sem falhas configuradas; os
+// padrões de cada serviço entram com Apply
+func NewFaultInjector(opts Options, stages ...FaultStage) *FaultInjector {
+	for _, stage := range stages {
+		mustValidStage(stage.Name)
+	}
+	return &FaultInjector{
+		opts:   opts,
+		stages: append([]FaultStage(nil), stages...),
+		metrics: faultMetrics{
+			injections: promauto.NewCounterVec(prometheus.CounterOpts{
+				Name: "intentional_fault_injections_total",
+				Help: "Total faults injected by stage and fault type",
+			}, []string{"stage", "fault"}),
+			probability: promauto.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "intentional_fault_probability",
+				Help: "Configured probability of each injected fault by stage (0.0 to 1.0)",
+			}, []string{"stage", "fault"}),
+		},
+		cfg: FaultConfig{Enabled: true, Stages: map[string]StageFaults{}},
+		rng: globalRand{},
+	}
+}
+
+// allowed retorna as falhas aceitas pelo estágio (false = estágio desconhecido)
+func (fi *FaultInjector) allowed(stage string) ([]string, bool) {
+	for _, s := range fi.stages {
+		if s.Name == stage {
+			return s.Faults, true
+		}
+	}
+	return nil, false
+}
+
+func (fi *FaultInjector) stageNames() []string {
+	names := make([]string, len(fi.stages))
+	for i, s := range fi.stages {
+		names[i] = s.Name
+	}
+	return names
+}
+
+func copyStageFaults(src map[string]StageFaults) map[string]StageFaults {
+	dst := make(map[string]StageFaults, len(src))
+	for stage, s := range src {
+		dst[stage] = s
+	}
+	return dst
+}
+
+func (fi *FaultInjector) Config() FaultConfig {
+	fi.mu.RLock()
+	defer fi.mu.RUnlock()
+	cfg := fi.cfg
+	cfg.Stages = copyStageFaults(fi.cfg.Stages)
+	return cfg
+}
+
+// Apply troca toda a configuração de uma vez; com seed, a sequência de
+// sorteios recomeça do início
+func (fi *FaultInjector) Apply(cfg FaultConfig) {
+	fi.mu.Lock()
+	fi.cfg = cfg
+	fi.cfg.Stages = copyStageFaults(cfg.Stages)
+	fi.rng = newRandSource(cfg.Seed)
+	fi.mu.Unlock()
+
+	fi.metrics.probability.Reset()
+	if !cfg.Enabled {
+		return
+	}
+	for stage, s := range cfg.Stages {
+		for _, fp := range s.probabilities() {
+			if fp.p > 0 {
+				fi.metrics.probability.WithLabelValues(stage, fp.fault).Set(fp.p)
+			}
+		}
+	}
+}
+
+// Pick sorteia a falha do estágio ("" = nenhuma)
+func (fi *FaultInjector) Pick(stage string) (string, StageFaults) {
+	fi.mu.RLock()
+	defer fi.mu.RUnlock()
+	s, ok := fi.cfg.Stages[stage]
+	if !fi.cfg.Enabled || !ok {
+		return "", s
+	}
+	u := fi.rng.Float64()
+	for _, fp := range s.probabilities() {
+		if u < fp.p {
+			return fp.fault, s
+		}
+		u -= fp.p
+	}
+	return "", s
+}
+
+// Inject sorteia e aplica uma falha no estágio: marca o span atual e o log,
+// segura a chamada até o timeout, entra em pânico ou retorna o erro. Para
+// malformed/drop/duplicate o efeito concreto fica a cargo de quem chama
+// (ex: publicar um corpo truncado), por isso o tipo sorteado é retornado
+func (fi *FaultInjector) Inject(ctx context.Context, stage string, fields ...zap.Field) (string, error) {
+	fault, s := fi.Pick(stage)
+	if fault == "" {
+		return "", nil
+	}
+
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.Bool("fault.injected", true),
+		attribute.String("fault.type", fault),
+		attribute.String("fault.stage", stage),
+	)
+	fi.metrics.injections.WithLabelValues(stage, fault).Inc()
+	fi.opts.logger().Warn("intentional_fault_injected", fi.opts.contextFields(ctx, append([]zap.Field{
+		zap.String("fault.type", fault),
+		zap.String("fault.stage", stage),
+	}, fields...)...)...)
+
+	var err error
+	switch fault {
+	case FaultError:
+		err = fmt.Errorf("%w: %s error", ErrInjectedFault, stage)
+	case FaultTimeout:
+		timer := time.NewTimer(s.timeout())
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+		err = fmt.Errorf("%w: %s did not respond in %v", ErrInjectedTimeout, stage, s.timeout())
+	case FaultPanic:
+		panic(fmt.Sprintf("injected panic in stage %s", stage))
+	case FaultMalformed:
+		err = fmt.Errorf("%w: %s", ErrInjectedMalformed, stage)
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return fault, err
+}
+
+// FaultUpdateRequest: campos omitidos mantêm o valor atual. Cada estágio
+// enviado substitui o anterior por completo; null remove o estágio
+type FaultUpdateRequest struct {
+	Enabled *bool                   `json:"enabled"`
+	Stages  map[string]*StageFaults `json:"stages"`
+	Seed    json.RawMessage         `json:"seed"`
+}
+
+// Merge aplica a atualização parcial sobre cfg, validando cada campo
+func (fi *FaultInjector) Merge(cfg FaultConfig, req FaultUpdateRequest) (FaultConfig, []FieldError) {
+	cfg.Stages = copyStageFaults(cfg.Stages)
+	var fieldErrors []FieldError
+	if req.Enabled != nil {
+		cfg.Enabled = *req.Enabled
+	}
+	for _, stage := range sortedKeys(req.Stages) {
+		s := req.Stages[stage]
+		allowed, ok := fi.allowed(stage)
+		if !ok {
+			fieldErrors = append(fieldErrors, FieldError{Field: "stages." + stage, Code: "invalid_value",
+				Message: "stage must be one of " + strings.Join(fi.stageNames(), ", ")})
+			continue
+		}
+		if s == nil {
+			delete(cfg.Stages, stage)
+			continue
+		}
+		if errs := s.validate(stage, allowed); len(errs) > 0 {
+			fieldErrors = append(fieldErrors, errs...)
+			continue
+		}
+		cfg.Stages[stage] = *s
+	}
+	seed, errs := parseSeed(req.Seed, cfg.Seed)
+	cfg.Seed = seed
+	fieldErrors = append(fieldErrors, errs...)
+	return cfg, fieldErrors
+}
+
+// LoadEnv aplica FAULT_INJECTION_ENABLED, FAULT_INJECTION_SEED,
+// FAULT_<ESTÁGIO>_<FALHA> (probabilidade) e FAULT_<ESTÁGIO>_TIMEOUT_MS sobre
+// a configuração atual, com o estágio em maiúsculas e "-" como "_"
+// (ex: FAULT_EXTERNAL_SERVICE_ERROR=0.1)
+func (fi *FaultInjector) LoadEnv() {
+	log := fi.opts.logger()
+	cfg := fi.Config()
+	if v := os.Getenv("FAULT_INJECTION_ENABLED"); v != "" {
+		cfg.Enabled = v == "true"
+	}
+	for _, stage := range fi.stages {
+		prefix := "FAULT_" + envName(stage.Name) + "_"
+		s := cfg.Stages[stage.Name]
+		changed := false
+		for _, fp := range s.probabilities() {
+			if v, err := strconv.ParseFloat(os.Getenv(prefix+strings.ToUpper(fp.fault)), 64); err == nil {
+				*s.probability(fp.fault) = v
+				changed = true
+			}
+		}
+		if v, err := strconv.ParseInt(os.Getenv(prefix+"TIMEOUT_MS"), 10, 64); err == nil {
+			s.TimeoutMs = v
+			changed = true
+		}
+		if !changed {
+			continue
+		}
+		if errs := s.validate(stage.Name, stage.Faults); len(errs) > 0 {
+			log.Warn("invalid_fault_injection_config", zap.String("stage", stage.Name), zap.Any("errors", errs))
+			continue
+		}
+		cfg.Stages[stage.Name] = s
+	}
+	if v, err := strconv.ParseInt(os.Getenv("FAULT_INJECTION_SEED"), 10, 64); err == nil {
+		cfg.Seed = &v
+	}
+	fi.Apply(cfg)
+	log.Info("fault_injection_configured", zap.Any("config", cfg))
+}
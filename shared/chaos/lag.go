@@ -0,0 +1,579 @@
+package chaos
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// ============================================================================
+// LAG INTENCIONAL (delays por estágio, reproduzíveis com seed)
+// ============================================================================
+
+// Sufixo dos campos de delay fixo no JSON: <estágio>DelayMs
+const delayFieldSuffix = "DelayMs"
+
+// Stage descreve um estágio em que o lag intencional pode ser aplicado
+type Stage struct {
+	// Minúsculas; vira o campo <name>DelayMs, a variável
+	// INTENTIONAL_LAG_<NAME>_MS e as métricas intentional_lag_<name>_*
+	Name string
+	// Texto usado na ajuda das métricas (ex: "database", "external call")
+	Description  string
+	DefaultDelay time.Duration
+	// Buckets do histograma de delays observados (padrão: prometheus.DefBuckets)
+	Buckets []float64
+}
+
+type lagMetrics struct {
+	enabled      prometheus.Gauge
+	percentage   prometheus.Gauge
+	distribution *prometheus.GaugeVec
+	ruleHits     *prometheus.CounterVec
+	configured   map[string]prometheus.Gauge     // valor configurado por estágio
+	observed     map[string]prometheus.Histogram // delays reais aplicados
+}
+
+func newLagMetrics(stages []Stage) lagMetrics {
+	m := lagMetrics{
+		enabled: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "intentional_lag_enabled",
+			Help: "Whether intentional lag is enabled (1=enabled, 0=disabled)",
+		}),
+		percentage: promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "intentional_lag_percentage",
+			Help: "Configured fraction of requests affected by intentional lag (0.0 to 1.0)",
+		}),
+		distribution: promauto.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "intentional_lag_distribution_info",
+			Help: "Latency distribution configured for each intentional lag stage (always 1)",
+		}, []string{"stage", "type"}),
+		ruleHits: promauto.NewCounterVec(prometheus.CounterOpts{
+			Name: "intentional_lag_rule_hits_total",
+			Help: "Total requests selected by each targeted lag rule",
+		}, []string{"rule"}),
+		configured: make(map[string]prometheus.Gauge, len(stages)),
+		observed:   make(map[string]prometheus.Histogram, len(stages)),
+	}
+	for _, stage := range stages {
+		name := strings.ReplaceAll(stage.Name, "-", "_")
+		m.configured[stage.Name] = promauto.NewGauge(prometheus.GaugeOpts{
+			Name: "intentional_lag_" + name + "_duration_seconds",
+			Help: fmt.Sprintf("Configured duration of intentional %s lag in seconds", stage.Description),
+		})
+		m.observed[stage.Name] = promauto.NewHistogram(prometheus.HistogramOpts{
+			Name:    "intentional_lag_" + name + "_duration_seconds_observed",
+			Help:    fmt.Sprintf("Observed duration of intentional %s lag (histogram)", stage.Description),
+			Buckets: stage.Buckets,
+		})
+	}
+	return m
+}
+
+// LagController simula lag intencional e reproduzível nos estágios do serviço
+type LagController struct {
+	opts    Options
+	stages  []Stage
+	metrics lagMetrics
+
+	mu            sync.RWMutex
+	enabled       bool
+	delays        map[string]time.Duration
+	lagPercentage float64 // Porcentagem de requisições afetadas (0.0 a 1.0)
+	// Distribuição por estágio; estágios sem distribuição usam o delay fixo
+	distributions map[string]LatencyDistribution
+	// Com seed, os sorteios são reproduzíveis (rng reiniciada a cada Apply)
+	seed *int64
+	rng  randSource
+	// Regras de lag direcionado e contadores de acerto por regra
+	rules    []LagRule
+	ruleHits map[string]*atomic.Uint64
+}
+
+// NewLagController cria o controlador desabilitado, com os delays padrão dos
+// estágios e 100% das requisições afetadas quando habilitado
+func NewLagController(opts Options, stages ...Stage) *LagController {
+	delays := make(map[string]time.Duration, len(stages))
+	for _, stage := range stages {
+		mustValidStage(stage.Name)
+		delays[stage.Name] = stage.DefaultDelay
+	}
+	lc := &LagController{
+		opts:          opts,
+		stages:        append([]Stage(nil), stages...),
+		metrics:       newLagMetrics(stages),
+		delays:        delays,
+		lagPercentage: 1.0,
+		distributions: map[string]LatencyDistribution{},
+		rng:           globalRand{},
+		ruleHits:      map[string]*atomic.Uint64{},
+	}
+	lc.syncGauges(lc.Config())
+	return lc
+}
+
+func (lc *LagController) isStage(name string) bool {
+	for _, stage := range lc.stages {
+		if stage.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (lc *LagController) stageNames() []string {
+	names := make([]string, len(lc.stages))
+	for i, stage := range lc.stages {
+		names[i] = stage.Name
+	}
+	return names
+}
+
+func (lc *LagController) IsEnabled() bool {
+	lc.mu.RLock()
+	defer lc.mu.RUnlock()
+	return lc.enabled
+}
+
+// SetDelays altera os delays informados e a porcentagem sem reiniciar a seed
+// (rampas de cenário); estágios ausentes mantêm o valor atual
+func (lc *LagController) SetDelays(delays map[string]time.Duration, percentage float64) {
+	lc.mu.Lock()
+	for stage, delay := range delays {
+		if _, ok := lc.delays[stage]; ok {
+			lc.delays[stage] = delay
+		}
+	}
+	lc.lagPercentage = math.Min(1, math.Max(0, percentage))
+	lc.mu.Unlock()
+
+	lc.syncGauges(lc.Config())
+}
+
+func (lc *LagController) setRulesLocked(rules []LagRule) {
+	hits := make(map[string]*atomic.Uint64, len(rules))
+	for _, rule := range rules {
+		if counter, ok := lc.ruleHits[rule.Name]; ok {
+			hits[rule.Name] = counter
+		} else {
+			hits[rule.Name] = new(atomic.Uint64)
+		}
+	}
+	lc.rules = append([]LagRule(nil), rules...)
+	lc.ruleHits = hits
+}
+
+// LagConfig é a configuração completa do lag, exposta em /admin/lag. No JSON,
+// cada estágio aparece como <estágio>DelayMs (ex: databaseDelayMs)
+type LagConfig struct {
+	Enabled       bool
+	DelaysMs      map[string]int64
+	LagPercentage float64
+	// Sobrescrevem o delay fixo dos estágios presentes
+	Distributions map[string]LatencyDistribution
+	Seed          *int64
+	// Com regras, só as requisições que casarem sofrem lag (ver LagRule)
+	Rules    []LagRule
+	RuleHits map[string]uint64
+}
+
+func (c LagConfig) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	write := func(key string, value interface{}) {
+		if err != nil {
+			return
+		}
+		data, e := json.Marshal(value)
+		if e != nil {
+			err = e
+			return
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		fmt.Fprintf(&buf, "%q:", key)
+		buf.Write(data)
+	}
+
+	buf.WriteByte('{')
+	write("enabled", c.Enabled)
+	for _, stage := range sortedKeys(c.DelaysMs) {
+		write(stage+delayFieldSuffix, c.DelaysMs[stage])
+	}
+	write("lagPercentage", c.LagPercentage)
+	if len(c.Distributions) > 0 {
+		write("distributions", c.Distributions)
+	}
+	if c.Seed != nil {
+		write("seed", *c.Seed)
+	}
+	if c.Rules == nil {
+		write("rules", []LagRule{})
+	} else {
+		write("rules", c.Rules)
+	}
+	if len(c.RuleHits) > 0 {
+		write("ruleHits", c.RuleHits)
+	}
+	buf.WriteByte('}')
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func copyDistributions(src map[string]LatencyDistribution) map[string]LatencyDistribution {
+	dst := make(map[string]LatencyDistribution, len(src))
+	for stage, d := range src {
+		dst[stage] = d
+	}
+	return dst
+}
+
+func copyDelays(src map[string]int64) map[string]int64 {
+	dst := make(map[string]int64, len(src))
+	for stage, ms := range src {
+		dst[stage] = ms
+	}
+	return dst
+}
+
+func (lc *LagController) Config() LagConfig {
+	lc.mu.RLock()
+	defer lc.mu.RUnlock()
+	hits := make(map[string]uint64, len(lc.ruleHits))
+	for name, counter := range lc.ruleHits {
+		hits[name] = counter.Load()
+	}
+	delays := make(map[string]int64, len(lc.delays))
+	for stage, delay := range lc.delays {
+		delays[stage] = delay.Milliseconds()
+	}
+	return LagConfig{
+		Enabled:       lc.enabled,
+		DelaysMs:      delays,
+		LagPercentage: lc.lagPercentage,
+		Distributions: copyDistributions(lc.distributions),
+		Seed:          lc.seed,
+		Rules:         append([]LagRule{}, lc.rules...),
+		RuleHits:      hits,
+	}
+}
+
+// Apply troca toda a configuração de uma vez (sem estado intermediário
+// visível às requisições) e atualiza os gauges intentional_lag_*. Com seed,
+// a sequência de sorteios recomeça do início
+func (lc *LagController) Apply(cfg LagConfig) {
+	lc.mu.Lock()
+	lc.enabled = cfg.Enabled
+	for stage, ms := range cfg.DelaysMs {
+		if _, ok := lc.delays[stage]; ok {
+			lc.delays[stage] = time.Duration(ms) * time.Millisecond
+		}
+	}
+	lc.lagPercentage = math.Min(1, math.Max(0, cfg.LagPercentage))
+	lc.distributions = copyDistributions(cfg.Distributions)
+	lc.seed = cfg.Seed
+	lc.rng = newRandSource(cfg.Seed)
+	lc.setRulesLocked(cfg.Rules)
+	lc.mu.Unlock()
+
+	lc.syncGauges(lc.Config())
+}
+
+func (lc *LagController) syncGauges(cfg LagConfig) {
+	if cfg.Enabled {
+		lc.metrics.enabled.Set(1)
+	} else {
+		lc.metrics.enabled.Set(0)
+	}
+	lc.metrics.percentage.Set(cfg.LagPercentage)
+
+	// Com distribuição, o gauge de duração mostra o valor esperado
+	lc.metrics.distribution.Reset()
+	for _, stage := range lc.stages {
+		d, ok := cfg.Distributions[stage.Name]
+		if !ok {
+			d = LatencyDistribution{Type: DistributionFixed, ValueMs: float64(cfg.DelaysMs[stage.Name])}
+		}
+		lc.metrics.configured[stage.Name].Set(d.Mean() / 1000)
+		lc.metrics.distribution.WithLabelValues(stage.Name, d.Type).Set(1)
+	}
+}
+
+// ShouldApplyLag decide se o estágio sofre lag. Com regras configuradas,
+// apenas requisições selecionadas por Target são candidatas
+func (lc *LagController) ShouldApplyLag(ctx context.Context, stage string) bool {
+	lc.mu.RLock()
+	defer lc.mu.RUnlock()
+	if !lc.enabled {
+		return false
+	}
+	percentage := lc.lagPercentage
+	if len(lc.rules) > 0 {
+		rule, ok := ruleFromContext(ctx)
+		if !ok || !rule.appliesTo(stage) {
+			return false
+		}
+		if rule.Percentage != nil {
+			percentage = *rule.Percentage
+		}
+	}
+	return lc.rng.Float64() < percentage
+}
+
+// SampleDelay sorteia o delay do estágio e retorna o tipo de distribuição usado
+func (lc *LagController) SampleDelay(stage string) (time.Duration, string) {
+	lc.mu.RLock()
+	defer lc.mu.RUnlock()
+	if d, ok := lc.distributions[stage]; ok {
+		return d.sample(lc.rng), d.Type
+	}
+	return lc.delays[stage], DistributionFixed
+}
+
+// Inject aplica o lag do estágio quando sorteado: marca o span atual, espera
+// o delay (ou o cancelamento do contexto), observa o histograma do estágio e
+// registra o log intentional_lag_<estágio>. Retorna false sem lag
+func (lc *LagController) Inject(ctx context.Context, stage string, fields ...zap.Field) (time.Duration, bool) {
+	if !lc.ShouldApplyLag(ctx, stage) {
+		return 0, false
+	}
+	delay, distribution := lc.SampleDelay(stage)
+	rule := RuleName(ctx)
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Bool("lag.intentional", true),
+		attribute.String("lag.type", stage),
+		attribute.String("lag.rule", rule),
+		attribute.String("lag.distribution", distribution),
+		attribute.Int64("lag.duration_ms", delay.Milliseconds()),
+	)
+
+	start := time.Now()
+	timer := time.NewTimer(delay)
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		timer.Stop()
+	}
+	duration := time.Since(start)
+	if h, ok := lc.metrics.observed[stage]; ok {
+		h.Observe(duration.Seconds())
+	}
+
+	lc.opts.logger().Warn("intentional_lag_"+stage, lc.opts.contextFields(ctx, append([]zap.Field{
+		zap.String("lag.type", stage),
+		zap.String("lag.distribution", distribution),
+		zap.String("lag.rule", rule),
+		zap.Duration("lag.duration", delay),
+		zap.Duration("actual.duration", duration),
+	}, fields...)...)...)
+	return delay, true
+}
+
+// LagUpdateRequest: campos omitidos mantêm o valor atual. Os delays fixos
+// chegam como <estágio>DelayMs e são conferidos em Merge
+type LagUpdateRequest struct {
+	Enabled       *bool
+	DelaysMs      map[string]*int64
+	LagPercentage *float64
+	// Distribuição por estágio; null remove (volta ao delay fixo)
+	Distributions map[string]*LatencyDistribution
+	// Número fixa a seed; null volta ao gerador aleatório global
+	Seed json.RawMessage
+	// Substitui a lista inteira; [] remove todas as regras
+	Rules *[]LagRule
+}
+
+// UnmarshalJSON é estrito como o restante da API: campos que não são
+// conhecidos nem terminam em DelayMs geram "json: unknown field"
+func (req *LagUpdateRequest) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	*req = LagUpdateRequest{}
+	for key, raw := range fields {
+		var dst interface{}
+		switch {
+		case key == "enabled":
+			dst = &req.Enabled
+		case key == "lagPercentage":
+			dst = &req.LagPercentage
+		case key == "distributions":
+			dst = &req.Distributions
+		case key == "seed":
+			req.Seed = append(json.RawMessage(nil), raw...)
+			continue
+		case key == "rules":
+			dst = &req.Rules
+		case strings.HasSuffix(key, delayFieldSuffix) && key != delayFieldSuffix:
+			var ms *int64
+			if err := decodeField(key, raw, &ms); err != nil {
+				return err
+			}
+			if req.DelaysMs == nil {
+				req.DelaysMs = map[string]*int64{}
+			}
+			req.DelaysMs[strings.TrimSuffix(key, delayFieldSuffix)] = ms
+			continue
+		default:
+			return fmt.Errorf("json: unknown field %q", key)
+		}
+		if err := decodeField(key, raw, dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeField decodifica um campo de forma estrita, indicando o caminho do
+// campo em erros de tipo
+func decodeField(key string, raw json.RawMessage, dst interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(dst)
+	if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+		if typeErr.Field == "" {
+			typeErr.Field = key
+		} else {
+			typeErr.Field = key + "." + typeErr.Field
+		}
+	}
+	return err
+}
+
+// Merge aplica a atualização parcial sobre cfg, validando cada campo
+func (lc *LagController) Merge(cfg LagConfig, req LagUpdateRequest) (LagConfig, []FieldError) {
+	var fieldErrors []FieldError
+	if req.Enabled != nil {
+		cfg.Enabled = *req.Enabled
+	}
+	cfg.DelaysMs = copyDelays(cfg.DelaysMs)
+	for _, stage := range sortedKeys(req.DelaysMs) {
+		value := req.DelaysMs[stage]
+		field := stage + delayFieldSuffix
+		switch {
+		case !lc.isStage(stage):
+			fieldErrors = append(fieldErrors, FieldError{Field: field, Code: "unknown", Message: "field is not allowed"})
+		case value == nil:
+			continue
+		case *value < 0 || *value > MaxDelayMs:
+			fieldErrors = append(fieldErrors, FieldError{Field: field, Code: "out_of_range", Message: fmt.Sprintf("must be between 0 and %d", MaxDelayMs)})
+		default:
+			cfg.DelaysMs[stage] = *value
+		}
+	}
+	if req.LagPercentage != nil {
+		if *req.LagPercentage < 0 || *req.LagPercentage > 1 {
+			fieldErrors = append(fieldErrors, FieldError{Field: "lagPercentage", Code: "out_of_range", Message: "must be between 0.0 and 1.0"})
+		} else {
+			cfg.LagPercentage = *req.LagPercentage
+		}
+	}
+	if req.Distributions != nil {
+		cfg.Distributions = copyDistributions(cfg.Distributions)
+	}
+	for _, stage := range sortedKeys(req.Distributions) {
+		d := req.Distributions[stage]
+		if !lc.isStage(stage) {
+			fieldErrors = append(fieldErrors, FieldError{Field: "distributions." + stage, Code: "invalid_value",
+				Message: "stage must be one of " + strings.Join(lc.stageNames(), ", ")})
+			continue
+		}
+		if d == nil {
+			delete(cfg.Distributions, stage)
+			continue
+		}
+		if errs := d.Validate("distributions." + stage); len(errs) > 0 {
+			fieldErrors = append(fieldErrors, errs...)
+			continue
+		}
+		cfg.Distributions[stage] = *d
+	}
+	seed, errs := parseSeed(req.Seed, cfg.Seed)
+	cfg.Seed = seed
+	fieldErrors = append(fieldErrors, errs...)
+	if req.Rules != nil {
+		if errs := lc.validateRules(*req.Rules); len(errs) > 0 {
+			fieldErrors = append(fieldErrors, errs...)
+		} else {
+			cfg.Rules = *req.Rules
+		}
+	}
+	return cfg, fieldErrors
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// LoadEnv aplica a configuração inicial das variáveis INTENTIONAL_LAG_*:
+// ENABLED, <ESTÁGIO>_MS, PERCENTAGE, <ESTÁGIO>_DISTRIBUTION (formato
+// "tipo:campo=valor,...", ver LatencyDistribution), SEED e RULES (array JSON
+// no formato de /admin/lag)
+func (lc *LagController) LoadEnv() {
+	log := lc.opts.logger()
+	cfg := lc.Config()
+
+	if os.Getenv("INTENTIONAL_LAG_ENABLED") == "true" {
+		cfg.Enabled = true
+		log.Info("intentional_lag_enabled_from_env", zap.Bool("enabled", true))
+	}
+	for _, stage := range lc.stages {
+		prefix := "INTENTIONAL_LAG_" + envName(stage.Name)
+		if v, err := strconv.ParseInt(os.Getenv(prefix+"_MS"), 10, 64); err == nil && v >= 0 && v <= MaxDelayMs {
+			cfg.DelaysMs[stage.Name] = v
+		}
+		if spec := os.Getenv(prefix + "_DISTRIBUTION"); spec != "" {
+			d, err := ParseLatencyDistribution(spec)
+			if err != nil {
+				log.Warn("invalid_intentional_lag_distribution", zap.String("stage", stage.Name), zap.Error(err))
+				continue
+			}
+			cfg.Distributions[stage.Name] = d
+		}
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("INTENTIONAL_LAG_PERCENTAGE"), 64); err == nil {
+		cfg.LagPercentage = v
+	}
+	if v, err := strconv.ParseInt(os.Getenv("INTENTIONAL_LAG_SEED"), 10, 64); err == nil {
+		cfg.Seed = &v
+	}
+	if raw := os.Getenv("INTENTIONAL_LAG_RULES"); raw != "" {
+		var rules []LagRule
+		dec := json.NewDecoder(strings.NewReader(raw))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&rules); err != nil {
+			log.Warn("invalid_intentional_lag_rules", zap.Error(err))
+		} else if errs := lc.validateRules(rules); len(errs) > 0 {
+			log.Warn("invalid_intentional_lag_rules", zap.Any("errors", errs))
+		} else {
+			cfg.Rules = rules
+		}
+	}
+
+	// Gauges refletem a configuração efetiva (inclusive os valores padrão)
+	lc.Apply(cfg)
+}
@@ -0,0 +1,774 @@
+package chaos
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// ============================================================================
+// CENÁRIOS DE CAOS (fases temporizadas carregadas de arquivo JSON ou YAML)
+// ============================================================================
+
+const (
+	maxScenarioPhases       = 100
+	maxScenarioPhaseSeconds = 86400
+	// Intervalo de avaliação do agendador (troca de fase e rampas)
+	scenarioTick = time.Second
+)
+
+var (
+	ErrScenarioRunning   = errors.New("a scenario is already running")
+	ErrScenarioNotLoaded = errors.New("no scenario loaded")
+)
+
+// Scenario descreve um experimento em fases. Cada fase aplica, ao começar,
+// as alterações de lag e de falhas (mesmo formato de PUT /admin/lag e
+// PUT /admin/faults) e pode variar os delays linearmente até os valores de
+// ramp ao longo da duração. Ao terminar (ou ao parar), só os campos alterados
+// pelo cenário voltam ao valor anterior, e só se ainda tiverem o valor que o
+// cenário escreveu: mudanças feitas via /admin durante a execução prevalecem
+type Scenario struct {
+	Name   string  `json:"name"`
+	Repeat bool    `json:"repeat,omitempty"` // recomeça da primeira fase ao terminar
+	Phases []Phase `json:"phases"`
+}
+
+type Phase struct {
+	Name            string              `json:"name"`
+	DurationSeconds int                 `json:"durationSeconds"`
+	Lag             *LagUpdateRequest   `json:"lag,omitempty"`
+	Faults          *FaultUpdateRequest `json:"faults,omitempty"`
+	Ramp            *LagRamp            `json:"ramp,omitempty"`
+}
+
+func (p Phase) duration() time.Duration {
+	return time.Duration(p.DurationSeconds) * time.Second
+}
+
+// LagRamp: valores alcançados no fim da fase, partindo dos valores do início.
+// Como em /admin/lag, cada estágio aparece como <estágio>DelayMs
+type LagRamp struct {
+	DelaysMs      map[string]*int64
+	LagPercentage *float64
+}
+
+func (ramp *LagRamp) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	*ramp = LagRamp{}
+	for key, raw := range fields {
+		switch {
+		case key == "lagPercentage":
+			if err := decodeField(key, raw, &ramp.LagPercentage); err != nil {
+				return err
+			}
+		case strings.HasSuffix(key, delayFieldSuffix) && key != delayFieldSuffix:
+			var ms *int64
+			if err := decodeField(key, raw, &ms); err != nil {
+				return err
+			}
+			if ramp.DelaysMs == nil {
+				ramp.DelaysMs = map[string]*int64{}
+			}
+			ramp.DelaysMs[strings.TrimSuffix(key, delayFieldSuffix)] = ms
+		default:
+			return fmt.Errorf("json: unknown field %q", key)
+		}
+	}
+	return nil
+}
+
+// prefixFieldErrors indica a fase de origem de cada erro (phases[i].lag.campo)
+func prefixFieldErrors(prefix string, errs []FieldError) []FieldError {
+	for i := range errs {
+		errs[i].Field = prefix + errs[i].Field
+	}
+	return errs
+}
+
+// ParseScenario decodifica JSON de forma estrita (campos desconhecidos são erro)
+func ParseScenario(data []byte) (Scenario, error) {
+	var sc Scenario
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&sc); err != nil {
+		return Scenario{}, err
+	}
+	return sc, nil
+}
+
+// ParseScenarioYAML aceita o mesmo formato em YAML: o documento é convertido
+// para JSON e passa pela mesma decodificação estrita
+func ParseScenarioYAML(data []byte) (Scenario, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return Scenario{}, err
+	}
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return Scenario{}, fmt.Errorf("yaml: %w", err)
+	}
+	return ParseScenario(raw)
+}
+
+// isYAMLScenario decide o formato pela extensão do arquivo
+func isYAMLScenario(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// ScenarioStatus é o estado exposto em GET /admin/scenario
+type ScenarioStatus struct {
+	Loaded                string     `json:"loaded,omitempty"`
+	Source                string     `json:"source,omitempty"` // caminho do arquivo ou "api"
+	Running               bool       `json:"running"`
+	Phase                 string     `json:"phase,omitempty"`
+	PhaseIndex            int        `json:"phaseIndex"`
+	Phases                int        `json:"phases"`
+	Iteration             int        `json:"iteration"`
+	StartedAt             *time.Time `json:"startedAt,omitempty"`
+	ElapsedSeconds        float64    `json:"elapsedSeconds"`
+	PhaseRemainingSeconds float64    `json:"phaseRemainingSeconds"`
+	// Motivo do último término: completed ou stopped
+	LastResult string `json:"lastResult,omitempty"`
+}
+
+// touchedField guarda, para um campo alterado pelo cenário, o valor de antes
+// da primeira alteração e o último valor escrito pelo cenário
+type touchedField struct {
+	before interface{}
+	set    interface{}
+}
+
+type touchedFields map[string]*touchedField
+
+// record registra os campos escritos; before só é capturado na primeira vez
+func (t touchedFields) record(keys []string, before, after func(key string) interface{}) {
+	for _, key := range keys {
+		f, ok := t[key]
+		if !ok {
+			f = &touchedField{before: before(key)}
+			t[key] = f
+		}
+		f.set = after(key)
+	}
+}
+
+// overridden indica que o campo mudou desde a última escrita do cenário
+// (ex: PUT /admin/lag durante a execução)
+func (t touchedFields) overridden(key string, current interface{}) bool {
+	f, ok := t[key]
+	return ok && !reflect.DeepEqual(current, f.set)
+}
+
+// Chaves dos campos de LagConfig e FaultConfig acompanhados pelo cenário;
+// campos por estágio usam "<campo>.<estágio>"
+const (
+	fieldEnabled       = "enabled"
+	fieldLagPercentage = "lagPercentage"
+	fieldSeed          = "seed"
+	fieldRules         = "rules"
+	fieldDelayMs       = "delayMs"
+	fieldDistributions = "distributions"
+	fieldStages        = "stages"
+)
+
+func lagUpdateFields(req LagUpdateRequest) []string {
+	var keys []string
+	if req.Enabled != nil {
+		keys = append(keys, fieldEnabled)
+	}
+	for stage := range req.DelaysMs {
+		keys = append(keys, fieldDelayMs+"."+stage)
+	}
+	if req.LagPercentage != nil {
+		keys = append(keys, fieldLagPercentage)
+	}
+	for stage := range req.Distributions {
+		keys = append(keys, fieldDistributions+"."+stage)
+	}
+	if len(req.Seed) > 0 {
+		keys = append(keys, fieldSeed)
+	}
+	if req.Rules != nil {
+		keys = append(keys, fieldRules)
+	}
+	return keys
+}
+
+func lagField(cfg LagConfig, key string) interface{} {
+	field, stage, _ := strings.Cut(key, ".")
+	switch field {
+	case fieldEnabled:
+		return cfg.Enabled
+	case fieldLagPercentage:
+		return cfg.LagPercentage
+	case fieldSeed:
+		if cfg.Seed == nil {
+			return nil
+		}
+		return *cfg.Seed
+	case fieldRules:
+		return cfg.Rules
+	case fieldDelayMs:
+		return cfg.DelaysMs[stage]
+	case fieldDistributions:
+		if d, ok := cfg.Distributions[stage]; ok {
+			return d
+		}
+	}
+	return nil
+}
+
+func setLagField(cfg *LagConfig, key string, value interface{}) {
+	field, stage, _ := strings.Cut(key, ".")
+	switch field {
+	case fieldEnabled:
+		cfg.Enabled = value.(bool)
+	case fieldLagPercentage:
+		cfg.LagPercentage = value.(float64)
+	case fieldSeed:
+		cfg.Seed = nil
+		if seed, ok := value.(int64); ok {
+			cfg.Seed = &seed
+		}
+	case fieldRules:
+		cfg.Rules = value.([]LagRule)
+	case fieldDelayMs:
+		cfg.DelaysMs[stage] = value.(int64)
+	case fieldDistributions:
+		if d, ok := value.(LatencyDistribution); ok {
+			cfg.Distributions[stage] = d
+		} else {
+			delete(cfg.Distributions, stage)
+		}
+	}
+}
+
+func faultUpdateFields(req FaultUpdateRequest) []string {
+	var keys []string
+	if req.Enabled != nil {
+		keys = append(keys, fieldEnabled)
+	}
+	for stage := range req.Stages {
+		keys = append(keys, fieldStages+"."+stage)
+	}
+	if len(req.Seed) > 0 {
+		keys = append(keys, fieldSeed)
+	}
+	return keys
+}
+
+func faultField(cfg FaultConfig, key string) interface{} {
+	field, stage, _ := strings.Cut(key, ".")
+	switch field {
+	case fieldEnabled:
+		return cfg.Enabled
+	case fieldSeed:
+		if cfg.Seed == nil {
+			return nil
+		}
+		return *cfg.Seed
+	case fieldStages:
+		if s, ok := cfg.Stages[stage]; ok {
+			return s
+		}
+	}
+	return nil
+}
+
+func setFaultField(cfg *FaultConfig, key string, value interface{}) {
+	field, stage, _ := strings.Cut(key, ".")
+	switch field {
+	case fieldEnabled:
+		cfg.Enabled = value.(bool)
+	case fieldSeed:
+		cfg.Seed = nil
+		if seed, ok := value.(int64); ok {
+			cfg.Seed = &seed
+		}
+	case fieldStages:
+		if s, ok := value.(StageFaults); ok {
+			cfg.Stages[stage] = s
+		} else {
+			delete(cfg.Stages, stage)
+		}
+	}
+}
+
+type scenarioRun struct {
+	scenario   Scenario
+	startedAt  time.Time
+	phaseIndex int
+	phaseStart time.Time
+	iteration  int
+	// Configuração no início da fase (origem das rampas)
+	rampFrom LagConfig
+	// Campos alterados pelo cenário, restaurados ao terminar
+	lagFields   touchedFields
+	faultFields touchedFields
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+type scenarioMetrics struct {
+	running    prometheus.Gauge
+	phase      *prometheus.GaugeVec
+	phaseIndex prometheus.Gauge
+}
+
+// ScenarioRunner executa no máximo um cenário por vez sobre o lag e o
+// injetor de falhas do serviço (qualquer um dos dois pode ser nil)
+type ScenarioRunner struct {
+	opts    Options
+	lag     *LagController
+	faults  *FaultInjector
+	metrics scenarioMetrics
+
+	mu         sync.Mutex
+	loaded     *Scenario
+	source     string
+	run        *scenarioRun
+	lastResult string
+}
+
+// NewScenarioRunner registra as métricas chaos_scenario_*; cada processo cria
+// no máximo um
+func NewScenarioRunner(opts Options, lag *LagController, faults *FaultInjector) *ScenarioRunner {
+	return &ScenarioRunner{
+		opts:   opts,
+		lag:    lag,
+		faults: faults,
+		metrics: scenarioMetrics{
+			running: promauto.NewGauge(prometheus.GaugeOpts{
+				Name: "chaos_scenario_running",
+				Help: "Whether a chaos scenario is running (1=running, 0=idle)",
+			}),
+			phase: promauto.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "chaos_scenario_phase",
+				Help: "Current phase of the running chaos scenario (always 1)",
+			}, []string{"scenario", "phase"}),
+			phaseIndex: promauto.NewGauge(prometheus.GaugeOpts{
+				Name: "chaos_scenario_phase_index",
+				Help: "Zero-based index of the current chaos scenario phase",
+			}),
+		},
+	}
+}
+
+// Validate confere as fases aplicando cada uma sobre a configuração atual,
+// sem alterá-la
+func (sr *ScenarioRunner) Validate(sc Scenario) []FieldError {
+	var errs []FieldError
+	if !namePattern.MatchString(sc.Name) {
+		errs = append(errs, FieldError{Field: "name", Code: "invalid_format", Message: "name must match [a-zA-Z0-9_-]{1,64}"})
+	}
+	if len(sc.Phases) == 0 || len(sc.Phases) > maxScenarioPhases {
+		errs = append(errs, FieldError{Field: "phases", Code: "out_of_range", Message: fmt.Sprintf("must have between 1 and %d phases", maxScenarioPhases)})
+	}
+	var lagCfg LagConfig
+	var faultCfg FaultConfig
+	if sr.lag != nil {
+		lagCfg = sr.lag.Config()
+	}
+	if sr.faults != nil {
+		faultCfg = sr.faults.Config()
+	}
+	for i, phase := range sc.Phases {
+		prefix := fmt.Sprintf("phases[%d].", i)
+		if !namePattern.MatchString(phase.Name) {
+			errs = append(errs, FieldError{Field: prefix + "name", Code: "invalid_format", Message: "name must match [a-zA-Z0-9_-]{1,64}"})
+		}
+		if phase.DurationSeconds < 1 || phase.DurationSeconds > maxScenarioPhaseSeconds {
+			errs = append(errs, FieldError{Field: prefix + "durationSeconds", Code: "out_of_range",
+				Message: fmt.Sprintf("must be between 1 and %d", maxScenarioPhaseSeconds)})
+		}
+		if (phase.Lag != nil || phase.Ramp != nil) && sr.lag == nil {
+			errs = append(errs, FieldError{Field: prefix + "lag", Code: "unknown", Message: "service has no intentional lag"})
+			continue
+		}
+		if phase.Faults != nil && sr.faults == nil {
+			errs = append(errs, FieldError{Field: prefix + "faults", Code: "unknown", Message: "service has no fault injection"})
+			continue
+		}
+		if phase.Lag != nil {
+			var phaseErrs []FieldError
+			lagCfg, phaseErrs = sr.lag.Merge(lagCfg, *phase.Lag)
+			errs = append(errs, prefixFieldErrors(prefix+"lag.", phaseErrs)...)
+		}
+		if phase.Faults != nil {
+			var phaseErrs []FieldError
+			faultCfg, phaseErrs = sr.faults.Merge(faultCfg, *phase.Faults)
+			errs = append(errs, prefixFieldErrors(prefix+"faults.", phaseErrs)...)
+		}
+		if ramp := phase.Ramp; ramp != nil {
+			for _, stage := range sortedKeys(ramp.DelaysMs) {
+				field := prefix + "ramp." + stage + delayFieldSuffix
+				v := ramp.DelaysMs[stage]
+				switch {
+				case !sr.lag.isStage(stage):
+					errs = append(errs, FieldError{Field: field, Code: "unknown",
+						Message: "stage must be one of " + strings.Join(sr.lag.stageNames(), ", ")})
+				case v != nil && (*v < 0 || *v > MaxDelayMs):
+					errs = append(errs, FieldError{Field: field, Code: "out_of_range",
+						Message: fmt.Sprintf("must be between 0 and %d", MaxDelayMs)})
+				}
+			}
+			if v := ramp.LagPercentage; v != nil && (*v < 0 || *v > 1) {
+				errs = append(errs, FieldError{Field: prefix + "ramp.lagPercentage", Code: "out_of_range", Message: "must be between 0.0 and 1.0"})
+			}
+		}
+	}
+	return errs
+}
+
+// Load substitui o cenário carregado (não afeta um cenário em execução)
+func (sr *ScenarioRunner) Load(sc Scenario, source string) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	sr.loaded = &sc
+	sr.source = source
+}
+
+// LoadFile lê, decodifica (YAML para .yaml/.yml, JSON nos demais) e valida
+// o arquivo, carregando-o em seguida
+func (sr *ScenarioRunner) LoadFile(path string) (Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Scenario{}, err
+	}
+	parse := ParseScenario
+	if isYAMLScenario(path) {
+		parse = ParseScenarioYAML
+	}
+	sc, err := parse(data)
+	if err != nil {
+		return Scenario{}, err
+	}
+	if errs := sr.Validate(sc); len(errs) > 0 {
+		msgs := make([]string, len(errs))
+		for i, e := range errs {
+			msgs[i] = e.Field + ": " + e.Message
+		}
+		return Scenario{}, errors.New("invalid scenario: " + strings.Join(msgs, "; "))
+	}
+	sr.Load(sc, path)
+	return sc, nil
+}
+
+// Start executa o cenário carregado
+func (sr *ScenarioRunner) Start() error {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	return sr.startLocked()
+}
+
+// LoadAndStart carrega e executa o cenário, sem trocar o carregado se já
+// houver um em execução
+func (sr *ScenarioRunner) LoadAndStart(sc Scenario, source string) error {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	if sr.run != nil {
+		return ErrScenarioRunning
+	}
+	sr.loaded = &sc
+	sr.source = source
+	return sr.startLocked()
+}
+
+func (sr *ScenarioRunner) startLocked() error {
+	if sr.run != nil {
+		return ErrScenarioRunning
+	}
+	if sr.loaded == nil {
+		return ErrScenarioNotLoaded
+	}
+
+	now := time.Now()
+	run := &scenarioRun{
+		scenario:    *sr.loaded,
+		startedAt:   now,
+		lagFields:   touchedFields{},
+		faultFields: touchedFields{},
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	sr.run = run
+	sr.lastResult = ""
+	sr.metrics.running.Set(1)
+	sr.opts.logger().Warn("chaos_scenario_started",
+		zap.String("scenario", run.scenario.Name),
+		zap.String("source", sr.source),
+		zap.Int("phases", len(run.scenario.Phases)),
+	)
+	sr.enterPhase(run, 0, now)
+	go sr.loop(run)
+	return nil
+}
+
+// Stop interrompe o cenário em execução e aguarda a restauração da configuração
+func (sr *ScenarioRunner) Stop() bool {
+	sr.mu.Lock()
+	run := sr.run
+	sr.mu.Unlock()
+	if run == nil {
+		return false
+	}
+	run.stopOnce.Do(func() { close(run.stop) })
+	<-run.done
+	return true
+}
+
+func (sr *ScenarioRunner) loop(run *scenarioRun) {
+	defer close(run.done)
+	ticker := time.NewTicker(scenarioTick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-run.stop:
+			sr.finish(run, "stopped")
+			return
+		case now := <-ticker.C:
+			if !sr.advance(run, now) {
+				sr.finish(run, "completed")
+				return
+			}
+		}
+	}
+}
+
+// advance troca de fase quando a atual termina e atualiza as rampas.
+// Retorna false quando o cenário acabou
+func (sr *ScenarioRunner) advance(run *scenarioRun, now time.Time) bool {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	phase := run.scenario.Phases[run.phaseIndex]
+	// Vários ticks podem cobrir mais de uma fase curta
+	for now.Sub(run.phaseStart) >= phase.duration() {
+		next := run.phaseIndex + 1
+		if next == len(run.scenario.Phases) {
+			if !run.scenario.Repeat {
+				return false
+			}
+			next = 0
+			run.iteration++
+		}
+		sr.enterPhase(run, next, run.phaseStart.Add(phase.duration()))
+		phase = run.scenario.Phases[run.phaseIndex]
+	}
+
+	if phase.Ramp != nil {
+		progress := math.Min(1, float64(now.Sub(run.phaseStart))/float64(phase.duration()))
+		sr.applyRamp(run, *phase.Ramp, progress)
+	}
+	return true
+}
+
+// enterPhase aplica as alterações da fase (chamado com sr.mu travado)
+func (sr *ScenarioRunner) enterPhase(run *scenarioRun, index int, start time.Time) {
+	log := sr.opts.logger()
+	run.phaseIndex = index
+	run.phaseStart = start
+	phase := run.scenario.Phases[index]
+
+	if phase.Lag != nil {
+		// Validado no carregamento; erros aqui vêm de mudanças concorrentes
+		// via API e são apenas registrados
+		before := sr.lag.Config()
+		cfg, errs := sr.lag.Merge(before, *phase.Lag)
+		if len(errs) > 0 {
+			log.Error("chaos_scenario_phase_invalid", zap.String("phase", phase.Name), zap.Any("errors", errs))
+		} else {
+			sr.lag.Apply(cfg)
+			after := sr.lag.Config()
+			run.lagFields.record(lagUpdateFields(*phase.Lag),
+				func(key string) interface{} { return lagField(before, key) },
+				func(key string) interface{} { return lagField(after, key) })
+		}
+	}
+	if phase.Faults != nil {
+		before := sr.faults.Config()
+		cfg, errs := sr.faults.Merge(before, *phase.Faults)
+		if len(errs) > 0 {
+			log.Error("chaos_scenario_phase_invalid", zap.String("phase", phase.Name), zap.Any("errors", errs))
+		} else {
+			sr.faults.Apply(cfg)
+			after := sr.faults.Config()
+			run.faultFields.record(faultUpdateFields(*phase.Faults),
+				func(key string) interface{} { return faultField(before, key) },
+				func(key string) interface{} { return faultField(after, key) })
+		}
+	}
+	if sr.lag != nil {
+		run.rampFrom = sr.lag.Config()
+	}
+
+	sr.metrics.phase.Reset()
+	sr.metrics.phase.WithLabelValues(run.scenario.Name, phase.Name).Set(1)
+	sr.metrics.phaseIndex.Set(float64(index))
+	log.Warn("chaos_scenario_phase_started",
+		zap.String("scenario", run.scenario.Name),
+		zap.String("phase", phase.Name),
+		zap.Int("phase_index", index),
+		zap.Int("iteration", run.iteration),
+		zap.Int("duration_seconds", phase.DurationSeconds),
+	)
+}
+
+// applyRamp interpola linearmente entre o início da fase e os alvos de cada
+// estágio da rampa. Campos alterados via /admin/lag no meio da rampa deixam
+// de ser controlados por ela
+func (sr *ScenarioRunner) applyRamp(run *scenarioRun, ramp LagRamp, progress float64) {
+	interpolate := func(start, end float64) float64 {
+		return start + (end-start)*progress
+	}
+	before := sr.lag.Config()
+	var keys []string
+	delays := map[string]time.Duration{}
+	for stage, end := range ramp.DelaysMs {
+		key := fieldDelayMs + "." + stage
+		if end == nil || run.lagFields.overridden(key, lagField(before, key)) {
+			continue
+		}
+		ms := int64(interpolate(float64(run.rampFrom.DelaysMs[stage]), float64(*end)))
+		delays[stage] = time.Duration(ms) * time.Millisecond
+		keys = append(keys, key)
+	}
+	percentage := before.LagPercentage
+	if end := ramp.LagPercentage; end != nil && !run.lagFields.overridden(fieldLagPercentage, before.LagPercentage) {
+		percentage = interpolate(run.rampFrom.LagPercentage, *end)
+		keys = append(keys, fieldLagPercentage)
+	}
+	if len(keys) == 0 {
+		return
+	}
+	sr.lag.SetDelays(delays, percentage)
+	after := sr.lag.Config()
+	run.lagFields.record(keys,
+		func(key string) interface{} { return lagField(before, key) },
+		func(key string) interface{} { return lagField(after, key) })
+}
+
+// finish devolve ao valor anterior os campos alterados pelo cenário que ainda
+// têm o valor escrito por ele; os demais (alterados via /admin durante a
+// execução) ficam como estão
+func (sr *ScenarioRunner) finish(run *scenarioRun, result string) {
+	log := sr.opts.logger()
+	var kept []string
+	if len(run.lagFields) > 0 {
+		cfg := sr.lag.Config()
+		for _, key := range sortedKeys(run.lagFields) {
+			if run.lagFields.overridden(key, lagField(cfg, key)) {
+				kept = append(kept, "lag."+key)
+				continue
+			}
+			setLagField(&cfg, key, run.lagFields[key].before)
+		}
+		sr.lag.Apply(cfg)
+	}
+	if len(run.faultFields) > 0 {
+		cfg := sr.faults.Config()
+		for _, key := range sortedKeys(run.faultFields) {
+			if run.faultFields.overridden(key, faultField(cfg, key)) {
+				kept = append(kept, "faults."+key)
+				continue
+			}
+			setFaultField(&cfg, key, run.faultFields[key].before)
+		}
+		sr.faults.Apply(cfg)
+	}
+
+	sr.mu.Lock()
+	sr.run = nil
+	sr.lastResult = result
+	sr.mu.Unlock()
+
+	sr.metrics.running.Set(0)
+	sr.metrics.phase.Reset()
+	sr.metrics.phaseIndex.Set(0)
+	log.Warn("chaos_scenario_finished",
+		zap.String("scenario", run.scenario.Name),
+		zap.String("result", result),
+		zap.Int("iterations", run.iteration+1),
+		zap.Duration("duration", time.Since(run.startedAt)),
+		zap.Strings("kept_fields", kept),
+	)
+}
+
+// CurrentPhase retorna o cenário e a fase em execução (para spans)
+func (sr *ScenarioRunner) CurrentPhase() (scenario, phase string, ok bool) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	if sr.run == nil {
+		return "", "", false
+	}
+	return sr.run.scenario.Name, sr.run.scenario.Phases[sr.run.phaseIndex].Name, true
+}
+
+func (sr *ScenarioRunner) Status() ScenarioStatus {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	status := ScenarioStatus{Source: sr.source, LastResult: sr.lastResult}
+	if sr.loaded != nil {
+		status.Loaded = sr.loaded.Name
+		status.Phases = len(sr.loaded.Phases)
+	}
+	if run := sr.run; run != nil {
+		now := time.Now()
+		phase := run.scenario.Phases[run.phaseIndex]
+		startedAt := run.startedAt
+		status.Running = true
+		status.Phase = phase.Name
+		status.PhaseIndex = run.phaseIndex
+		status.Phases = len(run.scenario.Phases)
+		status.Iteration = run.iteration
+		status.StartedAt = &startedAt
+		status.ElapsedSeconds = now.Sub(run.startedAt).Seconds()
+		status.PhaseRemainingSeconds = math.Max(0, (phase.duration() - now.Sub(run.phaseStart)).Seconds())
+	}
+	return status
+}
+
+// LoadEnv carrega SCENARIO_FILE (JSON ou YAML) e, com SCENARIO_AUTOSTART=true,
+// inicia o cenário. Deve ser chamado depois do LoadEnv do lag e das falhas,
+// pois as fases são validadas sobre a configuração atual
+func (sr *ScenarioRunner) LoadEnv() {
+	log := sr.opts.logger()
+	path := os.Getenv("SCENARIO_FILE")
+	if path == "" {
+		return
+	}
+	sc, err := sr.LoadFile(path)
+	if err != nil {
+		log.Error("chaos_scenario_load_failed", zap.String("file", path), zap.Error(err))
+		return
+	}
+	log.Info("chaos_scenario_loaded",
+		zap.String("scenario", sc.Name),
+		zap.String("file", path),
+		zap.Int("phases", len(sc.Phases)),
+	)
+	if os.Getenv("SCENARIO_AUTOSTART") == "true" {
+		sr.Start()
+	}
+}
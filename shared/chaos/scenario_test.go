@@ -0,0 +1,79 @@
+package chaos
+
+import (
+	"testing"
+	"time"
+)
+
+const testScenarioYAML = `
+name: teste
+phases:
+  - name: lento
+    durationSeconds: 10
+    lag: {enabled: true, databaseDelayMs: 100, lagPercentage: 0.5}
+    faults:
+      stages:
+        external: {error: 0.2}
+    ramp: {databaseDelayMs: 1100}
+`
+
+// As métricas ficam no registry padrão: um controlador de cada por processo
+var (
+	testLag    = NewLagController(Options{}, Stage{Name: "database", DefaultDelay: time.Second}, Stage{Name: "cache"})
+	testFaults = NewFaultInjector(Options{}, FaultStage{Name: "external", Faults: []string{FaultError}})
+	testRunner = NewScenarioRunner(Options{}, testLag, testFaults)
+)
+
+func TestParseScenarioYAML(t *testing.T) {
+	sc, err := ParseScenarioYAML([]byte(testScenarioYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := testRunner.Validate(sc); len(errs) > 0 {
+		t.Fatalf("Validate = %v", errs)
+	}
+	phase := sc.Phases[0]
+	if *phase.Lag.DelaysMs["database"] != 100 || *phase.Ramp.DelaysMs["database"] != 1100 {
+		t.Fatalf("phase = %+v", phase)
+	}
+
+	if _, err := ParseScenarioYAML([]byte("name: x\nphases: []\nunknown: 1\n")); err == nil {
+		t.Fatal("unknown field accepted")
+	}
+	bad, _ := ParseScenarioYAML([]byte("name: x\nphases:\n  - {name: p, durationSeconds: 1, ramp: {queueDelayMs: 5}}\n"))
+	if errs := testRunner.Validate(bad); len(errs) != 1 || errs[0].Field != "phases[0].ramp.queueDelayMs" {
+		t.Fatalf("Validate(unknown ramp stage) = %v", errs)
+	}
+}
+
+func TestScenarioFinishKeepsAdminChanges(t *testing.T) {
+	sc, err := ParseScenarioYAML([]byte(testScenarioYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testLag.Apply(LagConfig{DelaysMs: map[string]int64{"database": 5, "cache": 7}, LagPercentage: 1})
+	testFaults.Apply(FaultConfig{Enabled: true})
+
+	run := &scenarioRun{scenario: sc, lagFields: touchedFields{}, faultFields: touchedFields{}}
+	testRunner.enterPhase(run, 0, time.Now())
+	testRunner.applyRamp(run, *sc.Phases[0].Ramp, 0.5)
+	if got := testLag.Config().DelaysMs["database"]; got != 600 {
+		t.Fatalf("ramp at 50%% = %d, want 600", got)
+	}
+
+	// Alterações via /admin durante a execução
+	cfg := testLag.Config()
+	cfg.LagPercentage = 0.9
+	cfg.DelaysMs["cache"] = 300
+	testLag.Apply(cfg)
+
+	testRunner.finish(run, "stopped")
+	got := testLag.Config()
+	want := map[string]int64{"database": 5, "cache": 300}
+	if got.Enabled || got.DelaysMs["database"] != want["database"] || got.DelaysMs["cache"] != want["cache"] || got.LagPercentage != 0.9 {
+		t.Fatalf("after finish = %+v, want enabled=false delays=%v lagPercentage=0.9", got, want)
+	}
+	if _, ok := testFaults.Config().Stages["external"]; ok {
+		t.Fatalf("fault stage added by the scenario was not removed: %+v", testFaults.Config())
+	}
+}
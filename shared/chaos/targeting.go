@@ -0,0 +1,138 @@
+package chaos
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ============================================================================
+// LAG DIRECIONADO (regras por endpoint, conta, moeda, header e correlation ID)
+// ============================================================================
+
+const (
+	maxLagRules          = 50
+	maxLagRuleAccountIDs = 1000
+)
+
+// LagRule seleciona as requisições (ou mensagens) afetadas pelo lag.
+// Critérios informados precisam valer todos (E); listas aceitam qualquer um
+// dos valores (OU). Com ao menos uma regra configurada, só sofrem lag as que
+// casarem com alguma regra (a primeira da lista vence)
+type LagRule struct {
+	Name string `json:"name"`
+	// Na API HTTP, "MÉTODO /rota" (ex: "POST /payments"); nos consumidores,
+	// o tipo do evento (ex: "PaymentCreated")
+	Endpoints  []string `json:"endpoints,omitempty"`
+	AccountIDs []string `json:"accountIds,omitempty"` // ex: ["acc-123"]
+	Currencies []string `json:"currencies,omitempty"` // ex: ["USD"]
+	// Valor exigido no header X-Chaos; "*" aceita qualquer valor presente
+	ChaosHeader         string `json:"chaosHeader,omitempty"`
+	CorrelationIDPrefix string `json:"correlationIdPrefix,omitempty"`
+	// Estágios afetados (padrão: todos) e fração das requisições que casam
+	// (padrão: lagPercentage)
+	Stages     []string `json:"stages,omitempty"`
+	Percentage *float64 `json:"percentage,omitempty"`
+}
+
+// LagTarget reúne os atributos avaliados pelas regras
+type LagTarget struct {
+	Endpoint      string
+	AccountID     string
+	Currency      string
+	ChaosHeader   string
+	CorrelationID string
+}
+
+func (rule LagRule) matches(t LagTarget) bool {
+	switch {
+	case len(rule.Endpoints) > 0 && !containsString(rule.Endpoints, t.Endpoint):
+		return false
+	case len(rule.AccountIDs) > 0 && !containsString(rule.AccountIDs, t.AccountID):
+		return false
+	case len(rule.Currencies) > 0 && !containsFold(rule.Currencies, t.Currency):
+		return false
+	case rule.ChaosHeader == "*" && t.ChaosHeader == "":
+		return false
+	case rule.ChaosHeader != "" && rule.ChaosHeader != "*" && rule.ChaosHeader != t.ChaosHeader:
+		return false
+	case rule.CorrelationIDPrefix != "" && !strings.HasPrefix(t.CorrelationID, rule.CorrelationIDPrefix):
+		return false
+	}
+	return true
+}
+
+func (rule LagRule) appliesTo(stage string) bool {
+	return len(rule.Stages) == 0 || containsString(rule.Stages, stage)
+}
+
+// validateRules retorna os erros de campo de cada regra (rules[i].campo)
+func (lc *LagController) validateRules(rules []LagRule) []FieldError {
+	var errs []FieldError
+	if len(rules) > maxLagRules {
+		return []FieldError{{Field: "rules", Code: "out_of_range", Message: fmt.Sprintf("at most %d rules", maxLagRules)}}
+	}
+	seen := make(map[string]bool)
+	for i, rule := range rules {
+		field := func(name string) string { return fmt.Sprintf("rules[%d].%s", i, name) }
+		if !namePattern.MatchString(rule.Name) {
+			errs = append(errs, FieldError{Field: field("name"), Code: "invalid_format", Message: "name must match [a-zA-Z0-9_-]{1,64}"})
+		} else if seen[rule.Name] {
+			errs = append(errs, FieldError{Field: field("name"), Code: "duplicate", Message: fmt.Sprintf("rule %q is defined more than once", rule.Name)})
+		}
+		seen[rule.Name] = true
+		if len(rule.Endpoints) == 0 && len(rule.AccountIDs) == 0 && len(rule.Currencies) == 0 &&
+			rule.ChaosHeader == "" && rule.CorrelationIDPrefix == "" {
+			errs = append(errs, FieldError{Field: field("name"), Code: "required",
+				Message: "rule needs at least one criterion (endpoints, accountIds, currencies, chaosHeader, correlationIdPrefix)"})
+		}
+		if len(rule.AccountIDs) > maxLagRuleAccountIDs {
+			errs = append(errs, FieldError{Field: field("accountIds"), Code: "out_of_range", Message: fmt.Sprintf("at most %d account IDs", maxLagRuleAccountIDs)})
+		}
+		for _, stage := range rule.Stages {
+			if !lc.isStage(stage) {
+				errs = append(errs, FieldError{Field: field("stages"), Code: "invalid_value", Message: fmt.Sprintf("unknown stage %q", stage)})
+			}
+		}
+		if rule.Percentage != nil && (*rule.Percentage < 0 || *rule.Percentage > 1) {
+			errs = append(errs, FieldError{Field: field("percentage"), Code: "out_of_range", Message: "must be between 0.0 and 1.0"})
+		}
+	}
+	return errs
+}
+
+type ruleContextKey struct{}
+
+// Target avalia as regras e guarda a regra vencedora no contexto, consultada
+// depois por ShouldApplyLag em cada estágio
+func (lc *LagController) Target(ctx context.Context, t LagTarget) context.Context {
+	lc.mu.RLock()
+	defer lc.mu.RUnlock()
+	if !lc.enabled || len(lc.rules) == 0 {
+		return ctx
+	}
+	for _, rule := range lc.rules {
+		if !rule.matches(t) {
+			continue
+		}
+		lc.ruleHits[rule.Name].Add(1)
+		lc.metrics.ruleHits.WithLabelValues(rule.Name).Inc()
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("lag.rule", rule.Name))
+		return context.WithValue(ctx, ruleContextKey{}, rule)
+	}
+	return ctx
+}
+
+func ruleFromContext(ctx context.Context) (LagRule, bool) {
+	rule, ok := ctx.Value(ruleContextKey{}).(LagRule)
+	return rule, ok
+}
+
+// RuleName retorna a regra que selecionou a requisição ("" = nenhuma)
+func RuleName(ctx context.Context) string {
+	rule, _ := ruleFromContext(ctx)
+	return rule.Name
+}
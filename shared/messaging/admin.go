@@ -0,0 +1,182 @@
+package messaging
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"go.uber.org/zap"
+
+	"shared/problem"
+)
+
+// ============================================================================
+// ADMIN HTTP DA DLQ (GET /admin/dlq, POST /admin/dlq/replay e /admin/dlq/purge)
+// ============================================================================
+
+// Limite do corpo das requisições de replay e purge
+const maxAdminBodyBytes = 64 << 10
+
+type DeadLetterListResponse struct {
+	Queue string       `json:"queue"`
+	Depth int          `json:"depth"`
+	Items []DeadLetter `json:"items"`
+}
+
+type DeadLetterReplayResponse struct {
+	Replayed int `json:"replayed"`
+}
+
+type DeadLetterPurgeResponse struct {
+	Purged int `json:"purged"`
+}
+
+// RegisterAdmin registra as rotas da DLQ no mux, com 405 para os demais métodos
+func (t *Topology) RegisterAdmin(mux *http.ServeMux) {
+	mux.HandleFunc("GET /admin/dlq", t.HandleList)
+	mux.HandleFunc("GET /admin/dlq/{id}", t.HandleGet)
+	mux.HandleFunc("POST /admin/dlq/replay", t.HandleReplay)
+	mux.HandleFunc("POST /admin/dlq/purge", t.HandlePurge)
+	mux.HandleFunc("/admin/dlq", problem.MethodNotAllowed(http.MethodGet))
+	mux.HandleFunc("/admin/dlq/replay", problem.MethodNotAllowed(http.MethodPost))
+	mux.HandleFunc("/admin/dlq/purge", problem.MethodNotAllowed(http.MethodPost))
+}
+
+// GET /admin/dlq?reason=max_attempts_exceeded&limit=50
+func (t *Topology) HandleList(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := 50
+	if v := query.Get("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 || limit > 1000 {
+			problem.Error(w, r, http.StatusBadRequest, "invalid_query", "limit must be between 1 and 1000")
+			return
+		}
+	}
+
+	depth, err := t.DeadLetterDepth()
+	if err != nil {
+		t.adminFailure(w, r, "failed to inspect dead-letter queue", err)
+		return
+	}
+	items, err := t.ListDeadLetters(DeadLetterFilter{Reason: query.Get("reason")}, limit)
+	if err != nil {
+		t.adminFailure(w, r, "failed to read dead-letter queue", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, DeadLetterListResponse{Queue: t.cfg.DeadLetterQueue(), Depth: depth, Items: items})
+}
+
+// GET /admin/dlq/{id}
+func (t *Topology) HandleGet(w http.ResponseWriter, r *http.Request) {
+	item, err := t.GetDeadLetter(r.PathValue("id"))
+	switch {
+	case errors.Is(err, ErrDeadLetterNotFound):
+		problem.Error(w, r, http.StatusNotFound, "dead_letter_not_found", err.Error())
+		return
+	case err != nil:
+		t.adminFailure(w, r, "failed to read dead-letter queue", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, item)
+}
+
+// POST /admin/dlq/replay {"ids": [...], "reason": "..."} ou {"all": true}
+// para reenviar a DLQ inteira; corpo vazio é rejeitado (422)
+func (t *Topology) HandleReplay(w http.ResponseWriter, r *http.Request) {
+	var sel DeadLetterSelection
+	if !decode(w, r, &sel) {
+		return
+	}
+	replayed, err := t.ReplayDeadLetters(sel)
+	if scopeInvalid(w, r, err) {
+		return
+	}
+	t.audit(r, "dead_letter_replay_requested", sel, zap.Int("replayed", replayed))
+	if err != nil {
+		t.adminFailure(w, r, "failed to replay dead-lettered messages", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, DeadLetterReplayResponse{Replayed: replayed})
+}
+
+// POST /admin/dlq/purge {"ids": [...], "reason": "..."} ou {"all": true}
+// para esvaziar a DLQ; corpo vazio é rejeitado (422)
+func (t *Topology) HandlePurge(w http.ResponseWriter, r *http.Request) {
+	var sel DeadLetterSelection
+	if !decode(w, r, &sel) {
+		return
+	}
+	purged, err := t.PurgeDeadLetters(sel)
+	if scopeInvalid(w, r, err) {
+		return
+	}
+	t.audit(r, "dead_letter_purge_requested", sel, zap.Int("purged", purged))
+	if err != nil {
+		t.adminFailure(w, r, "failed to purge dead-lettered messages", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, DeadLetterPurgeResponse{Purged: purged})
+}
+
+// scopeInvalid responde 422 quando a seleção não tem escopo explícito
+func scopeInvalid(w http.ResponseWriter, r *http.Request, err error) bool {
+	if errors.Is(err, ErrScopeRequired) || errors.Is(err, ErrScopeConflict) {
+		problem.Error(w, r, http.StatusUnprocessableEntity, "validation_failed", err.Error())
+		return true
+	}
+	return false
+}
+
+// audit registra quem alterou a DLQ, de onde e o resultado (mesmo parcial)
+func (t *Topology) audit(r *http.Request, event string, sel DeadLetterSelection, result ...zap.Field) {
+	t.logger.Warn(event, append([]zap.Field{
+		zap.String("queue", t.cfg.DeadLetterQueue()),
+		zap.Strings("ids", sel.IDs),
+		zap.String("reason", sel.Reason),
+		zap.Bool("all", sel.All),
+		zap.String("client_id", r.Header.Get("X-Client-ID")),
+		zap.String("remote_addr", r.RemoteAddr),
+	}, result...)...)
+}
+
+func (t *Topology) adminFailure(w http.ResponseWriter, r *http.Request, detail string, err error) {
+	t.logger.Error("dead_letter_admin_failed",
+		zap.String("queue", t.cfg.DeadLetterQueue()),
+		zap.String("path", r.URL.Path),
+		zap.Error(err),
+	)
+	problem.Error(w, r, http.StatusServiceUnavailable, "broker_unavailable", detail)
+}
+
+// decode lê um único objeto JSON; corpo vazio equivale a {}
+func decode(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxAdminBodyBytes)
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(dst)
+	if err == io.EOF {
+		return true
+	}
+	if err == nil && dec.Decode(&struct{}{}) != io.EOF {
+		err = errors.New("request body must contain a single JSON object")
+	}
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			problem.Error(w, r, http.StatusRequestEntityTooLarge, "body_too_large", err.Error())
+		} else {
+			problem.Error(w, r, http.StatusBadRequest, "invalid_json", err.Error())
+		}
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
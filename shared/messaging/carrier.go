@@ -0,0 +1,123 @@
+package messaging
+
+import (
+	"context"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ============================================================================
+// PROPAGAÇÃO W3C (traceparent, tracestate e baggage) NOS HEADERS AMQP
+// ============================================================================
+
+// Membro do baggage com o correlation ID, propagado do HTTP até os consumidores
+const baggageCorrelationID = "correlation_id"
+
+// HeaderCarrier adapta os headers de uma mensagem AMQP ao
+// propagation.TextMapCarrier do OpenTelemetry
+type HeaderCarrier amqp.Table
+
+func (c HeaderCarrier) Get(key string) string {
+	switch v := c[key].(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	return ""
+}
+
+func (c HeaderCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c HeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// InjectTraceContext grava o span ativo e o baggage de ctx nos headers
+// (traceparent, tracestate e baggage). headers não pode ser nil
+func InjectTraceContext(ctx context.Context, headers amqp.Table) {
+	otel.GetTextMapPropagator().Inject(ctx, HeaderCarrier(headers))
+}
+
+// ExtractTraceContext retorna ctx com o span remoto e o baggage dos headers
+func ExtractTraceContext(ctx context.Context, headers amqp.Table) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, HeaderCarrier(headers))
+}
+
+// WithCorrelationBaggage adiciona o correlation ID ao baggage de ctx. IDs com
+// caracteres não permitidos no baggage ficam de fora (seguem no header
+// X-Correlation-ID)
+func WithCorrelationBaggage(ctx context.Context, correlationID string) context.Context {
+	member, err := baggage.NewMember(baggageCorrelationID, correlationID)
+	if err != nil {
+		return ctx
+	}
+	b, err := baggage.FromContext(ctx).SetMember(member)
+	if err != nil {
+		return ctx
+	}
+	return baggage.ContextWithBaggage(ctx, b)
+}
+
+// CorrelationID retorna o correlation ID da mensagem: o header
+// X-Correlation-ID ou, na falta dele, o membro do baggage extraído
+func CorrelationID(ctx context.Context, headers amqp.Table) string {
+	if id := HeaderCarrier(headers).Get("X-Correlation-ID"); id != "" {
+		return id
+	}
+	return baggage.FromContext(ctx).Member(baggageCorrelationID).Value()
+}
+
+// PublishSpanOptions marca o span de publicação como producer, com os
+// atributos de mensageria da convenção semântica
+func PublishSpanOptions(exchange, routingKey string, msg amqp.Publishing) []trace.SpanStartOption {
+	attrs := []attribute.KeyValue{
+		semconv.MessagingSystemRabbitmq,
+		semconv.MessagingOperationPublish,
+		semconv.MessagingDestinationName(exchange),
+		semconv.MessagingMessageID(msg.MessageId),
+		semconv.MessagingMessageBodySize(len(msg.Body)),
+	}
+	if routingKey != "" {
+		attrs = append(attrs, semconv.MessagingRabbitmqDestinationRoutingKey(routingKey))
+	}
+	if id := HeaderCarrier(msg.Headers).Get("X-Correlation-ID"); id != "" {
+		attrs = append(attrs, semconv.MessagingMessageConversationID(id))
+	}
+	return []trace.SpanStartOption{trace.WithSpanKind(trace.SpanKindProducer), trace.WithAttributes(attrs...)}
+}
+
+// ConsumeSpanOptions marca o span de processamento de uma entrega como
+// consumer, com os atributos de mensageria da convenção semântica e a
+// tentativa (x-attempt)
+func ConsumeSpanOptions(queue string, msg amqp.Delivery) []trace.SpanStartOption {
+	attrs := []attribute.KeyValue{
+		semconv.MessagingSystemRabbitmq,
+		semconv.MessagingOperationDeliver,
+		semconv.MessagingDestinationName(msg.Exchange),
+		semconv.MessagingMessageID(msg.MessageId),
+		semconv.MessagingMessageBodySize(len(msg.Body)),
+		semconv.MessagingClientID(msg.ConsumerTag),
+		attribute.String("messaging.rabbitmq.queue", queue),
+		attribute.Int("messaging.rabbitmq.attempt", Attempt(msg)),
+		attribute.Bool("messaging.rabbitmq.redelivered", msg.Redelivered),
+	}
+	if msg.RoutingKey != "" {
+		attrs = append(attrs, semconv.MessagingRabbitmqDestinationRoutingKey(msg.RoutingKey))
+	}
+	if id := HeaderCarrier(msg.Headers).Get("X-Correlation-ID"); id != "" {
+		attrs = append(attrs, semconv.MessagingMessageConversationID(id))
+	}
+	return []trace.SpanStartOption{trace.WithSpanKind(trace.SpanKindConsumer), trace.WithAttributes(attrs...)}
+}
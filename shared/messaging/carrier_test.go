@@ -0,0 +1,69 @@
+package messaging
+
+import (
+	"context"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTraceContextRoundTrip(t *testing.T) {
+	previous := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	t.Cleanup(func() { otel.SetTextMapPropagator(previous) })
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	state, _ := trace.ParseTraceState("vendor=value")
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled, TraceState: state,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+	ctx = WithCorrelationBaggage(ctx, "corr-123")
+
+	headers := amqp.Table{}
+	InjectTraceContext(ctx, headers)
+	for _, key := range []string{"traceparent", "tracestate", "baggage"} {
+		if _, ok := headers[key].(string); !ok {
+			t.Fatalf("header %q not injected: %v", key, headers)
+		}
+	}
+
+	// O broker pode entregar os headers como []byte
+	headers["tracestate"] = []byte(headers["tracestate"].(string))
+
+	extracted := ExtractTraceContext(context.Background(), headers)
+	got := trace.SpanContextFromContext(extracted)
+	if got.TraceID() != traceID || got.SpanID() != spanID || !got.IsSampled() || !got.IsRemote() {
+		t.Fatalf("span context = %+v", got)
+	}
+	if got.TraceState().String() != "vendor=value" {
+		t.Fatalf("tracestate = %q", got.TraceState().String())
+	}
+	if id := CorrelationID(extracted, headers); id != "corr-123" {
+		t.Fatalf("CorrelationID from baggage = %q", id)
+	}
+
+	// X-Correlation-ID tem precedência sobre o baggage
+	headers["X-Correlation-ID"] = "corr-header"
+	if id := CorrelationID(extracted, headers); id != "corr-header" {
+		t.Fatalf("CorrelationID from header = %q", id)
+	}
+}
+
+func TestHeaderCarrier(t *testing.T) {
+	c := HeaderCarrier(amqp.Table{"bytes": []byte("b"), "number": int32(1)})
+	c.Set("text", "t")
+	tests := map[string]string{"bytes": "b", "text": "t", "number": "", "missing": ""}
+	for key, want := range tests {
+		if got := c.Get(key); got != want {
+			t.Errorf("Get(%q) = %q, want %q", key, got, want)
+		}
+	}
+	if keys := c.Keys(); len(keys) != 3 {
+		t.Errorf("Keys() = %v, want 3 keys", keys)
+	}
+}
@@ -0,0 +1,236 @@
+package messaging
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ============================================================================
+// OPERAÇÕES DA DLQ (listar, inspecionar, reenviar e descartar)
+// ============================================================================
+
+var (
+	// ErrDeadLetterNotFound indica que nenhuma mensagem da DLQ tem o ID informado
+	ErrDeadLetterNotFound = errors.New("dead-lettered message not found")
+	// ErrScopeRequired: replay ou purge sem ids nem reason exige "all": true
+	ErrScopeRequired = errors.New(`"ids", "reason" or "all": true is required`)
+	// ErrScopeConflict: "all" não pode ser combinado com ids ou reason
+	ErrScopeConflict = errors.New(`"all" cannot be combined with "ids" or "reason"`)
+)
+
+// DeadLetter é a visão de uma mensagem da DLQ
+type DeadLetter struct {
+	MessageID      string          `json:"messageId"`
+	Type           string          `json:"type,omitempty"`
+	Reason         string          `json:"reason"`
+	Error          string          `json:"error,omitempty"`
+	Attempts       int             `json:"attempts"`
+	DeadLetteredAt *time.Time      `json:"deadLetteredAt,omitempty"`
+	ReplayCount    int             `json:"replayCount,omitempty"`
+	Headers        amqp.Table      `json:"headers,omitempty"`
+	Body           json.RawMessage `json:"body,omitempty"`
+	RawBody        string          `json:"rawBody,omitempty"` // corpo que não é JSON válido
+}
+
+// DeadLetterFilter seleciona mensagens por ID e/ou motivo; vazio = todas
+type DeadLetterFilter struct {
+	IDs    []string `json:"ids"`
+	Reason string   `json:"reason"`
+}
+
+func (f DeadLetterFilter) matches(d amqp.Delivery) bool {
+	if f.Reason != "" && headerString(d.Headers, HeaderDeadLetterReason) != f.Reason {
+		return false
+	}
+	if len(f.IDs) == 0 {
+		return true
+	}
+	for _, id := range f.IDs {
+		if id == d.MessageId {
+			return true
+		}
+	}
+	return false
+}
+
+func newDeadLetter(d amqp.Delivery) DeadLetter {
+	dl := DeadLetter{
+		MessageID:   d.MessageId,
+		Type:        d.Type,
+		Reason:      headerString(d.Headers, HeaderDeadLetterReason),
+		Error:       headerString(d.Headers, HeaderDeadLetterError),
+		Attempts:    Attempt(d),
+		ReplayCount: headerInt(d.Headers, HeaderReplayCount),
+		Headers:     d.Headers,
+	}
+	if at, ok := d.Headers[HeaderDeadLetteredAt].(time.Time); ok {
+		dl.DeadLetteredAt = &at
+	}
+	if json.Valid(d.Body) {
+		dl.Body = d.Body
+	} else {
+		dl.RawBody = string(d.Body)
+	}
+	return dl
+}
+
+// scan lê mensagens da DLQ em um canal próprio, até limit (0 = todas as que
+// estavam na fila no início, para não rever as que chegarem durante a
+// leitura). fn pode dar ack (remove da DLQ); as demais voltam para a fila
+// quando o canal fecha
+func (t *Topology) scan(limit int, fn func(d amqp.Delivery) (stop bool, err error)) error {
+	ch, err := t.conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	for read := 0; limit <= 0 || read < limit; read++ {
+		d, ok, err := ch.Get(t.cfg.DeadLetterQueue(), false)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		if limit <= 0 {
+			// MessageCount: mensagens restantes depois desta
+			limit = int(d.MessageCount) + 1
+		}
+		stop, err := fn(d)
+		if err != nil || stop {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeadLetterDepth retorna as mensagens na DLQ
+func (t *Topology) DeadLetterDepth() (int, error) {
+	ch, err := t.conn.Channel()
+	if err != nil {
+		return 0, err
+	}
+	defer ch.Close()
+	q, err := ch.QueueDeclarePassive(t.cfg.DeadLetterQueue(), true, false, false, false, nil)
+	if err != nil {
+		return 0, err
+	}
+	return q.Messages, nil
+}
+
+// ListDeadLetters retorna até limit mensagens que casam com o filtro, sem
+// removê-las da DLQ
+func (t *Topology) ListDeadLetters(filter DeadLetterFilter, limit int) ([]DeadLetter, error) {
+	items := []DeadLetter{}
+	err := t.scan(0, func(d amqp.Delivery) (bool, error) {
+		if filter.matches(d) {
+			items = append(items, newDeadLetter(d))
+		}
+		return len(items) >= limit, nil
+	})
+	return items, err
+}
+
+// GetDeadLetter retorna a primeira mensagem da DLQ com o ID informado
+func (t *Topology) GetDeadLetter(id string) (DeadLetter, error) {
+	items, err := t.ListDeadLetters(DeadLetterFilter{IDs: []string{id}}, 1)
+	if err != nil {
+		return DeadLetter{}, err
+	}
+	if len(items) == 0 {
+		return DeadLetter{}, ErrDeadLetterNotFound
+	}
+	return items[0], nil
+}
+
+// DeadLetterSelection escolhe as mensagens de um replay ou purge: as que
+// casam com o filtro ou, com All, a DLQ inteira. Um filtro vazio nunca
+// seleciona a DLQ inteira
+type DeadLetterSelection struct {
+	DeadLetterFilter
+	All bool `json:"all"`
+}
+
+// Validate exige um escopo explícito: ids/reason ou "all": true, nunca ambos
+func (s DeadLetterSelection) Validate() error {
+	empty := len(s.IDs) == 0 && s.Reason == ""
+	switch {
+	case s.All && !empty:
+		return ErrScopeConflict
+	case !s.All && empty:
+		return ErrScopeRequired
+	}
+	return nil
+}
+
+// ReplayDeadLetters devolve à fila principal as mensagens selecionadas, com
+// as tentativas zeradas e x-replay-count incrementado. Cada mensagem só sai
+// da DLQ depois do confirm da republicação
+func (t *Topology) ReplayDeadLetters(sel DeadLetterSelection) (int, error) {
+	if err := sel.Validate(); err != nil {
+		return 0, err
+	}
+	filter := sel.DeadLetterFilter
+	replayed := 0
+	err := t.scan(0, func(d amqp.Delivery) (bool, error) {
+		if !filter.matches(d) {
+			return false, nil
+		}
+		pub := republishing(d, nil)
+		reason := headerString(d.Headers, HeaderDeadLetterReason)
+		delete(pub.Headers, HeaderAttempt)
+		delete(pub.Headers, HeaderDeadLetterReason)
+		delete(pub.Headers, HeaderDeadLetterError)
+		delete(pub.Headers, HeaderDeadLetteredAt)
+		pub.Headers[HeaderReplayCount] = int32(headerInt(d.Headers, HeaderReplayCount) + 1)
+		if err := t.publish("", t.cfg.Queue, pub); err != nil {
+			return true, err
+		}
+		if err := d.Ack(false); err != nil {
+			return true, err
+		}
+		replayed++
+		deadLetterReplayed.WithLabelValues(t.cfg.Queue, reason).Inc()
+		return false, nil
+	})
+	return replayed, err
+}
+
+// PurgeDeadLetters descarta as mensagens selecionadas
+func (t *Topology) PurgeDeadLetters(sel DeadLetterSelection) (int, error) {
+	if err := sel.Validate(); err != nil {
+		return 0, err
+	}
+	filter := sel.DeadLetterFilter
+	purged := 0
+	var err error
+	if sel.All {
+		purged, err = t.purgeAll()
+	} else {
+		err = t.scan(0, func(d amqp.Delivery) (bool, error) {
+			if !filter.matches(d) {
+				return false, nil
+			}
+			if err := d.Ack(false); err != nil {
+				return true, err
+			}
+			purged++
+			return false, nil
+		})
+	}
+	deadLetterPurged.WithLabelValues(t.cfg.Queue).Add(float64(purged))
+	return purged, err
+}
+
+func (t *Topology) purgeAll() (int, error) {
+	ch, err := t.conn.Channel()
+	if err != nil {
+		return 0, err
+	}
+	defer ch.Close()
+	return ch.QueuePurge(t.cfg.DeadLetterQueue(), false)
+}
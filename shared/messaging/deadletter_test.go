@@ -0,0 +1,83 @@
+package messaging
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestDeadLetterFilterMatches(t *testing.T) {
+	delivery := func(id, reason string) amqp.Delivery {
+		return amqp.Delivery{MessageId: id, Headers: amqp.Table{HeaderDeadLetterReason: reason}}
+	}
+	tests := []struct {
+		name   string
+		filter DeadLetterFilter
+		msg    amqp.Delivery
+		want   bool
+	}{
+		{"empty filter matches everything", DeadLetterFilter{}, delivery("m-1", "malformed_event"), true},
+		{"id listed", DeadLetterFilter{IDs: []string{"m-0", "m-1"}}, delivery("m-1", "malformed_event"), true},
+		{"id not listed", DeadLetterFilter{IDs: []string{"m-2"}}, delivery("m-1", "malformed_event"), false},
+		{"reason matches", DeadLetterFilter{Reason: "max_attempts_exceeded"}, delivery("m-1", "max_attempts_exceeded"), true},
+		{"reason differs", DeadLetterFilter{Reason: "max_attempts_exceeded"}, delivery("m-1", "malformed_event"), false},
+		{"reason header missing", DeadLetterFilter{Reason: "malformed_event"}, amqp.Delivery{MessageId: "m-1"}, false},
+		{"id and reason must both match", DeadLetterFilter{IDs: []string{"m-1"}, Reason: "max_attempts_exceeded"}, delivery("m-1", "malformed_event"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.matches(tt.msg); got != tt.want {
+				t.Fatalf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeadLetterSelectionValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		sel  DeadLetterSelection
+		want error
+	}{
+		{"empty", DeadLetterSelection{}, ErrScopeRequired},
+		{"ids", DeadLetterSelection{DeadLetterFilter: DeadLetterFilter{IDs: []string{"m-1"}}}, nil},
+		{"reason", DeadLetterSelection{DeadLetterFilter: DeadLetterFilter{Reason: "max_attempts_exceeded"}}, nil},
+		{"all", DeadLetterSelection{All: true}, nil},
+		{"all with ids", DeadLetterSelection{DeadLetterFilter: DeadLetterFilter{IDs: []string{"m-1"}}, All: true}, ErrScopeConflict},
+		{"all with reason", DeadLetterSelection{DeadLetterFilter: DeadLetterFilter{Reason: "malformed_event"}, All: true}, ErrScopeConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.sel.Validate(); !errors.Is(err, tt.want) {
+				t.Fatalf("Validate() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// Sem escopo explícito, replay e purge respondem 422 antes de tocar no broker
+func TestDeadLetterAdminRequiresScope(t *testing.T) {
+	topo := &Topology{}
+	handlers := map[string]http.HandlerFunc{
+		"/admin/dlq/replay": topo.HandleReplay,
+		"/admin/dlq/purge":  topo.HandlePurge,
+	}
+	for path, handler := range handlers {
+		for _, body := range []string{`{}`, `{"ids": []}`, `{"all": true, "reason": "malformed_event"}`} {
+			t.Run(path+" "+body, func(t *testing.T) {
+				rec := httptest.NewRecorder()
+				handler(rec, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+				if rec.Code != http.StatusUnprocessableEntity {
+					t.Fatalf("status = %d, want 422: %s", rec.Code, rec.Body)
+				}
+				if !strings.Contains(rec.Body.String(), `"code":"validation_failed"`) {
+					t.Fatalf("body = %s", rec.Body)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package messaging
+
+import (
+	"os"
+	"strconv"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ============================================================================
+// FILA DURÁVEL COMPARTILHADA DOS CONSUMIDORES
+// ============================================================================
+
+// Padrão de RABBIT_PREFETCH
+const DefaultPrefetch = 10
+
+// QueueConfig define a fila do serviço: durável e com nome fixo, então as
+// réplicas competem pelas mensagens e o backlog sobrevive a reinícios
+type QueueConfig struct {
+	Name string
+	// Mensagens entregues e ainda sem ack por consumidor (basic.qos); 0 = sem limite
+	Prefetch int
+}
+
+// QueueConfigFromEnv lê RABBIT_QUEUE (padrão defaultName, ex:
+// "antifraud.payments") e RABBIT_PREFETCH (padrão 10)
+func QueueConfigFromEnv(defaultName string) QueueConfig {
+	cfg := QueueConfig{Name: defaultName, Prefetch: DefaultPrefetch}
+	if v := os.Getenv("RABBIT_QUEUE"); v != "" {
+		cfg.Name = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("RABBIT_PREFETCH")); err == nil && v >= 0 {
+		cfg.Prefetch = v
+	}
+	return cfg
+}
+
+// DeclareQueue declara a exchange "payments", a fila durável e o binding, e
+// aplica o prefetch ao canal do consumidor
+func DeclareQueue(ch *amqp.Channel, cfg QueueConfig) (amqp.Queue, error) {
+	if err := ch.ExchangeDeclare("payments", "fanout", true, false, false, false, nil); err != nil {
+		return amqp.Queue{}, err
+	}
+	q, err := ch.QueueDeclare(cfg.Name, true, false, false, false, nil)
+	if err != nil {
+		return amqp.Queue{}, err
+	}
+	if err := ch.QueueBind(q.Name, "", "payments", false, nil); err != nil {
+		return amqp.Queue{}, err
+	}
+	if err := ch.Qos(cfg.Prefetch, 0, false); err != nil {
+		return amqp.Queue{}, err
+	}
+	return q, nil
+}
+
+// QueueInspector consulta a fila com declare passivo em um canal próprio:
+// um erro do broker fecha o canal, que é reaberto na consulta seguinte sem
+// afetar o canal do consumidor. Usado por uma única goroutine (ex:
+// usemetrics.MonitorQueues)
+func QueueInspector(conn *amqp.Connection) func(queue string) (messages, consumers int, err error) {
+	var ch *amqp.Channel
+	return func(queue string) (int, int, error) {
+		if ch == nil || ch.IsClosed() {
+			c, err := conn.Channel()
+			if err != nil {
+				return 0, 0, err
+			}
+			ch = c
+		}
+		q, err := ch.QueueDeclarePassive(queue, false, false, false, false, nil)
+		if err != nil {
+			return 0, 0, err
+		}
+		return q.Messages, q.Consumers, nil
+	}
+}
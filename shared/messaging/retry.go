@@ -0,0 +1,419 @@
+// Package messaging concentra o uso do RabbitMQ pelos serviços: a fila
+// durável de cada consumidor (nome e prefetch via RABBIT_QUEUE e
+// RABBIT_PREFETCH), a topologia de novas tentativas dos consumidores (filas
+// de espera com backoff exponencial cujo TTL devolve a mensagem à fila
+// principal, limite de tentativas no header x-attempt e uma dead-letter
+// exchange por serviço, com administração da DLQ via HTTP) e a propagação
+// do contexto W3C
+// (traceparent, tracestate e baggage) nos headers das mensagens.
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.uber.org/zap"
+)
+
+// Headers gravados nas mensagens republicadas
+const (
+	HeaderAttempt          = "x-attempt" // tentativa da próxima entrega (a primeira é 1)
+	HeaderDeadLetterReason = "x-dead-letter-reason"
+	HeaderDeadLetterError  = "x-dead-letter-error"
+	HeaderDeadLetteredAt   = "x-dead-lettered-at"
+	HeaderReplayCount      = "x-replay-count"
+)
+
+// Motivo das mensagens que esgotaram as tentativas; os demais motivos vêm de
+// Permanent
+const ReasonMaxAttempts = "max_attempts_exceeded"
+
+// Resultados de Settle (label outcome das métricas de confirmação dos serviços)
+const (
+	OutcomeAck        = "ack"
+	OutcomeRetry      = "retry"
+	OutcomeDeadLetter = "dead_letter"
+	OutcomeRequeue    = "requeue" // falha ao republicar: a mensagem volta para a fila
+)
+
+// Prazo do confirm do broker ao republicar uma mensagem
+const publishTimeout = 5 * time.Second
+
+// Mensagens de erro longas são cortadas no header da DLQ
+const maxErrorHeaderLen = 512
+
+var (
+	retriesScheduled = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "message_retries_total",
+			Help: "Messages sent to a delayed retry queue, by queue and next attempt",
+		},
+		[]string{"queue", "attempt"},
+	)
+
+	deadLettered = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dead_letter_messages_total",
+			Help: "Messages sent to the dead-letter queue, by queue and reason",
+		},
+		[]string{"queue", "reason"},
+	)
+
+	deadLetterReplayed = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dead_letter_replayed_total",
+			Help: "Dead-lettered messages replayed to the main queue, by queue and reason",
+		},
+		[]string{"queue", "reason"},
+	)
+
+	deadLetterPurged = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "dead_letter_purged_total",
+			Help: "Dead-lettered messages discarded through the admin API",
+		},
+		[]string{"queue"},
+	)
+)
+
+// RetryConfig define as tentativas de uma fila. A espera antes da tentativa
+// n+1 é BaseDelay * 2^(n-1), limitada a MaxDelay
+type RetryConfig struct {
+	Queue       string // fila principal: destino das novas tentativas e do replay
+	MaxAttempts int    // entregas (incluindo a primeira) antes da DLQ
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// RetryConfigFromEnv lê RETRY_MAX_ATTEMPTS (padrão 5), RETRY_BASE_DELAY_MS
+// (padrão 1000) e RETRY_MAX_DELAY_MS (padrão 60000)
+func RetryConfigFromEnv(queue string) RetryConfig {
+	cfg := RetryConfig{Queue: queue, MaxAttempts: 5, BaseDelay: time.Second, MaxDelay: time.Minute}
+	if v, err := strconv.Atoi(os.Getenv("RETRY_MAX_ATTEMPTS")); err == nil && v > 0 {
+		cfg.MaxAttempts = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("RETRY_BASE_DELAY_MS")); err == nil && v > 0 {
+		cfg.BaseDelay = time.Duration(v) * time.Millisecond
+	}
+	if v, err := strconv.Atoi(os.Getenv("RETRY_MAX_DELAY_MS")); err == nil && v > 0 {
+		cfg.MaxDelay = time.Duration(v) * time.Millisecond
+	}
+	if cfg.MaxDelay < cfg.BaseDelay {
+		cfg.MaxDelay = cfg.BaseDelay
+	}
+	return cfg
+}
+
+// Delay é a espera depois da falha da tentativa attempt
+func (c RetryConfig) Delay(attempt int) time.Duration {
+	d := c.BaseDelay
+	for i := 1; i < attempt && d < c.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > c.MaxDelay {
+		d = c.MaxDelay
+	}
+	return d
+}
+
+// RetryQueue é a fila de espera de uma duração (ex: "antifraud.payments.retry.4s").
+// O nome inclui a duração porque o TTL de uma fila não pode mudar depois de declarada
+func (c RetryConfig) RetryQueue(delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%s", c.Queue, delay)
+}
+
+// DeadLetterExchange e DeadLetterQueue recebem as mensagens que não serão mais
+// tentadas (ex: "antifraud.payments.dlx" e "antifraud.payments.dlq")
+func (c RetryConfig) DeadLetterExchange() string { return c.Queue + ".dlx" }
+func (c RetryConfig) DeadLetterQueue() string    { return c.Queue + ".dlq" }
+
+// PermanentError marca falhas que nenhuma nova tentativa resolve (ex: corpo
+// inválido): a mensagem vai direto para a DLQ com o motivo informado
+type PermanentError struct {
+	Reason string
+	Err    error
+}
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// Permanent embrulha err como falha permanente com o motivo (label reason)
+func Permanent(reason string, err error) error {
+	return &PermanentError{Reason: reason, Err: err}
+}
+
+// HeadersError carrega headers a gravar na cópia republicada (nova
+// tentativa ou DLQ), como o progresso parcial do processamento
+type HeadersError struct {
+	Headers amqp.Table
+	Err     error
+}
+
+func (e *HeadersError) Error() string { return e.Err.Error() }
+func (e *HeadersError) Unwrap() error { return e.Err }
+
+// WithHeaders embrulha err para que a próxima entrega da mensagem traga
+// headers (ex: canais já enviados, que a nova tentativa não repete)
+func WithHeaders(err error, headers amqp.Table) error {
+	return &HeadersError{Headers: headers, Err: err}
+}
+
+// Attempt retorna a tentativa de uma entrega a partir do header x-attempt
+func Attempt(msg amqp.Delivery) int {
+	if n := headerInt(msg.Headers, HeaderAttempt); n > 0 {
+		return n
+	}
+	return 1
+}
+
+// Topology declara e usa as filas de espera e a DLQ de uma fila principal.
+// Settle e as operações da DLQ podem ser chamados de várias goroutines
+type Topology struct {
+	cfg    RetryConfig
+	conn   *amqp.Connection
+	logger *zap.Logger
+
+	mu  sync.Mutex
+	pub *amqp.Channel // modo confirm; reaberto se o broker fechar
+}
+
+// NewTopology declara as filas de espera (uma por duração distinta, com TTL e
+// dead-letter de volta para a fila principal) e a DLX com a DLQ vinculada
+func NewTopology(conn *amqp.Connection, logger *zap.Logger, cfg RetryConfig) (*Topology, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	defer ch.Close()
+
+	for attempt := 1; attempt < cfg.MaxAttempts; attempt++ {
+		delay := cfg.Delay(attempt)
+		_, err := ch.QueueDeclare(cfg.RetryQueue(delay), true, false, false, false, amqp.Table{
+			"x-message-ttl":             delay.Milliseconds(),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": cfg.Queue,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("declare retry queue: %w", err)
+		}
+	}
+	if err := ch.ExchangeDeclare(cfg.DeadLetterExchange(), "fanout", true, false, false, false, nil); err != nil {
+		return nil, fmt.Errorf("declare dead-letter exchange: %w", err)
+	}
+	if _, err := ch.QueueDeclare(cfg.DeadLetterQueue(), true, false, false, false, nil); err != nil {
+		return nil, fmt.Errorf("declare dead-letter queue: %w", err)
+	}
+	if err := ch.QueueBind(cfg.DeadLetterQueue(), "", cfg.DeadLetterExchange(), false, nil); err != nil {
+		return nil, fmt.Errorf("bind dead-letter queue: %w", err)
+	}
+
+	return &Topology{cfg: cfg, conn: conn, logger: logger}, nil
+}
+
+func (t *Topology) Config() RetryConfig {
+	return t.cfg
+}
+
+// Settle confirma a mensagem conforme o resultado do processamento: ack no
+// sucesso; nas falhas a mensagem é republicada (na fila de espera ou na DLX)
+// e só então recebe ack. Se a republicação falhar, volta para a fila com
+// nack, sem perder a tentativa
+func (t *Topology) Settle(msg amqp.Delivery, procErr error) string {
+	if procErr == nil {
+		if err := msg.Ack(false); err != nil {
+			t.logSettleFailure(msg, OutcomeAck, err)
+		}
+		return OutcomeAck
+	}
+
+	attempt := Attempt(msg)
+	outcome := OutcomeRetry
+	var republishErr error
+	var permanent *PermanentError
+	switch {
+	case errors.As(procErr, &permanent):
+		outcome = OutcomeDeadLetter
+		republishErr = t.deadLetter(msg, permanent.Reason, procErr)
+	case attempt >= t.cfg.MaxAttempts:
+		outcome = OutcomeDeadLetter
+		republishErr = t.deadLetter(msg, ReasonMaxAttempts, procErr)
+	default:
+		republishErr = t.retry(msg, attempt, procErr)
+	}
+
+	if republishErr != nil {
+		t.logSettleFailure(msg, outcome, republishErr)
+		if err := msg.Nack(false, true); err != nil {
+			t.logSettleFailure(msg, OutcomeRequeue, err)
+		}
+		return OutcomeRequeue
+	}
+	if err := msg.Ack(false); err != nil {
+		// Canal fechado: o broker devolve a original e a cópia republicada
+		// gera uma entrega a mais (at-least-once)
+		t.logSettleFailure(msg, outcome, err)
+	}
+	return outcome
+}
+
+// retry publica a cópia na fila de espera da tentativa, que a devolve à
+// fila principal quando o TTL expira
+func (t *Topology) retry(msg amqp.Delivery, attempt int, procErr error) error {
+	delay := t.cfg.Delay(attempt)
+	pub := republishing(msg, procErr)
+	pub.Headers[HeaderAttempt] = int32(attempt + 1)
+	if err := t.publish("", t.cfg.RetryQueue(delay), pub); err != nil {
+		return err
+	}
+
+	retriesScheduled.WithLabelValues(t.cfg.Queue, strconv.Itoa(attempt+1)).Inc()
+	t.logger.Warn("message_retry_scheduled",
+		zap.String("queue", t.cfg.Queue),
+		zap.String("message_id", msg.MessageId),
+		zap.Int("attempt", attempt),
+		zap.Int("max_attempts", t.cfg.MaxAttempts),
+		zap.Duration("delay", delay),
+		zap.String("correlation_id", headerString(msg.Headers, "X-Correlation-ID")),
+		zap.Error(procErr),
+	)
+	return nil
+}
+
+// deadLetter publica a cópia na DLX com o motivo, o erro e o momento
+func (t *Topology) deadLetter(msg amqp.Delivery, reason string, procErr error) error {
+	errText := procErr.Error()
+	if len(errText) > maxErrorHeaderLen {
+		errText = errText[:maxErrorHeaderLen]
+	}
+	pub := republishing(msg, procErr)
+	pub.Headers[HeaderAttempt] = int32(Attempt(msg))
+	pub.Headers[HeaderDeadLetterReason] = reason
+	pub.Headers[HeaderDeadLetterError] = errText
+	pub.Headers[HeaderDeadLetteredAt] = time.Now().UTC()
+	if err := t.publish(t.cfg.DeadLetterExchange(), "", pub); err != nil {
+		return err
+	}
+
+	deadLettered.WithLabelValues(t.cfg.Queue, reason).Inc()
+	t.logger.Error("message_dead_lettered",
+		zap.String("queue", t.cfg.Queue),
+		zap.String("message_id", msg.MessageId),
+		zap.String("reason", reason),
+		zap.Int("attempt", Attempt(msg)),
+		zap.String("correlation_id", headerString(msg.Headers, "X-Correlation-ID")),
+		zap.Error(procErr),
+	)
+	return nil
+}
+
+// publish publica no canal de confirm e espera o ack do broker
+func (t *Topology) publish(exchange, routingKey string, msg amqp.Publishing) error {
+	ch, err := t.channel()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	confirmation, err := ch.PublishWithDeferredConfirmWithContext(ctx, exchange, routingKey, false, false, msg)
+	if err != nil {
+		return fmt.Errorf("publish: %w", err)
+	}
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("publish confirm: %w", err)
+	}
+	if !acked {
+		return errors.New("publish nacked by broker")
+	}
+	return nil
+}
+
+// channel retorna o canal de publicação, reabrindo-o se o broker o fechou
+func (t *Topology) channel() (*amqp.Channel, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.pub != nil && !t.pub.IsClosed() {
+		return t.pub, nil
+	}
+	ch, err := t.conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return nil, err
+	}
+	t.pub = ch
+	return ch, nil
+}
+
+// Close fecha o canal de publicação (a conexão é do serviço)
+func (t *Topology) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.pub == nil || t.pub.IsClosed() {
+		return nil
+	}
+	return t.pub.Close()
+}
+
+func (t *Topology) logSettleFailure(msg amqp.Delivery, outcome string, err error) {
+	t.logger.Error("message_settle_failed",
+		zap.String("queue", t.cfg.Queue),
+		zap.String("outcome", outcome),
+		zap.String("message_id", msg.MessageId),
+		zap.Error(err),
+	)
+}
+
+// republishing copia a entrega para uma nova publicação persistente, com os
+// headers copiados para não alterar a entrega original e sobrescritos pelos
+// do erro de processamento (WithHeaders)
+func republishing(msg amqp.Delivery, procErr error) amqp.Publishing {
+	headers := amqp.Table{}
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	var withHeaders *HeadersError
+	if errors.As(procErr, &withHeaders) {
+		for k, v := range withHeaders.Headers {
+			headers[k] = v
+		}
+	}
+	return amqp.Publishing{
+		Headers:       headers,
+		ContentType:   msg.ContentType,
+		DeliveryMode:  amqp.Persistent,
+		CorrelationId: msg.CorrelationId,
+		MessageId:     msg.MessageId,
+		Timestamp:     msg.Timestamp,
+		Type:          msg.Type,
+		Body:          msg.Body,
+	}
+}
+
+func headerString(headers amqp.Table, key string) string {
+	v, _ := headers[key].(string)
+	return v
+}
+
+func headerInt(headers amqp.Table, key string) int {
+	switch v := headers[key].(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 0
+}
@@ -0,0 +1,66 @@
+package messaging
+
+import (
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestRetryConfigDelay(t *testing.T) {
+	cfg := RetryConfig{Queue: "antifraud.payments", MaxAttempts: 5, BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, time.Second},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 8 * time.Second},
+		{5, 10 * time.Second},
+		{100, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := cfg.Delay(tt.attempt); got != tt.want {
+			t.Errorf("Delay(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestRetryConfigQueueNames(t *testing.T) {
+	cfg := RetryConfig{Queue: "antifraud.payments"}
+	tests := []struct {
+		got, want string
+	}{
+		{cfg.RetryQueue(4 * time.Second), "antifraud.payments.retry.4s"},
+		{cfg.RetryQueue(1500 * time.Millisecond), "antifraud.payments.retry.1.5s"},
+		{cfg.RetryQueue(time.Minute), "antifraud.payments.retry.1m0s"},
+		{cfg.DeadLetterExchange(), "antifraud.payments.dlx"},
+		{cfg.DeadLetterQueue(), "antifraud.payments.dlq"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("got %q, want %q", tt.got, tt.want)
+		}
+	}
+}
+
+func TestAttempt(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers amqp.Table
+		want    int
+	}{
+		{"first delivery", nil, 1},
+		{"int32 from the broker", amqp.Table{HeaderAttempt: int32(3)}, 3},
+		{"int64", amqp.Table{HeaderAttempt: int64(4)}, 4},
+		{"invalid type", amqp.Table{HeaderAttempt: "2"}, 1},
+		{"zero", amqp.Table{HeaderAttempt: int32(0)}, 1},
+	}
+	for _, tt := range tests {
+		if got := Attempt(amqp.Delivery{Headers: tt.headers}); got != tt.want {
+			t.Errorf("%s: Attempt() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+// Package money representa valores monetários de forma exata: inteiro em
+// unidades menores (centavos, por exemplo) + moeda ISO-4217. Nenhum cálculo
+// usa ponto flutuante; Float64 existe apenas para métricas.
+package money
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrUnknownCurrency  = errors.New("unknown currency")
+	ErrInvalidAmount    = errors.New("invalid amount")
+	ErrTooManyDecimals  = errors.New("amount has more decimal places than the currency allows")
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	ErrOverflow         = errors.New("amount overflow")
+)
+
+// Expoente (casas decimais) por moeda ISO-4217
+var currencyExponents = map[string]int{
+	"ARS": 2, "AUD": 2, "BHD": 3, "BRL": 2, "CAD": 2, "CHF": 2, "CLP": 0,
+	"CNY": 2, "COP": 2, "EUR": 2, "GBP": 2, "INR": 2, "ISK": 0, "JOD": 3,
+	"JPY": 0, "KRW": 0, "KWD": 3, "MXN": 2, "OMR": 3, "PEN": 2, "PYG": 0,
+	"TND": 3, "USD": 2, "UYU": 2, "VND": 0,
+}
+
+// Exponent retorna o número de casas decimais da moeda
+func Exponent(currency string) (int, error) {
+	exp, ok := currencyExponents[currency]
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownCurrency, currency)
+	}
+	return exp, nil
+}
+
+// IsKnownCurrency indica se o código ISO-4217 é suportado
+func IsKnownCurrency(currency string) bool {
+	_, ok := currencyExponents[currency]
+	return ok
+}
+
+type Money struct {
+	minor    int64
+	currency string
+}
+
+// New cria um valor a partir de unidades menores (ex: 10050 BRL = 100,50)
+func New(minor int64, currency string) (Money, error) {
+	if _, err := Exponent(currency); err != nil {
+		return Money{}, err
+	}
+	return Money{minor: minor, currency: currency}, nil
+}
+
+// Zero retorna o valor zero na moeda informada
+func Zero(currency string) (Money, error) {
+	return New(0, currency)
+}
+
+// Parse interpreta um decimal ("100.50") de forma estrita: sem notação
+// científica e sem mais casas decimais do que a moeda permite
+func Parse(decimal, currency string) (Money, error) {
+	exp, err := Exponent(currency)
+	if err != nil {
+		return Money{}, err
+	}
+
+	s := decimal
+	negative := strings.HasPrefix(s, "-")
+	if negative {
+		s = s[1:]
+	}
+	intPart, fracPart, hasDot := strings.Cut(s, ".")
+	if intPart == "" || (hasDot && fracPart == "") || !isDigits(intPart) || !isDigits(fracPart) {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, decimal)
+	}
+	if len(fracPart) > exp {
+		return Money{}, fmt.Errorf("%w: %q has %d, %s allows %d", ErrTooManyDecimals, decimal, len(fracPart), currency, exp)
+	}
+
+	digits := intPart + fracPart + strings.Repeat("0", exp-len(fracPart))
+	minor, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %q", ErrOverflow, decimal)
+	}
+	if negative {
+		minor = -minor
+	}
+	return Money{minor: minor, currency: currency}, nil
+}
+
+// ParseJSON interpreta o literal JSON de um valor (número ou string
+// contendo número) na moeda informada, com as mesmas regras de Parse
+func ParseJSON(raw json.RawMessage, currency string) (Money, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) > 0 && raw[0] == '"' {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return Money{}, fmt.Errorf("%w: %s", ErrInvalidAmount, raw)
+		}
+		return Parse(s, currency)
+	}
+	return Parse(string(raw), currency)
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (m Money) Minor() int64     { return m.minor }
+func (m Money) Currency() string { return m.currency }
+func (m Money) IsZero() bool     { return m.minor == 0 }
+func (m Money) IsPositive() bool { return m.minor > 0 }
+func (m Money) IsNegative() bool { return m.minor < 0 }
+
+// Decimal formata o valor com o número exato de casas da moeda ("100.50")
+func (m Money) Decimal() string {
+	exp := currencyExponents[m.currency]
+	minor := m.minor
+	sign := ""
+	if minor < 0 {
+		sign = "-"
+	}
+	abs := strconv.FormatUint(absUint(minor), 10)
+	if exp == 0 {
+		return sign + abs
+	}
+	if len(abs) <= exp {
+		abs = strings.Repeat("0", exp-len(abs)+1) + abs
+	}
+	return sign + abs[:len(abs)-exp] + "." + abs[len(abs)-exp:]
+}
+
+func absUint(v int64) uint64 {
+	if v < 0 {
+		return uint64(-(v + 1)) + 1
+	}
+	return uint64(v)
+}
+
+// String formata como "100.50 BRL"
+func (m Money) String() string {
+	return m.Decimal() + " " + m.currency
+}
+
+// Float64 converte para unidades maiores; usar apenas em métricas
+func (m Money) Float64() float64 {
+	return float64(m.minor) / math.Pow10(currencyExponents[m.currency])
+}
+
+func (m Money) sameCurrency(o Money) error {
+	if m.currency != o.currency {
+		return fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.currency, o.currency)
+	}
+	return nil
+}
+
+func (m Money) Add(o Money) (Money, error) {
+	if err := m.sameCurrency(o); err != nil {
+		return Money{}, err
+	}
+	sum := m.minor + o.minor
+	if (o.minor > 0 && sum < m.minor) || (o.minor < 0 && sum > m.minor) {
+		return Money{}, ErrOverflow
+	}
+	return Money{minor: sum, currency: m.currency}, nil
+}
+
+func (m Money) Sub(o Money) (Money, error) {
+	if err := m.sameCurrency(o); err != nil {
+		return Money{}, err
+	}
+	diff := m.minor - o.minor
+	if (o.minor > 0 && diff > m.minor) || (o.minor < 0 && diff < m.minor) {
+		return Money{}, ErrOverflow
+	}
+	return Money{minor: diff, currency: m.currency}, nil
+}
+
+// Cmp retorna -1, 0 ou 1 comparando m com o (mesma moeda)
+func (m Money) Cmp(o Money) (int, error) {
+	if err := m.sameCurrency(o); err != nil {
+		return 0, err
+	}
+	switch {
+	case m.minor < o.minor:
+		return -1, nil
+	case m.minor > o.minor:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// Representação JSON: {"value":"100.50","currency":"BRL"}; o valor é
+// serializado como string decimal para não passar por float64
+type jsonMoney struct {
+	Value    json.RawMessage `json:"value"`
+	Currency string          `json:"currency"`
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	if m.currency == "" {
+		return []byte("null"), nil
+	}
+	value, _ := json.Marshal(m.Decimal())
+	return json.Marshal(jsonMoney{Value: value, Currency: m.currency})
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if string(bytes.TrimSpace(data)) == "null" {
+		return nil
+	}
+	var raw jsonMoney
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&raw); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidAmount, err)
+	}
+	if len(raw.Value) == 0 {
+		return fmt.Errorf("%w: missing value", ErrInvalidAmount)
+	}
+	parsed, err := ParseJSON(raw.Value, raw.Currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
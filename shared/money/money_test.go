@@ -0,0 +1,144 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		decimal  string
+		currency string
+		minor    int64
+		err      error
+	}{
+		{"100.50", "BRL", 10050, nil},
+		{"100.5", "BRL", 10050, nil},
+		{"100", "BRL", 10000, nil},
+		{"0.01", "USD", 1, nil},
+		{"-2.30", "EUR", -230, nil},
+		{"1500", "JPY", 1500, nil},
+		{"1.234", "KWD", 1234, nil},
+		{"1.2", "BHD", 1200, nil},
+		// Mais casas do que a moeda permite: rejeitado, nunca arredondado
+		{"100.505", "BRL", 0, ErrTooManyDecimals},
+		{"10.5", "JPY", 0, ErrTooManyDecimals},
+		{"1.2345", "KWD", 0, ErrTooManyDecimals},
+		{"1e3", "BRL", 0, ErrInvalidAmount},
+		{"1.", "BRL", 0, ErrInvalidAmount},
+		{".5", "BRL", 0, ErrInvalidAmount},
+		{"", "BRL", 0, ErrInvalidAmount},
+		{"1,50", "BRL", 0, ErrInvalidAmount},
+		{"92233720368547758.08", "BRL", 0, ErrOverflow},
+		{"10", "XXX", 0, ErrUnknownCurrency},
+	}
+	for _, tt := range tests {
+		t.Run(tt.currency+" "+tt.decimal, func(t *testing.T) {
+			m, err := Parse(tt.decimal, tt.currency)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Parse(%q, %s) error = %v, want %v", tt.decimal, tt.currency, err, tt.err)
+			}
+			if err == nil && (m.Minor() != tt.minor || m.Currency() != tt.currency) {
+				t.Fatalf("Parse(%q, %s) = %d %s, want %d %s", tt.decimal, tt.currency, m.Minor(), m.Currency(), tt.minor, tt.currency)
+			}
+		})
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	tests := []struct {
+		raw   string
+		minor int64
+		err   error
+	}{
+		{`100.50`, 10050, nil},
+		{`"100.50"`, 10050, nil},
+		{` 7 `, 700, nil},
+		{`0.1`, 10, nil},
+		{`1e2`, 0, ErrInvalidAmount},
+		{`"abc"`, 0, ErrInvalidAmount},
+		{`0.001`, 0, ErrTooManyDecimals},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			m, err := ParseJSON(json.RawMessage(tt.raw), "BRL")
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("ParseJSON(%s) error = %v, want %v", tt.raw, err, tt.err)
+			}
+			if err == nil && m.Minor() != tt.minor {
+				t.Fatalf("ParseJSON(%s) = %d, want %d", tt.raw, m.Minor(), tt.minor)
+			}
+		})
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	tests := []struct {
+		minor    int64
+		currency string
+		want     string
+	}{
+		{10050, "BRL", "100.50"},
+		{5, "BRL", "0.05"},
+		{0, "USD", "0.00"},
+		{-230, "EUR", "-2.30"},
+		{1500, "JPY", "1500"},
+		{1, "KWD", "0.001"},
+		{-9223372036854775808, "USD", "-92233720368547758.08"},
+	}
+	for _, tt := range tests {
+		m, err := New(tt.minor, tt.currency)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := m.Decimal(); got != tt.want {
+			t.Errorf("New(%d, %s).Decimal() = %q, want %q", tt.minor, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	a, _ := New(10050, "BRL")
+	b, _ := New(2525, "BRL")
+	usd, _ := New(100, "USD")
+	max, _ := New(9223372036854775807, "BRL")
+	one, _ := New(1, "BRL")
+
+	if sum, err := a.Add(b); err != nil || sum.Minor() != 12575 {
+		t.Errorf("Add = %v, %v; want 12575", sum.Minor(), err)
+	}
+	if diff, err := a.Sub(b); err != nil || diff.Minor() != 7525 {
+		t.Errorf("Sub = %v, %v; want 7525", diff.Minor(), err)
+	}
+	if _, err := a.Add(usd); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Add across currencies error = %v, want %v", err, ErrCurrencyMismatch)
+	}
+	if _, err := max.Add(one); !errors.Is(err, ErrOverflow) {
+		t.Errorf("Add past max error = %v, want %v", err, ErrOverflow)
+	}
+	if cmp, _ := a.Cmp(b); cmp != 1 {
+		t.Errorf("Cmp = %d, want 1", cmp)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	m, _ := New(123456, "KWD")
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"value":"123.456","currency":"KWD"}` {
+		t.Fatalf("Marshal = %s", data)
+	}
+	var back Money
+	if err := json.Unmarshal(data, &back); err != nil {
+		t.Fatal(err)
+	}
+	if back != m {
+		t.Fatalf("round trip = %v, want %v", back, m)
+	}
+	if err := json.Unmarshal([]byte(`{"value":"1.2345","currency":"KWD"}`), &back); !errors.Is(err, ErrTooManyDecimals) {
+		t.Fatalf("Unmarshal with extra decimals error = %v, want %v", err, ErrTooManyDecimals)
+	}
+}
@@ -0,0 +1,80 @@
+// Package problem escreve as respostas de erro HTTP no formato RFC 7807
+// (application/problem+json) usadas pelos serviços e pelas bibliotecas de
+// administração (chaos, messaging, adminauth): um único formato de corpo,
+// tipo "urn:fintechdev:problem:<code>" e o campo "code" estável.
+package problem
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const ContentType = "application/problem+json"
+
+// FieldError descreve um campo inválido, no formato do membro "errors" das
+// respostas application/problem+json
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Problem é o corpo da resposta. Clientes devem decidir pelo campo "code",
+// nunca pelo texto de "detail"
+type Problem struct {
+	Type          string       `json:"type"`
+	Title         string       `json:"title"`
+	Status        int          `json:"status"`
+	Detail        string       `json:"detail,omitempty"`
+	Instance      string       `json:"instance,omitempty"`
+	Code          string       `json:"code"`
+	Errors        []FieldError `json:"errors,omitempty"`
+	CorrelationID string       `json:"correlationId,omitempty"`
+	TraceID       string       `json:"traceId,omitempty"`
+}
+
+func New(status int, code, detail string) *Problem {
+	return &Problem{
+		Type:   "urn:fintechdev:problem:" + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+func (p *Problem) Error() string {
+	return fmt.Sprintf("%s: %s", p.Code, p.Detail)
+}
+
+// Write completa instance com o caminho da requisição e correlationId/traceId
+// com os valores que os middlewares de log guardam no contexto
+// ("correlation_id" e "trace_id"), e escreve a resposta
+func Write(w http.ResponseWriter, r *http.Request, p *Problem) {
+	ctx := r.Context()
+	p.Instance = r.URL.Path
+	p.CorrelationID, _ = ctx.Value("correlation_id").(string)
+	p.TraceID, _ = ctx.Value("trace_id").(string)
+
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// Error escreve um problem sem erros de campo, como http.Error
+func Error(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	Write(w, r, New(status, code, detail))
+}
+
+// MethodNotAllowed responde 405 (method_not_allowed) para métodos não
+// suportados de uma rota, com o header Allow
+func MethodNotAllowed(allowed ...string) http.HandlerFunc {
+	allow := strings.Join(allowed, ", ")
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", allow)
+		Error(w, r, http.StatusMethodNotAllowed, "method_not_allowed",
+			fmt.Sprintf("method %s is not allowed; use %s", r.Method, allow))
+	}
+}
@@ -0,0 +1,62 @@
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		ctx     map[string]string
+		status  int
+		code    string
+		allow   string
+	}{
+		{"error", func(w http.ResponseWriter, r *http.Request) {
+			Error(w, r, http.StatusNotFound, "dead_letter_not_found", "not found")
+		}, nil, http.StatusNotFound, "dead_letter_not_found", ""},
+		{"correlation from context", func(w http.ResponseWriter, r *http.Request) {
+			p := New(http.StatusUnprocessableEntity, "validation_failed", "invalid")
+			p.Errors = []FieldError{{Field: "amount", Code: "required", Message: "is required"}}
+			Write(w, r, p)
+		}, map[string]string{"correlation_id": "corr-1", "trace_id": "trace-1"}, http.StatusUnprocessableEntity, "validation_failed", ""},
+		{"method not allowed", MethodNotAllowed(http.MethodGet, http.MethodPut),
+			nil, http.StatusMethodNotAllowed, "method_not_allowed", "GET, PUT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, "/admin/lag", nil)
+			ctx := req.Context()
+			for k, v := range tt.ctx {
+				ctx = context.WithValue(ctx, k, v)
+			}
+			rec := httptest.NewRecorder()
+			tt.handler(rec, req.WithContext(ctx))
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if got := rec.Header().Get("Content-Type"); got != ContentType {
+				t.Fatalf("Content-Type = %q", got)
+			}
+			if got := rec.Header().Get("Allow"); got != tt.allow {
+				t.Fatalf("Allow = %q, want %q", got, tt.allow)
+			}
+			var p Problem
+			if err := json.NewDecoder(rec.Body).Decode(&p); err != nil {
+				t.Fatal(err)
+			}
+			if p.Code != tt.code || p.Type != "urn:fintechdev:problem:"+tt.code || p.Status != tt.status || p.Instance != "/admin/lag" {
+				t.Fatalf("problem = %+v", p)
+			}
+			if p.CorrelationID != tt.ctx["correlation_id"] || p.TraceID != tt.ctx["trace_id"] {
+				t.Fatalf("correlationId/traceId = %q/%q, want %q/%q", p.CorrelationID, p.TraceID, tt.ctx["correlation_id"], tt.ctx["trace_id"])
+			}
+		})
+	}
+}
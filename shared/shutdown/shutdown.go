@@ -0,0 +1,168 @@
+// Package shutdown coordena o encerramento dos serviços: ao receber SIGTERM
+// ou SIGINT a readiness passa a falhar, e as etapas registradas (drenar o
+// HTTP, terminar as mensagens em andamento, fechar o AMQP, enviar os spans
+// pendentes) rodam em ordem dentro de um único prazo de drenagem.
+package shutdown
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Padrão de SHUTDOWN_DRAIN_TIMEOUT_MS: abaixo dos 30s que o Docker e o
+// Kubernetes esperam entre o SIGTERM e o SIGKILL
+const defaultDrainTimeout = 25 * time.Second
+
+// Step é uma etapa do encerramento. Todas compartilham o contexto com o
+// prazo de drenagem; uma etapa que falha ou estoura o prazo não impede as
+// seguintes
+type Step struct {
+	Name string
+	Fn   func(ctx context.Context) error
+}
+
+// Func adapta uma função bloqueante sem contexto (ex: Close que espera uma
+// goroutine terminar): a etapa desiste quando o prazo acaba
+func Func(fn func()) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			fn()
+		}()
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+type Manager struct {
+	logger       *zap.Logger
+	drainTimeout time.Duration
+	// Espera entre falhar a readiness e começar a drenar, para que o
+	// balanceador pare de enviar tráfego
+	readinessDelay time.Duration
+
+	draining atomic.Bool
+	signals  chan os.Signal
+	triggers chan string
+}
+
+// NewFromEnv passa a capturar SIGTERM/SIGINT. Configuração via
+// SHUTDOWN_DRAIN_TIMEOUT_MS (padrão 25000) e SHUTDOWN_READINESS_DELAY_MS
+// (padrão 0)
+func NewFromEnv(logger *zap.Logger) *Manager {
+	m := &Manager{
+		logger:       logger,
+		drainTimeout: defaultDrainTimeout,
+		signals:      make(chan os.Signal, 1),
+		triggers:     make(chan string, 1),
+	}
+	if v, err := strconv.Atoi(os.Getenv("SHUTDOWN_DRAIN_TIMEOUT_MS")); err == nil && v > 0 {
+		m.drainTimeout = time.Duration(v) * time.Millisecond
+	}
+	if v, err := strconv.Atoi(os.Getenv("SHUTDOWN_READINESS_DELAY_MS")); err == nil && v >= 0 {
+		m.readinessDelay = time.Duration(v) * time.Millisecond
+	}
+	signal.Notify(m.signals, syscall.SIGTERM, syscall.SIGINT)
+	return m
+}
+
+// Draining indica que o encerramento começou: nenhum trabalho novo deve
+// ser aceito
+func (m *Manager) Draining() bool {
+	return m.draining.Load()
+}
+
+// HandleReady responde a readiness: 200 em operação, 503 durante o
+// encerramento (o /health continua indicando apenas que o processo está vivo)
+func (m *Manager) HandleReady(w http.ResponseWriter, r *http.Request) {
+	status, body := http.StatusOK, "ready"
+	if m.Draining() {
+		status, body = http.StatusServiceUnavailable, "draining"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"status": body})
+}
+
+// Trigger inicia o encerramento sem sinal (ex: o broker fechou o canal do
+// consumidor e o processo não tem mais trabalho a fazer)
+func (m *Manager) Trigger(reason string) {
+	select {
+	case m.triggers <- reason:
+	default:
+	}
+}
+
+// Wait bloqueia até o primeiro SIGTERM/SIGINT (ou Trigger) e retorna o
+// motivo. Um segundo sinal durante o encerramento derruba o processo
+// imediatamente
+func (m *Manager) Wait() string {
+	var reason string
+	select {
+	case sig := <-m.signals:
+		reason = sig.String()
+	case reason = <-m.triggers:
+	}
+	go func() {
+		second := <-m.signals
+		m.logger.Warn("shutdown_forced", zap.String("signal", second.String()))
+		m.logger.Sync()
+		os.Exit(1)
+	}()
+	return reason
+}
+
+// Shutdown falha a readiness, aguarda o readinessDelay e executa as etapas
+// em ordem dentro do prazo de drenagem, registrando a duração de cada uma
+func (m *Manager) Shutdown(reason string, steps ...Step) {
+	start := time.Now()
+	m.draining.Store(true)
+	m.logger.Info("shutdown_started",
+		zap.String("reason", reason),
+		zap.Duration("drain_timeout", m.drainTimeout),
+		zap.Duration("readiness_delay", m.readinessDelay),
+	)
+	if m.readinessDelay > 0 {
+		time.Sleep(m.readinessDelay)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.drainTimeout)
+	defer cancel()
+
+	failed := 0
+	for _, step := range steps {
+		stepStart := time.Now()
+		if err := step.Fn(ctx); err != nil {
+			failed++
+			m.logger.Error("shutdown_step_failed",
+				zap.String("step", step.Name),
+				zap.Duration("duration", time.Since(stepStart)),
+				zap.Error(err),
+			)
+			continue
+		}
+		m.logger.Info("shutdown_step_completed",
+			zap.String("step", step.Name),
+			zap.Duration("duration", time.Since(stepStart)),
+		)
+	}
+
+	m.logger.Info("shutdown_completed",
+		zap.Duration("duration", time.Since(start)),
+		zap.Int("failed_steps", failed),
+	)
+}
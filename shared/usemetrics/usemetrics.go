@@ -0,0 +1,224 @@
+// Package usemetrics coleta as métricas USE (Utilization, Saturation,
+// Errors) reais dos serviços: CPU e memória do processo lidas de /proc,
+// estatísticas do runtime do Go (goroutines, heap, pausas de GC e latência
+// do escalonador), requisições HTTP em andamento, profundidade e
+// consumidores das filas RabbitMQ e idade dos eventos no consumo. As
+// métricas ficam no registry padrão do Prometheus.
+package usemetrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+// Ticks de CPU por segundo em /proc/<pid>/stat (USER_HZ): 100 no Linux em
+// todas as arquiteturas suportadas pelas imagens
+const clockTicksPerSecond = 100
+
+var (
+	// Utilization
+	cpuUtilization = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "cpu_utilization_percent",
+			Help: "Process CPU utilization as a percentage of the available CPUs (from /proc)",
+		},
+	)
+
+	memoryUtilization = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "memory_utilization_bytes",
+			Help: "Process resident set size in bytes (from /proc)",
+		},
+	)
+
+	// Saturation
+	httpInFlight = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "HTTP requests currently being served",
+		},
+	)
+
+	queueDepth = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "message_queue_depth",
+			Help: "Messages ready for delivery in the queue (backlog), from a passive queue declare",
+		},
+		[]string{"queue"},
+	)
+
+	queueConsumers = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "message_queue_consumers",
+			Help: "Consumers attached to the queue, from a passive queue declare",
+		},
+		[]string{"queue"},
+	)
+
+	eventAge = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "event_age_seconds",
+			Help:    "End-to-end event age at consume time (now minus the event ts)",
+			Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300},
+		},
+		[]string{"event"},
+	)
+
+	// Errors
+	queueInspectFailures = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "message_queue_inspect_failures_total",
+			Help: "Failed passive queue declares while polling queue depth",
+		},
+		[]string{"queue"},
+	)
+)
+
+// Start troca o coletor padrão do runtime do Go por um que também exporta a
+// latência do escalonador (go_sched_latencies_seconds: tempo que goroutines
+// prontas esperam por uma thread, sinal de saturação de CPU) e passa a
+// amostrar CPU e RSS do processo a cada interval
+func Start(ctx context.Context, logger *zap.Logger, interval time.Duration) {
+	prometheus.Unregister(collectors.NewGoCollector())
+	prometheus.MustRegister(collectors.NewGoCollector(
+		collectors.WithGoCollectorRuntimeMetrics(collectors.GoRuntimeMetricsRule{
+			Matcher: regexp.MustCompile(`^/sched/latencies:seconds$`),
+		}),
+	))
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		lastCPU, err := processCPUSeconds()
+		if err != nil {
+			// Fora do Linux não há /proc: as métricas do runtime continuam
+			logger.Warn("process_metrics_unavailable", zap.Error(err))
+			return
+		}
+		lastAt := time.Now()
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+
+			now := time.Now()
+			if cpu, err := processCPUSeconds(); err == nil {
+				elapsed := now.Sub(lastAt).Seconds() * float64(runtime.NumCPU())
+				cpuUtilization.Set((cpu - lastCPU) / elapsed * 100)
+				lastCPU, lastAt = cpu, now
+			}
+			if rss, err := processRSSBytes(); err == nil {
+				memoryUtilization.Set(float64(rss))
+			}
+		}
+	}()
+}
+
+// processCPUSeconds soma utime e stime de /proc/self/stat. Os campos são
+// contados a partir do último ')', já que o nome do comando pode ter espaços
+func processCPUSeconds() (float64, error) {
+	data, err := os.ReadFile("/proc/self/stat")
+	if err != nil {
+		return 0, err
+	}
+	i := bytes.LastIndexByte(data, ')')
+	if i < 0 {
+		return 0, fmt.Errorf("unexpected /proc/self/stat format")
+	}
+	// Após o ')': state(3) ... utime(14) stime(15)
+	fields := bytes.Fields(data[i+1:])
+	if len(fields) < 13 {
+		return 0, fmt.Errorf("unexpected /proc/self/stat format")
+	}
+	utime, err := strconv.ParseUint(string(fields[11]), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	stime, err := strconv.ParseUint(string(fields[12]), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return float64(utime+stime) / clockTicksPerSecond, nil
+}
+
+// processRSSBytes lê as páginas residentes de /proc/self/statm
+func processRSSBytes() (int64, error) {
+	data, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0, err
+	}
+	fields := bytes.Fields(data)
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("unexpected /proc/self/statm format")
+	}
+	pages, err := strconv.ParseInt(string(fields[1]), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return pages * int64(os.Getpagesize()), nil
+}
+
+// InFlight conta as requisições em andamento no handler (http_requests_in_flight)
+func InFlight(next http.Handler) http.Handler {
+	return promhttp.InstrumentHandlerInFlight(httpInFlight, next)
+}
+
+// ObserveEventAge registra a idade de um evento no consumo a partir do ts
+// (Unix em milissegundos) gravado pelo produtor. Eventos sem ts são
+// ignorados; diferenças de relógio negativas contam como zero
+func ObserveEventAge(event string, tsMillis int64) {
+	if tsMillis <= 0 {
+		return
+	}
+	age := time.Since(time.UnixMilli(tsMillis)).Seconds()
+	if age < 0 {
+		age = 0
+	}
+	eventAge.WithLabelValues(event).Observe(age)
+}
+
+// QueueInspector retorna as mensagens prontas e os consumidores de uma fila
+// (ex: QueueDeclarePassive do amqp091)
+type QueueInspector func(queue string) (messages, consumers int, err error)
+
+// MonitorQueues consulta as filas a cada interval até ctx terminar e
+// atualiza message_queue_depth e message_queue_consumers
+func MonitorQueues(ctx context.Context, logger *zap.Logger, interval time.Duration, inspect QueueInspector, queues ...string) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			for _, queue := range queues {
+				messages, consumers, err := inspect(queue)
+				if err != nil {
+					queueInspectFailures.WithLabelValues(queue).Inc()
+					logger.Warn("queue_inspect_failed", zap.String("queue", queue), zap.Error(err))
+					continue
+				}
+				queueDepth.WithLabelValues(queue).Set(float64(messages))
+				queueConsumers.WithLabelValues(queue).Set(float64(consumers))
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}